@@ -0,0 +1,237 @@
+package plates
+
+import (
+	"bufio"
+	"errors"
+	"image"
+	"image/color"
+	"image/color/palette"
+	"image/draw"
+	"image/gif"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// Animation is a sequence of frames that are shown one after the other.
+// All the frames are complete images of the same size, so that any
+// function in plates can be used on each frame.
+type Animation struct {
+	// Frames are the images of the animation
+	Frames []image.Image
+
+	// Delays are the delay times for each frame, in 100ths of a second
+	Delays []int
+
+	// LoopCount controls the number of times the animation is shown.
+	// 0 means that it loops forever, -1 means that it is shown once,
+	// and n means that it is shown n+1 times. This is the same as for image/gif.
+	LoopCount int
+}
+
+// Map calls f for each frame and returns a new animation with the resulting frames.
+// The delays and loop count are kept. This can be used for applying any of the
+// functions in plates to all frames, for example:
+//
+//	red := a.Map(func(m image.Image) image.Image { return plates.Red(m) })
+func (a *Animation) Map(f func(image.Image) image.Image) *Animation {
+	result := &Animation{
+		Frames:    make([]image.Image, len(a.Frames)),
+		Delays:    append([]int(nil), a.Delays...),
+		LoopCount: a.LoopCount,
+	}
+	for i, frame := range a.Frames {
+		result.Frames[i] = f(frame)
+	}
+	return result
+}
+
+// ReadAll tries to read all the frames of the given image filename.
+// For GIF and WebP images, every frame is read, and frames that only update a part
+// of the image are combined with the previous frames, according to the
+// disposal method of each frame. Other formats give an animation with one frame.
+func ReadAll(filename string) (*Animation, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	br := bufio.NewReader(f)
+	header := peekHeader(br)
+	if gifFormat, ok := formatByName("gif"); ok && gifFormat.matches(header) {
+		return DecodeAllGIF(br)
+	}
+	// The VP8X chunk with the animation flag comes right after the WebP header
+	if vp8x, _ := br.Peek(21); isAnimatedWebP(vp8x) {
+		return DecodeAllWebP(br)
+	}
+	// Not a GIF, so read it as a still image
+	m, _, err := ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	return &Animation{Frames: []image.Image{m}, Delays: []int{0}}, nil
+}
+
+// WriteAll tries to write all the frames of the given animation to a file.
+// Only GIF and WebP images can have more than one frame. For the other formats,
+// the animation must have exactly one frame, which is then written with Write.
+// The file is replaced atomically, like with Write.
+func WriteAll(filename string, a *Animation, opts ...*EncodeOptions) error {
+	f, ok := formatByExtension(filename)
+	if !ok {
+		return errors.New("unrecognized file extension: " + filepath.Ext(filename))
+	}
+	var encodeOptions *EncodeOptions
+	if len(opts) > 0 {
+		encodeOptions = opts[0]
+	}
+	switch {
+	case f.name == "gif":
+		return writeAtomically(filename, func(w io.Writer) error {
+			return EncodeAllGIF(w, a, encodeOptions)
+		})
+	case f.name == "webp" && len(a.Frames) > 1:
+		return writeAtomically(filename, func(w io.Writer) error {
+			return EncodeAllWebP(w, a, encodeOptions)
+		})
+	case len(a.Frames) != 1:
+		return errors.New("the image format does not support animation: " + f.name)
+	}
+	return Write(filename, a.Frames[0], opts...)
+}
+
+// DecodeAllGIF decodes all the frames of a GIF image, and combines each
+// frame with the previous frames according to the disposal methods,
+// so that each frame in the returned animation is a complete *image.RGBA.
+func DecodeAllGIF(r io.Reader) (*Animation, error) {
+	g, err := gif.DecodeAll(r)
+	if err != nil {
+		return nil, err
+	}
+	var (
+		rect     = image.Rect(0, 0, g.Config.Width, g.Config.Height)
+		canvas   = image.NewRGBA(rect)
+		previous *image.RGBA
+		a        = &Animation{
+			Frames:    make([]image.Image, len(g.Image)),
+			Delays:    append([]int(nil), g.Delay...),
+			LoopCount: g.LoopCount,
+		}
+	)
+	if rect.Empty() && len(g.Image) > 0 {
+		rect = g.Image[0].Bounds()
+		canvas = image.NewRGBA(rect)
+	}
+	for i, frame := range g.Image {
+		disposal := byte(0)
+		if i < len(g.Disposal) {
+			disposal = g.Disposal[i]
+		}
+		if disposal == gif.DisposalPrevious {
+			previous = cloneRGBA(canvas)
+		}
+		draw.Draw(canvas, frame.Bounds(), frame, frame.Bounds().Min, draw.Over)
+		a.Frames[i] = cloneRGBA(canvas)
+		// Prepare the canvas for the next frame
+		switch disposal {
+		case gif.DisposalBackground:
+			draw.Draw(canvas, frame.Bounds(), image.Transparent, image.Point{}, draw.Src)
+		case gif.DisposalPrevious:
+			canvas = previous
+		}
+	}
+	return a, nil
+}
+
+// EncodeAllGIF writes all the frames of the given animation to w as an animated GIF.
+// Each frame is converted to a palette with the GIFNumColors, GIFQuantizer and
+// GIFDrawer encoding options. Pixels that are more than half transparent are
+// written as transparent. If opts is nil, the default options are used.
+func EncodeAllGIF(w io.Writer, a *Animation, opts *EncodeOptions) error {
+	if len(a.Frames) == 0 {
+		return errors.New("the animation has no frames")
+	}
+	if opts == nil {
+		opts = &EncodeOptions{}
+	}
+	g := &gif.GIF{
+		Image:     make([]*image.Paletted, len(a.Frames)),
+		Delay:     make([]int, len(a.Frames)),
+		Disposal:  make([]byte, len(a.Frames)),
+		LoopCount: a.LoopCount,
+	}
+	for i, frame := range a.Frames {
+		g.Image[i] = palettedFrame(frame, opts)
+		if i < len(a.Delays) {
+			g.Delay[i] = a.Delays[i]
+		}
+		// Each frame is complete, so the previous frame is cleared before the next one is drawn
+		g.Disposal[i] = gif.DisposalBackground
+	}
+	return gif.EncodeAll(w, g)
+}
+
+// palettedFrame converts an image to a paletted image that can be used as a GIF frame
+func palettedFrame(m image.Image, opts *EncodeOptions) *image.Paletted {
+	numColors := 256
+	if opts.GIFNumColors > 0 && opts.GIFNumColors < 256 {
+		numColors = opts.GIFNumColors
+	}
+	rect := m.Bounds()
+	transparent := hasTransparency(m)
+	if transparent && numColors > 1 {
+		// Make room for the transparent color
+		numColors--
+	}
+	var pal color.Palette
+	if opts.GIFQuantizer != nil {
+		pal = opts.GIFQuantizer.Quantize(make(color.Palette, 0, numColors), m)
+		if len(pal) > numColors {
+			pal = pal[:numColors]
+		}
+	} else {
+		pal = append(color.Palette(nil), palette.Plan9[:numColors]...)
+	}
+	drawer := opts.GIFDrawer
+	if drawer == nil {
+		drawer = draw.FloydSteinberg
+	}
+	pm := image.NewPaletted(rect, pal)
+	drawer.Draw(pm, rect, m, rect.Min)
+	if transparent {
+		pm.Palette = append(pm.Palette, color.RGBA{})
+		index := uint8(len(pm.Palette) - 1)
+		for y := rect.Min.Y; y < rect.Max.Y; y++ {
+			for x := rect.Min.X; x < rect.Max.X; x++ {
+				if _, _, _, a := m.At(x, y).RGBA(); a < 0x8000 {
+					pm.SetColorIndex(x, y, index)
+				}
+			}
+		}
+	}
+	return pm
+}
+
+// hasTransparency checks if the image has any pixels that are not fully opaque
+func hasTransparency(m image.Image) bool {
+	if o, ok := m.(interface{ Opaque() bool }); ok {
+		return !o.Opaque()
+	}
+	rect := m.Bounds()
+	for y := rect.Min.Y; y < rect.Max.Y; y++ {
+		for x := rect.Min.X; x < rect.Max.X; x++ {
+			if _, _, _, a := m.At(x, y).RGBA(); a != 0xffff {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// cloneRGBA returns a copy of an *image.RGBA
+func cloneRGBA(m *image.RGBA) *image.RGBA {
+	c := image.NewRGBA(m.Rect)
+	copy(c.Pix, m.Pix)
+	return c
+}
@@ -0,0 +1,205 @@
+package plates
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/gif"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// testGIF returns a GIF with three frames, where the last two frames only update part of the image
+func testGIF() *gif.GIF {
+	pal := color.Palette{color.RGBA{}, color.RGBA{255, 0, 0, 255}, color.RGBA{0, 0, 255, 255}, color.RGBA{255, 255, 255, 255}}
+	frame1 := image.NewPaletted(image.Rect(0, 0, 4, 4), pal)
+	for i := range frame1.Pix {
+		frame1.Pix[i] = 3 // white
+	}
+	frame2 := image.NewPaletted(image.Rect(1, 1, 3, 3), pal)
+	for i := range frame2.Pix {
+		frame2.Pix[i] = 1 // red
+	}
+	frame3 := image.NewPaletted(image.Rect(0, 0, 1, 1), pal)
+	frame3.Pix[0] = 2 // blue
+	return &gif.GIF{
+		Image:     []*image.Paletted{frame1, frame2, frame3},
+		Delay:     []int{10, 20, 30},
+		Disposal:  []byte{gif.DisposalNone, gif.DisposalBackground, gif.DisposalNone},
+		LoopCount: 3,
+		Config:    image.Config{ColorModel: pal, Width: 4, Height: 4},
+	}
+}
+
+func TestDecodeAllGIF(t *testing.T) {
+	var buf bytes.Buffer
+	if err := gif.EncodeAll(&buf, testGIF()); err != nil {
+		t.Fatal(err)
+	}
+	a, err := DecodeAllGIF(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(a.Frames) != 3 || a.LoopCount != 3 || a.Delays[2] != 30 {
+		t.Fatalf("Unexpected animation: %d frames, loop count %d, delays %v", len(a.Frames), a.LoopCount, a.Delays)
+	}
+	white := color.RGBA{255, 255, 255, 255}
+	red := color.RGBA{255, 0, 0, 255}
+	blue := color.RGBA{0, 0, 255, 255}
+	// The second frame is drawn on top of the first one
+	if c := a.Frames[1].At(0, 0); c != white {
+		t.Errorf("Expected white from the first frame, got %v", c)
+	}
+	if c := a.Frames[1].At(1, 1); c != red {
+		t.Errorf("Expected red from the second frame, got %v", c)
+	}
+	// The second frame is cleared before the third frame is drawn
+	if c := a.Frames[2].At(1, 1); c != (color.RGBA{}) {
+		t.Errorf("Expected the second frame to be disposed, got %v", c)
+	}
+	if c := a.Frames[2].At(0, 0); c != blue {
+		t.Errorf("Expected blue from the third frame, got %v", c)
+	}
+	if c := a.Frames[2].At(3, 3); c != white {
+		t.Errorf("Expected white from the first frame, got %v", c)
+	}
+}
+
+func TestAnimationRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	var buf bytes.Buffer
+	if err := gif.EncodeAll(&buf, testGIF()); err != nil {
+		t.Fatal(err)
+	}
+	filename := filepath.Join(dir, "test.gif")
+	if err := os.WriteFile(filename, buf.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	a, err := ReadAll(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Keep only the red channel of each frame
+	red := a.Map(func(m image.Image) image.Image {
+		return Red(m)
+	})
+	outfile := filepath.Join(dir, "red.gif")
+	if err := WriteAll(outfile, red); err != nil {
+		t.Fatal(err)
+	}
+	b, err := ReadAll(outfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(b.Frames) != 3 || b.LoopCount != 3 || b.Delays[1] != 20 {
+		t.Fatalf("Unexpected animation: %d frames, loop count %d, delays %v", len(b.Frames), b.LoopCount, b.Delays)
+	}
+	same(t, "frame 1", red.Frames[0], b.Frames[0])
+	same(t, "frame 3", red.Frames[2], b.Frames[2])
+
+	if err := WriteAll(filepath.Join(dir, "test.png"), red); err == nil {
+		t.Error("Expected an error when writing several frames to a PNG file")
+	}
+	if err := Write(filepath.Join(dir, "still.png"), testImage()); err != nil {
+		t.Fatal(err)
+	}
+	still, err := ReadAll(filepath.Join(dir, "still.png"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(still.Frames) != 1 {
+		t.Errorf("Expected one frame, got %d", len(still.Frames))
+	}
+}
+
+func TestAnimationRoundTripWebP(t *testing.T) {
+	dir := t.TempDir()
+	var buf bytes.Buffer
+	if err := gif.EncodeAll(&buf, testGIF()); err != nil {
+		t.Fatal(err)
+	}
+	a, err := DecodeAllGIF(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	filename := filepath.Join(dir, "test.webp")
+	if err := WriteAll(filename, a, &EncodeOptions{WebPLossless: true}); err != nil {
+		t.Fatal(err)
+	}
+	b, err := ReadAll(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(b.Frames) != 3 || b.LoopCount != a.LoopCount || b.Delays[1] != a.Delays[1] {
+		t.Fatalf("Unexpected animation: %d frames, loop count %d, delays %v", len(b.Frames), b.LoopCount, b.Delays)
+	}
+	for i := range a.Frames {
+		same(t, "frame", a.Frames[i], b.Frames[i])
+	}
+}
+
+// webpFrame returns an ANMF chunk with a lossless image at the given position
+func webpFrame(t *testing.T, m image.Image, x, y int, flags byte) riffChunk {
+	var buf bytes.Buffer
+	if err := EncodeWebPLossless(&buf, m); err != nil {
+		t.Fatal(err)
+	}
+	header := make([]byte, webpFrameHeaderSize)
+	putUint24(header, x/2)
+	putUint24(header[3:], y/2)
+	putUint24(header[6:], m.Bounds().Dx()-1)
+	putUint24(header[9:], m.Bounds().Dy()-1)
+	putUint24(header[12:], 100)
+	header[15] = flags
+	return riffChunk{"ANMF", append(header, buf.Bytes()[12:]...)}
+}
+
+func TestDecodeAllWebP(t *testing.T) {
+	var (
+		white = image.NewRGBA(image.Rect(0, 0, 4, 4))
+		red   = image.NewRGBA(image.Rect(0, 0, 2, 2))
+		anim  = []byte{0, 0, 0, 0, 2, 0}
+	)
+	for i := range white.Pix {
+		white.Pix[i] = 255
+	}
+	for i := 0; i < len(red.Pix); i += 4 {
+		red.Pix[i], red.Pix[i+3] = 255, 255
+	}
+	// A half transparent pixel is blended with the canvas
+	red.Pix[0], red.Pix[3] = 128, 128 // premultiplied
+	data := riffBytes([]riffChunk{
+		{"VP8X", vp8xData(webpAnimationFlag|webpAlphaFlag, 4, 4)},
+		{"ANIM", anim},
+		webpFrame(t, white, 0, 0, 0),
+		webpFrame(t, red, 2, 2, webpDisposeFlag),
+		webpFrame(t, red, 0, 0, webpNoBlendFlag),
+	})
+	a, err := DecodeAllWebP(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(a.Frames) != 3 || a.LoopCount != 1 || a.Delays[0] != 10 {
+		t.Fatalf("Unexpected animation: %d frames, loop count %d, delays %v", len(a.Frames), a.LoopCount, a.Delays)
+	}
+	at := func(frame, x, y int) color.RGBA {
+		return color.RGBAModel.Convert(a.Frames[frame].At(x, y)).(color.RGBA)
+	}
+	if c := at(1, 3, 3); c != (color.RGBA{255, 0, 0, 255}) {
+		t.Errorf("Expected red, got %v", c)
+	}
+	if c := at(1, 2, 2); c != (color.RGBA{255, 127, 127, 255}) {
+		t.Errorf("Expected red blended with white, got %v", c)
+	}
+	// The second frame is disposed, and the third frame replaces the pixels without blending
+	if c := at(2, 3, 3); c != (color.RGBA{}) {
+		t.Errorf("Expected a transparent pixel after the disposal, got %v", c)
+	}
+	if c := at(2, 0, 0); c != (color.RGBA{128, 0, 0, 128}) {
+		t.Errorf("Expected half transparent red, got %v", c)
+	}
+	if _, err := DecodeAllWebP(bytes.NewReader(data[:40])); err == nil {
+		t.Error("Expected an error for a truncated animation")
+	}
+}
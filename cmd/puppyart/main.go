@@ -7,6 +7,7 @@ import (
 	"image/color"
 	"image/draw"
 	"log"
+	"strings"
 
 	"github.com/xyproto/plates"
 )
@@ -21,14 +22,31 @@ Options:
   --version   Show the program version and exit.`
 )
 
+// formatList returns a list of the image formats that can be read and written, for the help text
+func formatList() string {
+	var sb strings.Builder
+	sb.WriteString("Image formats:\n")
+	for _, f := range plates.Formats() {
+		var modes []string
+		if f.CanDecode {
+			modes = append(modes, "read")
+		}
+		if f.CanEncode {
+			modes = append(modes, "write")
+		}
+		fmt.Fprintf(&sb, "  %-10s %-22s %s\n", f.Name, strings.Join(f.Extensions, " "), strings.Join(modes, ", "))
+	}
+	return strings.TrimRight(sb.String(), "\n")
+}
+
 // convert takes an image file and modifies it based on a specified threshold and two given colors.
 // It returns a processed image.
 func convert(infilename string, thresh uint8, color1, color2 color.RGBA) image.Image {
 	// Combine the two colors to create a mixed color
 	mixcolor := plates.PaintMix(color1, color2)
 
-	// Load the input image
-	img, err := plates.Read(infilename)
+	// Load the input image, with the colors converted to sRGB if it has an ICC profile
+	img, err := plates.Read(infilename, &plates.ReadOptions{WorkingSpace: plates.SRGBProfile})
 	if err != nil {
 		log.Fatalln(err)
 	}
@@ -56,6 +74,8 @@ func main() {
 	// Display help info
 	if *helpFlag {
 		fmt.Println(usage)
+		fmt.Println()
+		fmt.Println(formatList())
 		return
 	}
 
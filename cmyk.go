@@ -0,0 +1,184 @@
+package plates
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"image/color"
+)
+
+// CMYKOptions configures how RGBToCMYK converts colors to process color inks.
+// SeparateCMYK is configured with the GCR, UCR and TotalInkLimit options instead.
+type CMYKOptions struct {
+	// GCR is the gray component replacement, from 0 to 1.
+	// It is the fraction of the gray component (the part of the color that
+	// cyan, magenta and yellow have in common) that is replaced by black ink.
+	// 0 prints everything with CMY only, 1 uses as much black as possible.
+	GCR float64
+
+	// UCR enables under color removal, which limits the gray component
+	// replacement to neutral colors. The amount of black is scaled down
+	// by the HLS saturation of each pixel, so that saturated colors are
+	// printed with CMY only.
+	UCR bool
+
+	// TotalInkLimit is the maximum total ink coverage, where 1 is 100%
+	// coverage of a single ink and 4 is full coverage of all four inks.
+	// A value of 0 disables the limit.
+	TotalInkLimit float64
+}
+
+// DefaultCMYKOptions are the options used by SeparateCMYK when no options are given.
+// Full gray component replacement and a total ink limit of 300%.
+var DefaultCMYKOptions = CMYKOptions{
+	GCR:           1.0,
+	TotalInkLimit: 3.0,
+}
+
+// RGBToCMYK converts an RGB color (0 to 1) to ink coverage values (0 to 1)
+// for cyan, magenta, yellow and black, using the given options.
+func RGBToCMYK(r, g, b float64, opts CMYKOptions) (float64, float64, float64, float64) {
+	c := 1.0 - r
+	m := 1.0 - g
+	y := 1.0 - b
+
+	// The gray component is the part of the color that all three inks share
+	k := fmin(c, m, y) * clamp01(opts.GCR)
+	if opts.UCR {
+		_, _, s := HLS(r, g, b)
+		k *= 1.0 - s
+	}
+
+	// Remove the under color that is now covered by the black ink
+	if k < 1.0 {
+		c = (c - k) / (1.0 - k)
+		m = (m - k) / (1.0 - k)
+		y = (y - k) / (1.0 - k)
+	} else {
+		c, m, y = 0, 0, 0
+	}
+
+	// Reduce the colored inks proportionally if there is too much ink in total,
+	// and reduce the black ink too if it is over the limit by itself
+	if opts.TotalInkLimit > 0 {
+		if k > opts.TotalInkLimit {
+			k = opts.TotalInkLimit
+		}
+		if cmy := c + m + y; cmy > 0 && cmy+k > opts.TotalInkLimit {
+			scale := (opts.TotalInkLimit - k) / cmy
+			c *= scale
+			m *= scale
+			y *= scale
+		}
+	}
+
+	return clamp01(c), clamp01(m), clamp01(y), clamp01(k)
+}
+
+// GCR is an Option for SeparateCMYK that sets CMYKOptions.GCR, the gray component replacement
+func GCR(v float64) Option {
+	return func(cfg *config) {
+		cfg.cmyk.GCR = v
+	}
+}
+
+// UCR is an Option for SeparateCMYK that enables under color removal, like CMYKOptions.UCR
+func UCR() Option {
+	return func(cfg *config) {
+		cfg.cmyk.UCR = true
+	}
+}
+
+// TotalInkLimit is an Option for SeparateCMYK that sets CMYKOptions.TotalInkLimit,
+// the maximum total ink coverage. A value of 0 disables the limit.
+func TotalInkLimit(v float64) Option {
+	return func(cfg *config) {
+		cfg.cmyk.TotalInkLimit = v
+	}
+}
+
+// SeparateCMYK separates an image into four grayscale plates, one for each
+// of the process colors cyan, magenta, yellow and black.
+// Each plate is an *image.Gray, or an *image.Gray16 if the image has 16 bits per channel,
+// that looks like a printing film: black is
+// full ink coverage and white is no ink at all, so the plates can be saved
+// as individual files with Write. Transparent pixels are treated as paper.
+// DefaultCMYKOptions is used, unless it is changed with the GCR, UCR and TotalInkLimit options.
+func SeparateCMYK(m image.Image, opts ...Option) (image.Image, image.Image, image.Image, image.Image) {
+	cPlate, mPlate, yPlate, kPlate, _ := SeparateCMYKContext(context.Background(), m, opts...)
+	return cPlate, mPlate, yPlate, kPlate
+}
+
+// SeparateCMYKContext is like SeparateCMYK, but stops and returns the error from ctx if ctx is done
+// before all rows have been processed.
+func SeparateCMYKContext(ctx context.Context, m image.Image, opts ...Option) (image.Image, image.Image, image.Image, image.Image, error) {
+	// The configuration has a copy of DefaultCMYKOptions, so that the workers are not affected if it is changed
+	cfg := newConfig(opts)
+	if is16Bit(m) {
+		return separateCMYK64(ctx, m, cfg)
+	}
+	var (
+		rect    = m.Bounds()
+		read    = newRowReader(m, rect)
+		newRect = image.Rect(0, 0, rect.Dx(), rect.Dy())
+		cPlate  = image.NewGray(newRect)
+		mPlate  = image.NewGray(newRect)
+		yPlate  = image.NewGray(newRect)
+		kPlate  = image.NewGray(newRect)
+	)
+	err := eachRow(ctx, cfg, rect, 4*rect.Dx(), func(py int, row []uint8) {
+		read(py, row)
+		offset := cPlate.PixOffset(0, py-rect.Min.Y)
+		for i, x := 0, offset; i < len(row); i, x = i+4, x+1 {
+			a := row[i+3]
+			if a == 0 {
+				cPlate.Pix[x], mPlate.Pix[x], yPlate.Pix[x], kPlate.Pix[x] = 255, 255, 255, 255
+				continue
+			}
+			// The colors are premultiplied, so dividing by alpha gives the color from 0 to 1
+			alpha := float64(a)
+			c, mg, y, k := RGBToCMYK(float64(row[i])/alpha, float64(row[i+1])/alpha, float64(row[i+2])/alpha, cfg.cmyk)
+			alpha /= 255.0
+			cPlate.Pix[x] = inkToGray(c * alpha)
+			mPlate.Pix[x] = inkToGray(mg * alpha)
+			yPlate.Pix[x] = inkToGray(y * alpha)
+			kPlate.Pix[x] = inkToGray(k * alpha)
+		}
+	})
+	if err != nil {
+		return nil, nil, nil, nil, err
+	}
+	return cPlate, mPlate, yPlate, kPlate, nil
+}
+
+// inkToGray converts an ink coverage (0 to 1) to a gray value where 0 is full coverage
+func inkToGray(coverage float64) uint8 {
+	return uint8(255.0 - clamp01(coverage)*255.0 + 0.5)
+}
+
+// CombineCMYK combines four grayscale plates, like the ones from SeparateCMYK, into a single
+// *image.CMYK, where black in a plate is full ink coverage and white is no ink.
+// An error is returned if the plates do not all have the same size.
+func CombineCMYK(cPlate, mPlate, yPlate, kPlate image.Image) (*image.CMYK, error) {
+	var (
+		rect   = cPlate.Bounds()
+		plates = []image.Image{cPlate, mPlate, yPlate, kPlate}
+	)
+	for _, plate := range plates[1:] {
+		if plate.Bounds().Size() != rect.Size() {
+			return nil, fmt.Errorf("the plates have different sizes: %v and %v", rect.Size(), plate.Bounds().Size())
+		}
+	}
+	result := image.NewCMYK(image.Rect(0, 0, rect.Dx(), rect.Dy()))
+	for i, plate := range plates {
+		min := plate.Bounds().Min
+		for y := 0; y < rect.Dy(); y++ {
+			offset := result.PixOffset(0, y) + i
+			for x := 0; x < rect.Dx(); x, offset = x+1, offset+4 {
+				gray := color.GrayModel.Convert(plate.At(min.X+x, min.Y+y)).(color.Gray)
+				result.Pix[offset] = 255 - gray.Y
+			}
+		}
+	}
+	return result, nil
+}
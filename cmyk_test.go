@@ -0,0 +1,89 @@
+package plates
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"testing"
+)
+
+func TestRGBToCMYK(t *testing.T) {
+	opts := CMYKOptions{GCR: 1.0}
+	c, m, y, k := RGBToCMYK(0, 0, 0, opts)
+	if c != 0 || m != 0 || y != 0 || k != 1 {
+		t.Errorf("Expected (0, 0, 0, 1) for black, got (%f, %f, %f, %f)", c, m, y, k)
+	}
+	c, m, y, k = RGBToCMYK(1, 0, 0, opts)
+	if c != 0 || m != 1 || y != 1 || k != 0 {
+		t.Errorf("Expected (0, 1, 1, 0) for red, got (%f, %f, %f, %f)", c, m, y, k)
+	}
+	c, m, y, k = RGBToCMYK(0.5, 0.5, 0.5, CMYKOptions{GCR: 0})
+	if c != 0.5 || m != 0.5 || y != 0.5 || k != 0 {
+		t.Errorf("Expected (0.5, 0.5, 0.5, 0) without GCR, got (%f, %f, %f, %f)", c, m, y, k)
+	}
+}
+
+func TestRGBToCMYKInkLimit(t *testing.T) {
+	// A dark brown that needs a lot of ink
+	c, m, y, k := RGBToCMYK(0.2, 0.1, 0.05, CMYKOptions{GCR: 0.5, TotalInkLimit: 2.5})
+	if total := c + m + y + k; total > 2.5+1e-9 {
+		t.Errorf("Expected at most 250%% ink, got %f", total*100)
+	}
+	// Black alone is over a limit below 100%
+	c, m, y, k = RGBToCMYK(0, 0, 0, CMYKOptions{GCR: 1, TotalInkLimit: 0.8})
+	if c != 0 || m != 0 || y != 0 || k != 0.8 {
+		t.Errorf("Expected (0, 0, 0, 0.8) for black with an ink limit of 80%%, got (%f, %f, %f, %f)", c, m, y, k)
+	}
+	c, m, y, k = RGBToCMYK(0.2, 0.1, 0.05, CMYKOptions{GCR: 0.5, TotalInkLimit: 0.5})
+	if total := c + m + y + k; total > 0.5+1e-9 {
+		t.Errorf("Expected at most 50%% ink, got %f", total*100)
+	}
+}
+
+func TestRGBToCMYKUCR(t *testing.T) {
+	// A fully saturated color gets no black ink with UCR
+	_, _, _, k := RGBToCMYK(0.8, 0, 0, CMYKOptions{GCR: 1.0, UCR: true})
+	if k != 0 {
+		t.Errorf("Expected no black ink for a saturated color, got %f", k)
+	}
+	// A neutral gray gets all the black ink
+	c, _, _, k := RGBToCMYK(0.4, 0.4, 0.4, CMYKOptions{GCR: 1.0, UCR: true})
+	if c != 0 || math.Abs(k-0.6) > 1e-9 {
+		t.Errorf("Expected only black ink for gray, got c=%f k=%f", c, k)
+	}
+}
+
+func TestSeparateCMYK(t *testing.T) {
+	img := image.NewRGBA(image.Rect(10, 10, 13, 11))
+	img.Set(10, 10, color.RGBA{0, 255, 255, 255})
+	img.Set(11, 10, color.RGBA{0, 0, 0, 255})
+	img.Set(12, 10, color.RGBA{0, 0, 0, 0})
+	cPlate, mPlate, yPlate, kPlate := SeparateCMYK(img)
+	if cPlate.Bounds() != image.Rect(0, 0, 3, 1) {
+		t.Fatalf("Unexpected bounds: %v", cPlate.Bounds())
+	}
+	gray := func(m image.Image, x int) uint8 {
+		return color.GrayModel.Convert(m.At(x, 0)).(color.Gray).Y
+	}
+	// Cyan only needs the cyan plate
+	if gray(cPlate, 0) != 0 || gray(mPlate, 0) != 255 || gray(yPlate, 0) != 255 || gray(kPlate, 0) != 255 {
+		t.Errorf("Unexpected plates for cyan: %d %d %d %d", gray(cPlate, 0), gray(mPlate, 0), gray(yPlate, 0), gray(kPlate, 0))
+	}
+	// Black only needs the black plate
+	if gray(cPlate, 1) != 255 || gray(kPlate, 1) != 0 {
+		t.Errorf("Unexpected plates for black: c=%d k=%d", gray(cPlate, 1), gray(kPlate, 1))
+	}
+	// Transparent pixels get no ink
+	if gray(kPlate, 2) != 255 {
+		t.Errorf("Expected no ink for a transparent pixel, got %d", gray(kPlate, 2))
+	}
+	// Without gray component replacement, black is printed with cyan, magenta and yellow
+	cPlate, _, _, kPlate = SeparateCMYK(img, GCR(0), TotalInkLimit(0))
+	if gray(cPlate, 1) != 0 || gray(kPlate, 1) != 255 {
+		t.Errorf("Unexpected plates for black without GCR: c=%d k=%d", gray(cPlate, 1), gray(kPlate, 1))
+	}
+	// The black ink is limited by the total ink limit
+	if _, _, _, kPlate = SeparateCMYK(img, TotalInkLimit(0.5)); gray(kPlate, 1) != 128 {
+		t.Errorf("Expected 50%% black ink for black, got %d", gray(kPlate, 1))
+	}
+}
@@ -2,6 +2,7 @@
 package plates
 
 import (
+	"context"
 	"image"
 	"image/color"
 	"math"
@@ -9,160 +10,239 @@ import (
 
 // Red function isolates and returns the red channel from an image.
 // It returns a new image where only the red component of each pixel's color is retained.
-func Red(m image.Image) image.Image {
-	var (
-		rect     = m.Bounds()
-		c        color.Color
-		cr       color.RGBA
-		newImage = image.NewRGBA(image.Rect(0, 0, rect.Max.X-rect.Min.X, rect.Max.Y-rect.Min.Y))
-	)
-	for y := rect.Min.Y; y < rect.Max.Y; y++ {
-		for x := rect.Min.X; x < rect.Max.X; x++ {
-			c = m.At(x, y)      // c is RGBAColor, which implements Color
-			cr = c.(color.RGBA) // this is needed
-			c = color.RGBA{cr.R, 0, 0, cr.A}
-			newImage.Set(x-rect.Min.X, y-rect.Min.Y, c)
-		}
-	}
-	return newImage
+// Like the other image functions, it returns an *image.RGBA64 for images with 16 bits per channel
+// (*image.Gray16, *image.RGBA64 and *image.NRGBA64), and an *image.RGBA for other images.
+func Red(m image.Image, opts ...Option) image.Image {
+	return channel(m, opts, 0)
 }
 
 // Green function isolates and returns the green channel from an image.
 // It returns a new image where only the green component of each pixel's color is retained.
-func Green(m image.Image) image.Image {
-	var (
-		rect     = m.Bounds()
-		c        color.Color
-		cr       color.RGBA
-		newImage = image.NewRGBA(image.Rect(0, 0, rect.Max.X-rect.Min.X, rect.Max.Y-rect.Min.Y))
-	)
-	for y := rect.Min.Y; y < rect.Max.Y; y++ {
-		for x := rect.Min.X; x < rect.Max.X; x++ {
-			c = m.At(x, y)      // c is RGBAColor, which implements Color
-			cr = c.(color.RGBA) // this is needed
-			c = color.RGBA{0, cr.G, 0, cr.A}
-			newImage.Set(x-rect.Min.X, y-rect.Min.Y, c)
-		}
-	}
-	return newImage
+func Green(m image.Image, opts ...Option) image.Image {
+	return channel(m, opts, 1)
 }
 
 // Blue function isolates and returns the blue channel from an image.
 // It returns a new image where only the blue component of each pixel's color is retained.
-func Blue(m image.Image) image.Image {
+func Blue(m image.Image, opts ...Option) image.Image {
+	return channel(m, opts, 2)
+}
+
+// channel returns a new image where only the given color channel
+// (0 for red, 1 for green and 2 for blue) and the alpha channel are retained.
+func channel(m image.Image, opts []Option, keep int) image.Image {
+	if is16Bit(m) {
+		return channel64(m, opts, keep)
+	}
 	var (
 		rect     = m.Bounds()
-		c        color.Color
-		cr       color.RGBA
+		read     = newRowReader(m, rect)
 		newImage = image.NewRGBA(image.Rect(0, 0, rect.Max.X-rect.Min.X, rect.Max.Y-rect.Min.Y))
 	)
-	for y := rect.Min.Y; y < rect.Max.Y; y++ {
-		for x := rect.Min.X; x < rect.Max.X; x++ {
-			c = m.At(x, y)      // c is RGBAColor, which implements Color
-			cr = c.(color.RGBA) // this is needed
-			c = color.RGBA{0, 0, cr.B, cr.A}
-			newImage.Set(x-rect.Min.X, y-rect.Min.Y, c)
+	eachRow(context.Background(), newConfig(opts), rect, 0, func(y int, _ []uint8) {
+		row := rowOf(newImage, y-rect.Min.Y)
+		read(y, row)
+		for i := 0; i < len(row); i += 4 {
+			for j := 0; j < 3; j++ {
+				if j != keep {
+					row[i+j] = 0
+				}
+			}
 		}
-	}
+	})
 	return newImage
 }
 
 // CloseTo1 function isolates pixels in an image that are similar to a target color within a given threshold.
 // It returns a new image where only the pixels close to the target color are retained.
 // Pixels that do not meet the threshold will be set to black (RGB{0,0,0}).
-func CloseTo1(m image.Image, target color.RGBA, threshold uint8) image.Image {
+func CloseTo1(m image.Image, target color.RGBA, threshold uint8, opts ...Option) image.Image {
+	newImage, _ := CloseTo1Context(context.Background(), m, target, threshold, opts...)
+	return newImage
+}
+
+// CloseTo1Context is like CloseTo1, but stops and returns the error from ctx if ctx is done
+// before all rows have been processed.
+func CloseTo1Context(ctx context.Context, m image.Image, target color.RGBA, threshold uint8, opts ...Option) (image.Image, error) {
+	if is16Bit(m) {
+		return closeTo64(ctx, m, target, threshold, false, opts)
+	}
 	var (
-		rect       = m.Bounds()
-		c          color.Color
-		cr         color.RGBA
-		r, g, b, a uint8
-		newImage   = image.NewRGBA(image.Rect(0, 0, rect.Max.X-rect.Min.X, rect.Max.Y-rect.Min.Y))
+		rect     = m.Bounds()
+		read     = newRowReader(m, rect)
+		newImage = image.NewRGBA(image.Rect(0, 0, rect.Max.X-rect.Min.X, rect.Max.Y-rect.Min.Y))
 	)
-	for y := rect.Min.Y; y < rect.Max.Y; y++ {
-		for x := rect.Min.X; x < rect.Max.X; x++ {
-			c = m.At(x, y)      // c is RGBAColor, which implements Color
-			cr = c.(color.RGBA) // this is needed
-			r = 0
-			g = 0
-			b = 0
-			a = cr.A
-			if abs(int8(target.R)-int8(cr.R)) < threshold {
+	err := eachRow(ctx, newConfig(opts), rect, 0, func(y int, _ []uint8) {
+		row := rowOf(newImage, y-rect.Min.Y)
+		read(y, row)
+		for i := 0; i < len(row); i += 4 {
+			r, g, b := uint8(0), uint8(0), uint8(0)
+			if absdiff(target.R, row[i]) < threshold {
 				r = target.R
 			}
-			if abs(int8(target.G)-int8(cr.G)) < threshold {
+			if absdiff(target.G, row[i+1]) < threshold {
 				g = target.G
 			}
-			if abs(int8(target.B)-int8(cr.B)) < threshold {
+			if absdiff(target.B, row[i+2]) < threshold {
 				b = target.B
 			}
-			c = color.RGBA{r, g, b, a}
-			newImage.Set(x-rect.Min.X, y-rect.Min.Y, c)
+			row[i], row[i+1], row[i+2] = r, g, b
 		}
+	})
+	if err != nil {
+		return nil, err
 	}
-	return newImage
+	return newImage, nil
 }
 
 // CloseTo2 will pick out only the colors close to the given color,
 // within a given threshold. Make it uniform.
 // Zero alpha to unused pixels in returned image.
-func CloseTo2(m image.Image, target color.RGBA, threshold uint8) image.Image {
+func CloseTo2(m image.Image, target color.RGBA, threshold uint8, opts ...Option) image.Image {
+	newImage, _ := CloseTo2Context(context.Background(), m, target, threshold, opts...)
+	return newImage
+}
+
+// CloseTo2Context is like CloseTo2, but stops and returns the error from ctx if ctx is done
+// before all rows have been processed.
+func CloseTo2Context(ctx context.Context, m image.Image, target color.RGBA, threshold uint8, opts ...Option) (image.Image, error) {
+	if is16Bit(m) {
+		return closeTo64(ctx, m, target, threshold, true, opts)
+	}
 	var (
-		rect       = m.Bounds()
-		c          color.Color
-		cr         color.RGBA
-		r, g, b, a uint8
-		newImage   = image.NewRGBA(image.Rect(0, 0, rect.Max.X-rect.Min.X, rect.Max.Y-rect.Min.Y))
+		rect     = m.Bounds()
+		read     = newRowReader(m, rect)
+		newImage = image.NewRGBA(image.Rect(0, 0, rect.Max.X-rect.Min.X, rect.Max.Y-rect.Min.Y))
 	)
-	for y := rect.Min.Y; y < rect.Max.Y; y++ {
-		for x := rect.Min.X; x < rect.Max.X; x++ {
-			c = m.At(x, y)      // c is RGBAColor, which implements Color
-			cr = c.(color.RGBA) // this is needed
-			r = 0
-			g = 0
-			b = 0
-			a = 0
-			if abs(int8(target.R)-int8(cr.R)) < threshold || abs(int8(target.G)-int8(cr.G)) < threshold || abs(int8(target.B)-int8(cr.B)) < threshold {
-				r = target.R
-				g = target.G
-				b = target.B
-				a = cr.A
+	err := eachRow(ctx, newConfig(opts), rect, 0, func(y int, _ []uint8) {
+		row := rowOf(newImage, y-rect.Min.Y)
+		read(y, row)
+		for i := 0; i < len(row); i += 4 {
+			if absdiff(target.R, row[i]) < threshold || absdiff(target.G, row[i+1]) < threshold || absdiff(target.B, row[i+2]) < threshold {
+				row[i], row[i+1], row[i+2] = target.R, target.G, target.B
+			} else {
+				row[i], row[i+1], row[i+2], row[i+3] = 0, 0, 0, 0
+			}
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return newImage, nil
+}
+
+// CloseTo1Distance is like CloseTo1, but measures how close each pixel is
+// to the target color with the given Distance instead of per channel.
+// Pixels within the threshold are set to the target color, while the
+// other pixels are set to black. The alpha of each pixel is kept.
+func CloseTo1Distance(m image.Image, target color.RGBA, distance Distance, threshold float64, opts ...Option) image.Image {
+	newImage, _ := CloseTo1DistanceContext(context.Background(), m, target, distance, threshold, opts...)
+	return newImage
+}
+
+// CloseTo1DistanceContext is like CloseTo1Distance, but stops and returns the error from ctx if ctx is done
+// before all rows have been processed.
+func CloseTo1DistanceContext(ctx context.Context, m image.Image, target color.RGBA, distance Distance, threshold float64, opts ...Option) (image.Image, error) {
+	distance = newConfig(opts).distance(distance)
+	if is16Bit(m) {
+		return closeToDistance64(ctx, m, target, distance, threshold, false, opts)
+	}
+	var (
+		rect     = m.Bounds()
+		read     = newRowReader(m, rect)
+		newImage = image.NewRGBA(image.Rect(0, 0, rect.Max.X-rect.Min.X, rect.Max.Y-rect.Min.Y))
+	)
+	err := eachRow(ctx, newConfig(opts), rect, 0, func(y int, _ []uint8) {
+		row := rowOf(newImage, y-rect.Min.Y)
+		read(y, row)
+		for i := 0; i < len(row); i += 4 {
+			if distance.Distance(target, color.RGBA{row[i], row[i+1], row[i+2], row[i+3]}) < threshold {
+				row[i], row[i+1], row[i+2] = target.R, target.G, target.B
+			} else {
+				row[i], row[i+1], row[i+2] = 0, 0, 0
 			}
-			c = color.RGBA{r, g, b, a}
-			newImage.Set(x-rect.Min.X, y-rect.Min.Y, c)
 		}
+	})
+	if err != nil {
+		return nil, err
 	}
+	return newImage, nil
+}
+
+// CloseTo2Distance is like CloseTo2, but measures how close each pixel is
+// to the target color with the given Distance instead of per channel.
+// Pixels within the threshold are set to the target color,
+// and the other pixels are left transparent.
+func CloseTo2Distance(m image.Image, target color.RGBA, distance Distance, threshold float64, opts ...Option) image.Image {
+	newImage, _ := CloseTo2DistanceContext(context.Background(), m, target, distance, threshold, opts...)
 	return newImage
 }
 
+// CloseTo2DistanceContext is like CloseTo2Distance, but stops and returns the error from ctx if ctx is done
+// before all rows have been processed.
+func CloseTo2DistanceContext(ctx context.Context, m image.Image, target color.RGBA, distance Distance, threshold float64, opts ...Option) (image.Image, error) {
+	distance = newConfig(opts).distance(distance)
+	if is16Bit(m) {
+		return closeToDistance64(ctx, m, target, distance, threshold, true, opts)
+	}
+	var (
+		rect     = m.Bounds()
+		read     = newRowReader(m, rect)
+		newImage = image.NewRGBA(image.Rect(0, 0, rect.Max.X-rect.Min.X, rect.Max.Y-rect.Min.Y))
+	)
+	err := eachRow(ctx, newConfig(opts), rect, 0, func(y int, _ []uint8) {
+		row := rowOf(newImage, y-rect.Min.Y)
+		read(y, row)
+		for i := 0; i < len(row); i += 4 {
+			if distance.Distance(target, color.RGBA{row[i], row[i+1], row[i+2], row[i+3]}) < threshold {
+				row[i], row[i+1], row[i+2] = target.R, target.G, target.B
+			} else {
+				row[i], row[i+1], row[i+2], row[i+3] = 0, 0, 0, 0
+			}
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return newImage, nil
+}
+
 // AddToAs will take an image, add the nontransparent colors from addimage,
 // use addcolor and return an image.
-func AddToAs(orig image.Image, addimage image.Image, addcolor color.RGBA) image.Image {
+// The returned image has the size of addimage. Where orig does not cover
+// addimage, orig is treated as being transparent.
+// The returned image is an *image.RGBA64 if either image has 16 bits per channel.
+func AddToAs(orig image.Image, addimage image.Image, addcolor color.RGBA, opts ...Option) image.Image {
+	newImage, _ := AddToAsContext(context.Background(), orig, addimage, addcolor, opts...)
+	return newImage
+}
+
+// AddToAsContext is like AddToAs, but stops and returns the error from ctx if ctx is done
+// before all rows have been processed.
+func AddToAsContext(ctx context.Context, orig image.Image, addimage image.Image, addcolor color.RGBA, opts ...Option) (image.Image, error) {
+	if is16Bit(orig) || is16Bit(addimage) {
+		return addToAs64(ctx, orig, addimage, addcolor, opts)
+	}
 	var (
-		rect       = addimage.Bounds()
-		c          color.Color
-		cr, or     color.RGBA
-		r, g, b, a uint8
-		newImage   = image.NewRGBA(image.Rect(0, 0, rect.Max.X-rect.Min.X, rect.Max.Y-rect.Min.Y))
+		rect     = addimage.Bounds()
+		readOrig = newRowReader(orig, rect)
+		readAdd  = newRowReader(addimage, rect)
+		newImage = image.NewRGBA(image.Rect(0, 0, rect.Max.X-rect.Min.X, rect.Max.Y-rect.Min.Y))
 	)
-	for y := rect.Min.Y; y < rect.Max.Y; y++ {
-		for x := rect.Min.X; x < rect.Max.X; x++ {
-			cr = addimage.At(x, y).(color.RGBA)
-			or = orig.At(x, y).(color.RGBA)
-			r = or.R
-			g = or.G
-			b = or.B
-			a = or.A
-			if cr.A > 0 {
-				r = addcolor.R
-				g = addcolor.G
-				b = addcolor.B
-				a = addcolor.A
+	err := eachRow(ctx, newConfig(opts), rect, 4*rect.Dx(), func(y int, add []uint8) {
+		row := rowOf(newImage, y-rect.Min.Y)
+		readOrig(y, row)
+		readAdd(y, add)
+		for i := 0; i < len(row); i += 4 {
+			if add[i+3] > 0 {
+				row[i], row[i+1], row[i+2], row[i+3] = addcolor.R, addcolor.G, addcolor.B, addcolor.A
 			}
-			c = color.RGBA{r, g, b, a}
-			newImage.Set(x-rect.Min.X, y-rect.Min.Y, c)
 		}
+	})
+	if err != nil {
+		return nil, err
 	}
-	return newImage
+	return newImage, nil
 }
 
 // Hue will convert an RGB color to a Hue float
@@ -191,92 +271,80 @@ func Hue(cr color.RGBA) float64 {
 	return h
 }
 
-// HSV will convert an RGB color to huse, saturation and value
+// HSV will convert an RGB color to hue, saturation and value, all from 0 to 255.
+// The hue goes around the color circle, where 0 is red, 85 is green and 171 is blue.
+// HSVModel converts to an HSVColor instead, with the hue in degrees and the rest from 0 to 1.
 func HSV(cr color.RGBA) (uint8, uint8, uint8) {
-	var hue, sat, val uint8
-	RGBmin := min(cr.R, cr.G, cr.B)
-	RGBmax := max(cr.R, cr.G, cr.B)
-
-	val = RGBmax
-	if val == 0 {
-		hue = 0
-		sat = 0
-		return hue, sat, val
-	}
+	h, s, v := RGBtoHSV(float64(cr.R)/255.0, float64(cr.G)/255.0, float64(cr.B)/255.0)
+	return uint8(int(h*256.0+0.5) % 256), uint8(s*255.0 + 0.5), uint8(v*255.0 + 0.5)
+}
 
-	sat = 255 * (RGBmax - RGBmin) / val
-	if sat == 0 {
-		hue = 0
-		return hue, sat, val
-	}
+// HSV64 is like HSV, but for 16-bit colors, with hue, saturation and value from 0 to 65535
+func HSV64(cr color.RGBA64) (uint16, uint16, uint16) {
+	h, s, v := RGBtoHSV(float64(cr.R)/65535.0, float64(cr.G)/65535.0, float64(cr.B)/65535.0)
+	return uint16(int(h*65536.0+0.5) % 65536), uint16(s*65535.0 + 0.5), uint16(v*65535.0 + 0.5)
+}
 
-	span := (RGBmax - RGBmin)
-	if RGBmax == cr.R {
-		hue = 43 * (cr.G - cr.B) / span
-	} else if RGBmax == cr.G {
-		hue = 85 + 43*(cr.B-cr.R)/span
-	} else { /* RGBmax == cr.B */
-		hue = 171 + 43*(cr.R-cr.G)/span
+// RGBtoHSV will convert red, green and blue (0 to 1) to hue, saturation and value (0 to 1),
+// where a hue of 0 is red, 1/3 is green and 2/3 is blue
+func RGBtoHSV(r, g, b float64) (float64, float64, float64) {
+	h, maxc, minc := rgbFloat{r, g, b}.hue()
+	var s float64
+	if maxc > 0 {
+		s = (maxc - minc) / maxc
 	}
+	return h / 360.0, s, maxc
+}
 
-	return hue, sat, val
+// HSVtoRGB will convert a HSV color to red, green, blue, which is the inverse of RGBtoHSV
+func HSVtoRGB(h, s, v float64) (float64, float64, float64) {
+	chroma := v * s
+	c := hueToFloat(h*360.0, chroma, v-chroma)
+	return c[0], c[1], c[2]
 }
 
 // Separate3 an image into three images with the three given colors and a given threshold.
-func Separate3(inImage image.Image, color1, color2, color3 color.RGBA, threshold uint8) (image.Image, image.Image, image.Image) {
-	var (
-		rect       = inImage.Bounds()
-		cr         color.RGBA
-		r, g, b, a uint8
-		h, s       float64
-		newImage1  = image.NewRGBA(image.Rect(0, 0, rect.Max.X-rect.Min.X, rect.Max.Y-rect.Min.Y))
-		newImage2  = image.NewRGBA(image.Rect(0, 0, rect.Max.X-rect.Min.X, rect.Max.Y-rect.Min.Y))
-		newImage3  = image.NewRGBA(image.Rect(0, 0, rect.Max.X-rect.Min.X, rect.Max.Y-rect.Min.Y))
-	)
-	hue1, _, s1 := HLS(float64(color1.R)/255.0, float64(color1.G)/255.0, float64(color1.B)/255.0)
-	hue2, _, s2 := HLS(float64(color2.R)/255.0, float64(color2.G)/255.0, float64(color2.B)/255.0)
-	hue3, _, s3 := HLS(float64(color3.R)/255.0, float64(color3.G)/255.0, float64(color3.B)/255.0)
-	for y := rect.Min.Y; y < rect.Max.Y; y++ {
-		for x := rect.Min.X; x < rect.Max.X; x++ {
-			// get the rgba color
-			// cr = inImage.At(x, y).(image.RGBAColor)
-			cr = color.RGBAModel.Convert(inImage.At(x, y)).(color.RGBA)
-			a = 255
-			h, _, s = HLS(float64(cr.R)/255.0, float64(cr.G)/255.0, float64(cr.B)/255.0)
-			// Find the closest color of the three, measured in hue and saturation
-			if ((fabs(h-hue1) < fabs(h-hue2)) && (fabs(h-hue1) < fabs(h-hue3))) ||
-				((fabs(s-s1) < fabs(s-s2)) && (fabs(s-s1) < fabs(s-s3))) {
-				// Only add if the color is close enough
-				if abs(int8(color1.R)-int8(cr.R)) < threshold || abs(int8(color1.G)-int8(cr.G)) < threshold || abs(int8(color1.B)-int8(cr.B)) < threshold {
-					r = color1.R
-					g = color1.G
-					b = color1.B
-					newImage1.Set(x-rect.Min.X, y-rect.Min.Y, color.RGBA{r, g, b, a})
-				}
-			} else if ((fabs(h-hue2) < fabs(h-hue1)) && (fabs(h-hue2) < fabs(h-hue3))) ||
-				((fabs(s-s2) < fabs(s-s1)) && (fabs(s-s2) < fabs(s-s3))) {
-				// Only add if the color is close enough
-				if abs(int8(color2.R)-int8(cr.R)) < threshold || abs(int8(color2.G)-int8(cr.G)) < threshold || abs(int8(color2.B)-int8(cr.B)) < threshold {
-					r = color2.R
-					g = color2.G
-					b = color2.B
-					newImage2.Set(x-rect.Min.X, y-rect.Min.Y, color.RGBA{r, g, b, a})
-				}
-			} else if ((fabs(h-hue3) < fabs(h-hue1)) && (fabs(h-hue3) < fabs(h-hue2))) ||
-				((fabs(s-s3) < fabs(s-s1)) && (fabs(s-s3) < fabs(s-s2))) {
-				if abs(int8(color3.R)-int8(cr.R)) < threshold || abs(int8(color3.G)-int8(cr.G)) < threshold || abs(int8(color3.B)-int8(cr.B)) < threshold {
-					r = color3.R
-					g = color3.G
-					b = color3.B
-					newImage3.Set(x-rect.Min.X, y-rect.Min.Y, color.RGBA{r, g, b, a})
-				}
-			}
-		}
+// Each pixel is added to the image for the color that it is perceptually nearest to.
+// The threshold is scaled to the distance threshold of SeparateN, where 255
+// lets every pixel through and lower values leave pixels that are far from
+// all three colors out.
+func Separate3(inImage image.Image, color1, color2, color3 color.RGBA, threshold uint8, opts ...Option) (image.Image, image.Image, image.Image) {
+	img1, img2, img3, _ := Separate3Context(context.Background(), inImage, color1, color2, color3, threshold, opts...)
+	return img1, img2, img3
+}
+
+// Separate3Context is like Separate3, but stops and returns the error from ctx if ctx is done
+// before all rows have been processed.
+func Separate3Context(ctx context.Context, inImage image.Image, color1, color2, color3 color.RGBA, threshold uint8, opts ...Option) (image.Image, image.Image, image.Image, error) {
+	opts = append(opts[:len(opts):len(opts)], Threshold(float64(int(threshold)+1)/256.0))
+	plates, err := SeparateNContext(ctx, inImage, []color.RGBA{color1, color2, color3}, opts...)
+	if err != nil {
+		return nil, nil, nil, err
 	}
-	return newImage1, newImage2, newImage3
+	return plates[0], plates[1], plates[2], nil
+}
+
+// Separate3Distance is like Separate3, but uses the given Distance for finding
+// the nearest of the three colors. Pixels that are further away than the
+// threshold from all three colors are left out. A threshold of 0 disables it.
+func Separate3Distance(inImage image.Image, color1, color2, color3 color.RGBA, distance Distance, threshold float64, opts ...Option) (image.Image, image.Image, image.Image) {
+	img1, img2, img3, _ := Separate3DistanceContext(context.Background(), inImage, color1, color2, color3, distance, threshold, opts...)
+	return img1, img2, img3
+}
+
+// Separate3DistanceContext is like Separate3Distance, but stops and returns the error from ctx
+// if ctx is done before all rows have been processed.
+func Separate3DistanceContext(ctx context.Context, inImage image.Image, color1, color2, color3 color.RGBA, distance Distance, threshold float64, opts ...Option) (image.Image, image.Image, image.Image, error) {
+	opts = append(opts[:len(opts):len(opts)], Threshold(threshold), Metric(distance))
+	plates, err := SeparateNContext(ctx, inImage, []color.RGBA{color1, color2, color3}, opts...)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return plates[0], plates[1], plates[2], nil
 }
 
 // HLS will convert an RGB color to hue, lightness and saturation
+// HSLModel converts to an HSLColor instead, with the hue in degrees and the rest from 0 to 1.
 func HLS(r, g, b float64) (float64, float64, float64) {
 	// Ported from Python colorsys
 	var h, l, s float64
@@ -345,8 +413,10 @@ func HLStoRGB(h, l, s float64) (float64, float64, float64) {
 	return computeColorChannel(m1, m2, h+oneThird), computeColorChannel(m1, m2, h), computeColorChannel(m1, m2, h-oneThird)
 }
 
-// PaintMix will attempt to mix two RGB colors, a bit like how paint mixes (but not exactly like it)
-func PaintMix(c1, c2 color.RGBA) color.RGBA {
+// PaintMix will attempt to mix two RGB colors, a bit like how paint mixes (but not exactly like it).
+// With the LinearLight option, the lightness and saturation are averaged in linear light.
+// MixPigments gives more realistic mixes, by modelling how pigments absorb and scatter light.
+func PaintMix(c1, c2 color.RGBA, opts ...Option) color.RGBA {
 
 	/*
 	 * The less pi-precision, the greener the mix between blue and yellow.
@@ -357,9 +427,17 @@ func PaintMix(c1, c2 color.RGBA) color.RGBA {
 	//const twoPi = 2.0 * 3.1415
 	//const twoPi = 2.0 * 3.141592653589793
 
+	linear := newConfig(opts).linear
+	hls := func(c color.RGBA) (float64, float64, float64) {
+		if linear {
+			return HLS(LinearRGB(c))
+		}
+		return HLS(float64(c.R)/255.0, float64(c.G)/255.0, float64(c.B)/255.0)
+	}
+
 	// Thanks to Mark Ransom
-	h1, l1, s1 := HLS(float64(c1.R)/255.0, float64(c1.G)/255.0, float64(c1.B)/255.0)
-	h2, l2, s2 := HLS(float64(c2.R)/255.0, float64(c2.G)/255.0, float64(c2.B)/255.0)
+	h1, l1, s1 := hls(c1)
+	h2, l2, s2 := hls(c2)
 	h := 0.0
 	s := 0.5 * (s1 + s2)
 	l := 0.5 * (l1 + l2)
@@ -372,5 +450,8 @@ func PaintMix(c1, c2 color.RGBA) color.RGBA {
 	}
 
 	r, g, b := HLStoRGB(h, l, s)
+	if linear {
+		return LinearToRGBA(r, g, b, 255)
+	}
 	return color.RGBA{uint8(r * 255.0), uint8(g * 255.0), uint8(b * 255.0), 255}
 }
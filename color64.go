@@ -0,0 +1,250 @@
+package plates
+
+import (
+	"context"
+	"image"
+	"image/color"
+	"math"
+)
+
+// The functions in this file are the 16-bit versions of the image functions in color.go,
+// separate.go and cmyk.go, which are used when is16Bit is true for the source image.
+// Rows are read with newRowReader64 straight into the Pix of the new *image.RGBA64.
+
+// absdiff16 returns the absolute difference between two 16-bit values
+func absdiff16(a, b uint16) uint32 {
+	if a > b {
+		return uint32(a - b)
+	}
+	return uint32(b - a)
+}
+
+// newRGBA64Like returns a new *image.RGBA64 with the size of rect, starting at (0, 0)
+func newRGBA64Like(rect image.Rectangle) *image.RGBA64 {
+	return image.NewRGBA64(image.Rect(0, 0, rect.Dx(), rect.Dy()))
+}
+
+// channel64 is the 16-bit version of channel
+func channel64(m image.Image, opts []Option, keep int) image.Image {
+	var (
+		rect     = m.Bounds()
+		read     = newRowReader64(m, rect)
+		newImage = newRGBA64Like(rect)
+	)
+	eachRow(context.Background(), newConfig(opts), rect, 0, func(y int, _ []uint8) {
+		row := rowOf64(newImage, y-rect.Min.Y)
+		read(y, row)
+		for i := 0; i < len(row); i += 8 {
+			for j := 0; j < 3; j++ {
+				if j != keep {
+					row[i+2*j], row[i+2*j+1] = 0, 0
+				}
+			}
+		}
+	})
+	return newImage
+}
+
+// closeTo64 is the 16-bit version of CloseTo1Context and CloseTo2Context, where uniform is true for CloseTo2
+func closeTo64(ctx context.Context, m image.Image, target color.RGBA, threshold uint8, uniform bool, opts []Option) (image.Image, error) {
+	var (
+		rect     = m.Bounds()
+		read     = newRowReader64(m, rect)
+		newImage = newRGBA64Like(rect)
+		t        = to64(target)
+		limit    = uint32(threshold) * 0x101
+	)
+	err := eachRow(ctx, newConfig(opts), rect, 0, func(y int, _ []uint8) {
+		row := rowOf64(newImage, y-rect.Min.Y)
+		read(y, row)
+		for i := 0; i < len(row); i += 8 {
+			c := get64(row[i:])
+			closeR, closeG, closeB := absdiff16(t.R, c.R) < limit, absdiff16(t.G, c.G) < limit, absdiff16(t.B, c.B) < limit
+			switch {
+			case uniform && (closeR || closeG || closeB):
+				c.R, c.G, c.B = t.R, t.G, t.B
+			case uniform:
+				c = color.RGBA64{}
+			default:
+				r, g, b := uint16(0), uint16(0), uint16(0)
+				if closeR {
+					r = t.R
+				}
+				if closeG {
+					g = t.G
+				}
+				if closeB {
+					b = t.B
+				}
+				c.R, c.G, c.B = r, g, b
+			}
+			put64(row[i:], c)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return newImage, nil
+}
+
+// closeToDistance64 is the 16-bit version of CloseTo1DistanceContext and CloseTo2DistanceContext,
+// where transparent is true for CloseTo2Distance
+func closeToDistance64(ctx context.Context, m image.Image, target color.RGBA, distance Distance, threshold float64, transparent bool, opts []Option) (image.Image, error) {
+	var (
+		rect     = m.Bounds()
+		read     = newRowReader64(m, rect)
+		newImage = newRGBA64Like(rect)
+		t        = to64(target)
+	)
+	err := eachRow(ctx, newConfig(opts), rect, 0, func(y int, _ []uint8) {
+		row := rowOf64(newImage, y-rect.Min.Y)
+		read(y, row)
+		for i := 0; i < len(row); i += 8 {
+			c := get64(row[i:])
+			switch {
+			case distance64(distance, t, c) < threshold:
+				c.R, c.G, c.B = t.R, t.G, t.B
+			case transparent:
+				c = color.RGBA64{}
+			default:
+				c.R, c.G, c.B = 0, 0, 0
+			}
+			put64(row[i:], c)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return newImage, nil
+}
+
+// addToAs64 is the 16-bit version of AddToAsContext
+func addToAs64(ctx context.Context, orig image.Image, addimage image.Image, addcolor color.RGBA, opts []Option) (image.Image, error) {
+	var (
+		rect     = addimage.Bounds()
+		readOrig = newRowReader64(orig, rect)
+		readAdd  = newRowReader64(addimage, rect)
+		newImage = newRGBA64Like(rect)
+		add      = to64(addcolor)
+	)
+	err := eachRow(ctx, newConfig(opts), rect, 8*rect.Dx(), func(y int, addRow []uint8) {
+		row := rowOf64(newImage, y-rect.Min.Y)
+		readOrig(y, row)
+		readAdd(y, addRow)
+		for i := 0; i < len(row); i += 8 {
+			if addRow[i+6] > 0 || addRow[i+7] > 0 {
+				put64(row[i:], add)
+			}
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return newImage, nil
+}
+
+// separateN64 is the 16-bit version of SeparateNContext
+func separateN64(ctx context.Context, m image.Image, inks []color.RGBA, threshold float64, distance Distance, cfg *config) ([]image.Image, error) {
+	var (
+		rect      = m.Bounds()
+		read      = newRowReader64(m, rect)
+		newImages = make([]*image.RGBA64, len(inks))
+		result    = make([]image.Image, len(inks))
+		inks64    = make([]color.RGBA64, len(inks))
+	)
+	for i := range inks {
+		newImages[i] = newRGBA64Like(rect)
+		result[i] = newImages[i]
+		inks64[i] = to64(inks[i])
+	}
+	if len(inks) == 0 {
+		return result, nil
+	}
+	err := eachRow(ctx, cfg, rect, 8*rect.Dx(), func(y int, row []uint8) {
+		read(y, row)
+		var (
+			prev    color.RGBA64
+			prevInk = -1
+			offset  = newImages[0].PixOffset(0, y-rect.Min.Y)
+			ink     int
+		)
+		for i := 0; i < len(row); i += 8 {
+			c := get64(row[i:])
+			if c.A == 0 {
+				continue
+			}
+			// Neighbouring pixels often have the same color
+			if prevInk < 0 || c != prev {
+				best, d := nearest64(c, inks64, distance)
+				ink = best
+				if threshold > 0 && d > threshold {
+					ink = len(inks)
+				}
+				prev, prevInk = c, ink
+			} else {
+				ink = prevInk
+			}
+			if ink == len(inks) {
+				continue
+			}
+			c = inks64[ink]
+			c.A = 0xffff
+			put64(newImages[ink].Pix[offset+i:], c)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// nearest64 is the 16-bit version of nearest
+func nearest64(c color.RGBA64, inks []color.RGBA64, distance Distance) (int, float64) {
+	best, bestDistance := 0, math.Inf(1)
+	for i, ink := range inks {
+		if d := distance64(distance, ink, c); d < bestDistance {
+			best, bestDistance = i, d
+		}
+	}
+	return best, bestDistance
+}
+
+// separateCMYK64 is the 16-bit version of SeparateCMYKContext, which gives *image.Gray16 plates
+func separateCMYK64(ctx context.Context, m image.Image, cfg *config) (image.Image, image.Image, image.Image, image.Image, error) {
+	var (
+		rect    = m.Bounds()
+		read    = newRowReader64(m, rect)
+		newRect = image.Rect(0, 0, rect.Dx(), rect.Dy())
+		plates  = []*image.Gray16{image.NewGray16(newRect), image.NewGray16(newRect), image.NewGray16(newRect), image.NewGray16(newRect)}
+	)
+	err := eachRow(ctx, cfg, rect, 8*rect.Dx(), func(py int, row []uint8) {
+		read(py, row)
+		offset := plates[0].PixOffset(0, py-rect.Min.Y)
+		for i, x := 0, offset; i < len(row); i, x = i+8, x+2 {
+			c := get64(row[i:])
+			if c.A == 0 {
+				for _, plate := range plates {
+					plate.Pix[x], plate.Pix[x+1] = 0xff, 0xff
+				}
+				continue
+			}
+			// The colors are premultiplied, so dividing by alpha gives the color from 0 to 1
+			alpha := float64(c.A)
+			cyan, magenta, yellow, k := RGBToCMYK(float64(c.R)/alpha, float64(c.G)/alpha, float64(c.B)/alpha, cfg.cmyk)
+			alpha /= 65535.0
+			for j, coverage := range []float64{cyan, magenta, yellow, k} {
+				v := inkToGray16(coverage * alpha)
+				plates[j].Pix[x], plates[j].Pix[x+1] = uint8(v>>8), uint8(v)
+			}
+		}
+	})
+	if err != nil {
+		return nil, nil, nil, nil, err
+	}
+	return plates[0], plates[1], plates[2], plates[3], nil
+}
+
+// inkToGray16 converts an ink coverage (0 to 1) to a 16-bit gray value where 0 is full coverage
+func inkToGray16(coverage float64) uint16 {
+	return uint16(65535.0 - clamp01(coverage)*65535.0 + 0.5)
+}
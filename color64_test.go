@@ -0,0 +1,165 @@
+package plates
+
+import (
+	"image"
+	"image/color"
+	"math/rand"
+	"path/filepath"
+	"testing"
+)
+
+// randomImages64 returns images with 16 bits per channel, filled with random pixels
+func randomImages64(w, h int) map[string]image.Image {
+	var (
+		rng    = rand.New(rand.NewSource(42))
+		rect   = image.Rect(3, 5, 3+w, 5+h)
+		rgba   = image.NewRGBA64(rect)
+		nrgba  = image.NewNRGBA64(rect)
+		gray16 = image.NewGray16(rect)
+	)
+	for y := rect.Min.Y; y < rect.Max.Y; y++ {
+		for x := rect.Min.X; x < rect.Max.X; x++ {
+			c := color.NRGBA64{uint16(rng.Intn(0x10000)), uint16(rng.Intn(0x10000)), uint16(rng.Intn(0x10000)), uint16(rng.Intn(0x10000))}
+			nrgba.SetNRGBA64(x, y, c)
+			rgba.Set(x, y, c)
+			gray16.SetGray16(x, y, color.Gray16{c.R})
+		}
+	}
+	return map[string]image.Image{
+		"RGBA64":   rgba,
+		"NRGBA64":  nrgba,
+		"Gray16":   gray16,
+		"SubImage": rgba.SubImage(image.Rect(4, 6, 2+w, 4+h)),
+	}
+}
+
+func TestRowReader64(t *testing.T) {
+	for name, m := range randomImages64(17, 9) {
+		rect := m.Bounds()
+		for y := rect.Min.Y; y < rect.Max.Y; y++ {
+			fast := make([]uint8, 8*rect.Dx())
+			generic := make([]uint8, 8*rect.Dx())
+			newRowReader64(m, rect)(y, fast)
+			newRowReader64(genericImage{m}, rect)(y, generic)
+			for i := range fast {
+				if fast[i] != generic[i] {
+					t.Fatalf("%s: the fast path differs from the generic path at row %d, byte %d: %d != %d", name, y, i, fast[i], generic[i])
+				}
+			}
+			for x := rect.Min.X; x < rect.Max.X; x++ {
+				r, g, b, a := m.At(x, y).RGBA()
+				if c := get64(fast[8*(x-rect.Min.X):]); c != (color.RGBA64{uint16(r), uint16(g), uint16(b), uint16(a)}) {
+					t.Fatalf("%s: expected the premultiplied color of (%d, %d), got %v", name, x, y, c)
+				}
+			}
+		}
+	}
+}
+
+func TestImageFunctions16Bit(t *testing.T) {
+	red := color.RGBA{255, 0, 0, 255}
+	for name, m := range randomImages64(13, 7) {
+		for fname, result := range map[string]image.Image{
+			"Red":              Red(m),
+			"CloseTo1":         CloseTo1(m, red, 100),
+			"CloseTo2":         CloseTo2(m, red, 100),
+			"CloseTo1Distance": CloseTo1Distance(m, red, Redmean, 0.3),
+			"CloseTo2Distance": CloseTo2Distance(m, red, DeltaE2000, 30),
+			"AddToAs":          AddToAs(m, m, red),
+			"SeparateN":        SeparateN(m, []color.RGBA{red, {0, 0, 255, 255}})[0],
+		} {
+			if _, ok := result.(*image.RGBA64); !ok {
+				t.Errorf("%s: %s: expected an *image.RGBA64, got %T", name, fname, result)
+			}
+			if result.Bounds().Size() != m.Bounds().Size() {
+				t.Errorf("%s: %s: expected the size %v, got %v", name, fname, m.Bounds().Size(), result.Bounds().Size())
+			}
+		}
+		// The 8-bit and 16-bit results should be close, since the same colors are kept
+		same8 := func(fname string, m1, m2 image.Image) {
+			rect1, rect2 := m1.Bounds(), m2.Bounds()
+			for y := 0; y < rect1.Dy(); y++ {
+				for x := 0; x < rect1.Dx(); x++ {
+					c1 := color.RGBAModel.Convert(m1.At(rect1.Min.X+x, rect1.Min.Y+y)).(color.RGBA)
+					c2 := color.RGBAModel.Convert(m2.At(rect2.Min.X+x, rect2.Min.Y+y)).(color.RGBA)
+					if absdiff(c1.R, c2.R) > 1 || absdiff(c1.G, c2.G) > 1 || absdiff(c1.B, c2.B) > 1 || absdiff(c1.A, c2.A) > 1 {
+						t.Fatalf("%s: %s: the pixels at (%d, %d) differ: %v != %v", name, fname, x, y, c1, c2)
+					}
+				}
+			}
+		}
+		g := genericImage{m}
+		same8("Red", Red(m), Red(g))
+		same8("AddToAs", AddToAs(m, m, red), AddToAs(g, g, red))
+	}
+}
+
+func TestRed16Bit(t *testing.T) {
+	m := image.NewNRGBA64(image.Rect(0, 0, 1, 1))
+	m.SetNRGBA64(0, 0, color.NRGBA64{0x1234, 0x5678, 0x9abc, 0xffff})
+	if c := Red(m).At(0, 0); c != (color.RGBA64{0x1234, 0, 0, 0xffff}) {
+		t.Errorf("Expected the red channel to keep 16 bits, got %v", c)
+	}
+}
+
+func TestSeparateN16Bit(t *testing.T) {
+	// The two pixels are the same with 8 bits per channel, but closest to different inks with 16 bits
+	var (
+		m    = image.NewRGBA64(image.Rect(0, 0, 2, 1))
+		inks = []color.RGBA{{100, 100, 100, 255}, {101, 101, 101, 255}}
+		v1   = uint16(100*257 + 90)
+		v2   = uint16(100*257 + 170)
+	)
+	m.SetRGBA64(0, 0, color.RGBA64{v1, v1, v1, 0xffff})
+	m.SetRGBA64(1, 0, color.RGBA64{v2, v2, v2, 0xffff})
+	for _, distance := range []Distance{EuclideanRGB, Redmean, DeltaE2000, DeltaEOK} {
+		plates := SeparateN(m, inks, Metric(distance))
+		if _, _, _, a := plates[0].At(0, 0).RGBA(); a == 0 {
+			t.Errorf("Expected the first pixel on the first plate")
+		}
+		if _, _, _, a := plates[1].At(1, 0).RGBA(); a == 0 {
+			t.Errorf("Expected the second pixel on the second plate")
+		}
+	}
+	// A Distance that is not a Distance64 is given 8-bit colors
+	var calls int
+	custom := DistanceFunc(func(c1, c2 color.RGBA) float64 {
+		calls++
+		return EuclideanRGB.Distance(c1, c2)
+	})
+	SeparateN(m, inks, Metric(custom), Workers(1))
+	if calls == 0 {
+		t.Error("Expected the custom distance to be used")
+	}
+}
+
+func TestSeparateCMYK16Bit(t *testing.T) {
+	m := image.NewGray16(image.Rect(0, 0, 1, 1))
+	m.SetGray16(0, 0, color.Gray16{0x8000})
+	_, _, _, kPlate := SeparateCMYK(m)
+	k, ok := kPlate.(*image.Gray16)
+	if !ok {
+		t.Fatalf("Expected an *image.Gray16, got %T", kPlate)
+	}
+	if v := k.Gray16At(0, 0).Y; v < 0x7f00 || v > 0x8100 {
+		t.Errorf("Expected the black plate to be half covered, got %#x", v)
+	}
+}
+
+func TestWrite16Bit(t *testing.T) {
+	m := image.NewNRGBA64(image.Rect(0, 0, 1, 1))
+	m.SetNRGBA64(0, 0, color.NRGBA64{0x1234, 0x5678, 0x9abc, 0xffff})
+	for _, ext := range []string{".png", ".tif", ".pam", ".ff"} {
+		filename := filepath.Join(t.TempDir(), "deep"+ext)
+		if err := Write(filename, Red(m)); err != nil {
+			t.Fatal(err)
+		}
+		read, err := Read(filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if r, _, _, _ := read.At(0, 0).RGBA(); r != 0x1234 {
+			t.Errorf("%s: expected 16 bits to be written, got %#x", ext, r)
+		}
+	}
+}
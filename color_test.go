@@ -3,6 +3,7 @@ package plates
 import (
 	"image"
 	"image/color"
+	"math"
 	"testing"
 )
 
@@ -50,7 +51,127 @@ func TestHue(t *testing.T) {
 func TestHSV(t *testing.T) {
 	c := color.RGBA{255, 0, 0, 255}
 	h, s, v := HSV(c)
-	if h != 0 || s != 0 || v != 255 {
-		t.Errorf("Expected (0, 0, 255), got (%d, %d, %d)", h, s, v)
+	if h != 0 || s != 255 || v != 255 {
+		t.Errorf("Expected (0, 255, 255), got (%d, %d, %d)", h, s, v)
+	}
+	tests := []struct {
+		c       color.RGBA
+		h, s, v uint8
+	}{
+		{color.RGBA{0, 255, 0, 255}, 85, 255, 255},
+		{color.RGBA{0, 0, 255, 255}, 171, 255, 255},
+		{color.RGBA{255, 0, 64, 255}, 245, 255, 255},
+		{color.RGBA{200, 100, 100, 255}, 0, 128, 200},
+		{color.RGBA{10, 10, 10, 255}, 0, 0, 10},
+		{color.RGBA{}, 0, 0, 0},
+	}
+	for _, test := range tests {
+		if h, s, v := HSV(test.c); h != test.h || s != test.s || v != test.v {
+			t.Errorf("%v: expected (%d, %d, %d), got (%d, %d, %d)", test.c, test.h, test.s, test.v, h, s, v)
+		}
+	}
+	if h, s, v := HSV64(color.RGBA64{0, 0, 0xffff, 0xffff}); h != 0xaaab || s != 0xffff || v != 0xffff {
+		t.Errorf("Expected (43691, 65535, 65535), got (%d, %d, %d)", h, s, v)
+	}
+}
+
+func TestHSVtoRGB(t *testing.T) {
+	// Every 8-bit color survives a round trip through HSV
+	for i := 0; i < 1<<24; i++ {
+		r, g, b := float64(i>>16)/255.0, float64(i>>8&0xff)/255.0, float64(i&0xff)/255.0
+		h, s, v := RGBtoHSV(r, g, b)
+		if h < 0 || h >= 1 || s < 0 || s > 1 || v < 0 || v > 1 {
+			t.Fatalf("(%f, %f, %f): HSV out of range: (%f, %f, %f)", r, g, b, h, s, v)
+		}
+		r2, g2, b2 := HSVtoRGB(h, s, v)
+		if math.Abs(r-r2) > 1e-9 || math.Abs(g-g2) > 1e-9 || math.Abs(b-b2) > 1e-9 {
+			t.Fatalf("(%f, %f, %f): got (%f, %f, %f) after a round trip", r, g, b, r2, g2, b2)
+		}
+	}
+	if r, g, b := HSVtoRGB(2.0/3.0, 1, 1); math.Abs(r) > 1e-9 || math.Abs(g) > 1e-9 || math.Abs(b-1) > 1e-9 {
+		t.Errorf("Expected blue, got (%f, %f, %f)", r, g, b)
+	}
+}
+
+func TestSeparate3(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 3, 1))
+	img.Set(0, 0, color.RGBA{250, 10, 10, 255})
+	img.Set(1, 0, color.RGBA{10, 250, 10, 255})
+	img.Set(2, 0, color.RGBA{10, 10, 250, 255})
+	red := color.RGBA{255, 0, 0, 255}
+	green := color.RGBA{0, 255, 0, 255}
+	blue := color.RGBA{0, 0, 255, 255}
+	img1, img2, img3 := Separate3(img, red, green, blue, 255)
+	for x, m := range []image.Image{img1, img2, img3} {
+		for i := 0; i < 3; i++ {
+			_, _, _, a := m.At(i, 0).RGBA()
+			if (i == x) != (a != 0) {
+				t.Errorf("Pixel %d should only be on plate %d", i, i+1)
+			}
+		}
+	}
+}
+
+// testImages returns 2x1 images of many different types,
+// where the left pixel is white and the right pixel is black
+func testImages() map[string]image.Image {
+	rect := image.Rect(0, 0, 2, 1)
+	images := map[string]image.Image{
+		"RGBA":     image.NewRGBA(rect),
+		"RGBA64":   image.NewRGBA64(rect),
+		"NRGBA":    image.NewNRGBA(rect),
+		"NRGBA64":  image.NewNRGBA64(rect),
+		"Gray":     image.NewGray(rect),
+		"Gray16":   image.NewGray16(rect),
+		"CMYK":     image.NewCMYK(rect),
+		"Paletted": image.NewPaletted(rect, color.Palette{color.Black, color.White}),
+	}
+	for _, m := range images {
+		m := m.(interface{ Set(x, y int, c color.Color) })
+		m.Set(0, 0, color.White)
+		m.Set(1, 0, color.Black)
+	}
+	ycbcr := image.NewYCbCr(rect, image.YCbCrSubsampleRatio444)
+	ycbcr.Y[0], ycbcr.Cb[0], ycbcr.Cr[0] = 255, 128, 128
+	ycbcr.Y[1], ycbcr.Cb[1], ycbcr.Cr[1] = 0, 128, 128
+	images["YCbCr"] = ycbcr
+	return images
+}
+
+// at8 returns the color at (x, y) as an 8-bit color, since images with 16 bits per channel give 16-bit results
+func at8(m image.Image, x, y int) color.RGBA {
+	return color.RGBAModel.Convert(m.At(x, y)).(color.RGBA)
+}
+
+func TestImageTypes(t *testing.T) {
+	white := color.RGBA{255, 255, 255, 255}
+	black := color.RGBA{0, 0, 0, 255}
+	red := color.RGBA{255, 0, 0, 255}
+	for name, img := range testImages() {
+		if c := at8(Red(img), 0, 0); c != (color.RGBA{255, 0, 0, 255}) {
+			t.Errorf("%s: Red: expected red, got %v", name, c)
+		}
+		if c := at8(Green(img), 0, 0); c != (color.RGBA{0, 255, 0, 255}) {
+			t.Errorf("%s: Green: expected green, got %v", name, c)
+		}
+		if c := at8(Blue(img), 1, 0); c != black {
+			t.Errorf("%s: Blue: expected black, got %v", name, c)
+		}
+		if c := at8(CloseTo1(img, white, 10), 0, 0); c != white {
+			t.Errorf("%s: CloseTo1: expected white, got %v", name, c)
+		}
+		if c := at8(CloseTo2(img, white, 10), 1, 0); c != (color.RGBA{}) {
+			t.Errorf("%s: CloseTo2: expected a transparent pixel, got %v", name, c)
+		}
+		if c := at8(AddToAs(img, img, red), 0, 0); c != red {
+			t.Errorf("%s: AddToAs: expected red, got %v", name, c)
+		}
+		if c := at8(AddToAs(image.NewRGBA(image.Rect(0, 0, 1, 1)), img, red), 1, 0); c != red {
+			t.Errorf("%s: AddToAs: expected red outside of orig, got %v", name, c)
+		}
+		img1, _, _ := Separate3(img, white, red, black, 255)
+		if c := at8(img1, 0, 0); c != white {
+			t.Errorf("%s: Separate3: expected white, got %v", name, c)
+		}
 	}
 }
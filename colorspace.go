@@ -0,0 +1,227 @@
+package plates
+
+import (
+	"image/color"
+	"math"
+)
+
+// The color types in this file implement color.Color, and have a color.Model each,
+// so that they can be used with image/draw and in custom image types.
+// They are all opaque sRGB colors (D65), with hues in degrees from 0 to 360.
+// Like the color types in image/color, converting a color with alpha uses the
+// premultiplied red, green and blue values. Colors that are outside of the sRGB
+// gamut are clamped when converted back to RGB.
+
+// HSVColor is a color with hue (0 to 360), saturation (0 to 1) and value (0 to 1)
+type HSVColor struct {
+	H, S, V float64
+}
+
+// HSLColor is a color with hue (0 to 360), saturation (0 to 1) and lightness (0 to 1)
+type HSLColor struct {
+	H, S, L float64
+}
+
+// LabColor is a CIELAB color, with lightness from 0 to 100 and a and b roughly from -128 to 127
+type LabColor struct {
+	L, A, B float64
+}
+
+// LChColor is a CIELAB color in polar form, with lightness from 0 to 100, chroma and hue (0 to 360)
+type LChColor struct {
+	L, C, H float64
+}
+
+// OKLabColor is an OKLab color, with lightness from 0 to 1 and a and b roughly from -0.4 to 0.4
+type OKLabColor struct {
+	L, A, B float64
+}
+
+// OKLChColor is an OKLab color in polar form, with lightness from 0 to 1, chroma and hue (0 to 360)
+type OKLChColor struct {
+	L, C, H float64
+}
+
+// Models for the color types in this file
+var (
+	HSVModel   = color.ModelFunc(hsvModel)
+	HSLModel   = color.ModelFunc(hslModel)
+	LabModel   = color.ModelFunc(labModel)
+	LChModel   = color.ModelFunc(lchModel)
+	OKLabModel = color.ModelFunc(okLabModel)
+	OKLChModel = color.ModelFunc(okLChModel)
+)
+
+// colorFloat returns the red, green and blue components of c, from 0 to 1
+func colorFloat(c color.Color) rgbFloat {
+	r, g, b, _ := c.RGBA()
+	return rgbFloat{float64(r) / 65535.0, float64(g) / 65535.0, float64(b) / 65535.0}
+}
+
+// rgba returns the 16-bit components of an opaque color, clamped to the sRGB gamut
+func (c rgbFloat) rgba() (uint32, uint32, uint32, uint32) {
+	return uint32(clamp01(c[0])*65535.0 + 0.5), uint32(clamp01(c[1])*65535.0 + 0.5), uint32(clamp01(c[2])*65535.0 + 0.5), 0xffff
+}
+
+// hue returns the hue of an RGB color in degrees, from 0 to 360, and the largest and smallest components
+func (c rgbFloat) hue() (float64, float64, float64) {
+	var (
+		r, g, b = c[0], c[1], c[2]
+		maxc    = fmax(r, g, b)
+		minc    = fmin(r, g, b)
+		span    = maxc - minc
+		h       float64
+	)
+	switch {
+	case span == 0:
+		return 0, maxc, minc
+	case maxc == r:
+		h = math.Mod((g-b)/span, 6.0)
+	case maxc == g:
+		h = (b-r)/span + 2.0
+	default:
+		h = (r-g)/span + 4.0
+	}
+	return normalizeHue(60.0 * h), maxc, minc
+}
+
+// normalizeHue returns the hue in degrees, from 0 up to, but not including, 360
+func normalizeHue(h float64) float64 {
+	h = math.Mod(h, 360.0)
+	if h < 0 {
+		h += 360.0
+	}
+	return h
+}
+
+// hueToFloat returns the RGB color for a hue in degrees, with the given chroma and
+// smallest component, which is how both HSV and HSL colors are converted to RGB
+func hueToFloat(h, chroma, m float64) rgbFloat {
+	var (
+		h6 = normalizeHue(h) / 60.0
+		x  = chroma * (1 - fabs(math.Mod(h6, 2.0)-1))
+		c  rgbFloat
+	)
+	switch int(h6) {
+	case 0:
+		c = rgbFloat{chroma, x, 0}
+	case 1:
+		c = rgbFloat{x, chroma, 0}
+	case 2:
+		c = rgbFloat{0, chroma, x}
+	case 3:
+		c = rgbFloat{0, x, chroma}
+	case 4:
+		c = rgbFloat{x, 0, chroma}
+	default:
+		c = rgbFloat{chroma, 0, x}
+	}
+	return rgbFloat{c[0] + m, c[1] + m, c[2] + m}
+}
+
+// toPolar converts a and b to chroma and hue in degrees
+func toPolar(a, b float64) (float64, float64) {
+	c := math.Hypot(a, b)
+	if c < 1e-9 {
+		return 0, 0
+	}
+	return c, normalizeHue(math.Atan2(b, a) * 180.0 / math.Pi)
+}
+
+// fromPolar converts chroma and hue in degrees to a and b
+func fromPolar(c, h float64) (float64, float64) {
+	sin, cos := math.Sincos(radians(h))
+	return c * cos, c * sin
+}
+
+// RGBA returns the premultiplied red, green, blue and alpha values, as color.Color requires
+func (c HSVColor) RGBA() (uint32, uint32, uint32, uint32) {
+	r, g, b := HSVtoRGB(c.H/360.0, c.S, c.V)
+	return rgbFloat{r, g, b}.rgba()
+}
+
+// RGBA returns the premultiplied red, green, blue and alpha values, as color.Color requires
+func (c HSLColor) RGBA() (uint32, uint32, uint32, uint32) {
+	chroma := (1 - fabs(2*c.L-1)) * c.S
+	return hueToFloat(c.H, chroma, c.L-chroma/2).rgba()
+}
+
+// RGBA returns the premultiplied red, green, blue and alpha values, as color.Color requires
+func (c LabColor) RGBA() (uint32, uint32, uint32, uint32) {
+	return labToFloat(c.L, c.A, c.B).rgba()
+}
+
+// RGBA returns the premultiplied red, green, blue and alpha values, as color.Color requires
+func (c LChColor) RGBA() (uint32, uint32, uint32, uint32) {
+	a, b := fromPolar(c.C, c.H)
+	return labToFloat(c.L, a, b).rgba()
+}
+
+// RGBA returns the premultiplied red, green, blue and alpha values, as color.Color requires
+func (c OKLabColor) RGBA() (uint32, uint32, uint32, uint32) {
+	return okLabToFloat(c.L, c.A, c.B).rgba()
+}
+
+// RGBA returns the premultiplied red, green, blue and alpha values, as color.Color requires
+func (c OKLChColor) RGBA() (uint32, uint32, uint32, uint32) {
+	a, b := fromPolar(c.C, c.H)
+	return okLabToFloat(c.L, a, b).rgba()
+}
+
+func hsvModel(c color.Color) color.Color {
+	if _, ok := c.(HSVColor); ok {
+		return c
+	}
+	f := colorFloat(c)
+	h, s, v := RGBtoHSV(f[0], f[1], f[2])
+	return HSVColor{h * 360.0, s, v}
+}
+
+func hslModel(c color.Color) color.Color {
+	if _, ok := c.(HSLColor); ok {
+		return c
+	}
+	h, maxc, minc := colorFloat(c).hue()
+	var (
+		l = (maxc + minc) / 2
+		s float64
+	)
+	if l > 0 && l < 1 {
+		s = (maxc - minc) / (1 - fabs(2*l-1))
+	}
+	return HSLColor{h, s, l}
+}
+
+func labModel(c color.Color) color.Color {
+	if _, ok := c.(LabColor); ok {
+		return c
+	}
+	l, a, b := floatToLab(colorFloat(c))
+	return LabColor{l, a, b}
+}
+
+func lchModel(c color.Color) color.Color {
+	if _, ok := c.(LChColor); ok {
+		return c
+	}
+	l, a, b := floatToLab(colorFloat(c))
+	chroma, h := toPolar(a, b)
+	return LChColor{l, chroma, h}
+}
+
+func okLabModel(c color.Color) color.Color {
+	if _, ok := c.(OKLabColor); ok {
+		return c
+	}
+	l, a, b := floatToOKLab(colorFloat(c))
+	return OKLabColor{l, a, b}
+}
+
+func okLChModel(c color.Color) color.Color {
+	if _, ok := c.(OKLChColor); ok {
+		return c
+	}
+	l, a, b := floatToOKLab(colorFloat(c))
+	chroma, h := toPolar(a, b)
+	return OKLChColor{l, chroma, h}
+}
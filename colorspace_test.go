@@ -0,0 +1,108 @@
+package plates
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+	"testing"
+)
+
+// closeFloats returns true if the two lists of numbers are within the given tolerance of each other
+func closeFloats(a, b []float64, tolerance float64) bool {
+	for i := range a {
+		if math.Abs(a[i]-b[i]) > tolerance {
+			return false
+		}
+	}
+	return true
+}
+
+func TestColorModels(t *testing.T) {
+	red := color.RGBA{255, 0, 0, 255}
+	tests := []struct {
+		model     color.Model
+		color     color.Color
+		values    func(color.Color) []float64
+		expected  []float64
+		tolerance float64
+	}{
+		{HSVModel, red, func(c color.Color) []float64 { v := c.(HSVColor); return []float64{v.H, v.S, v.V} }, []float64{0, 1, 1}, 1e-9},
+		{HSVModel, color.RGBA{0, 0, 255, 255}, func(c color.Color) []float64 { v := c.(HSVColor); return []float64{v.H, v.S, v.V} }, []float64{240, 1, 1}, 1e-9},
+		{HSVModel, color.RGBA{255, 0, 255, 255}, func(c color.Color) []float64 { v := c.(HSVColor); return []float64{v.H, v.S, v.V} }, []float64{300, 1, 1}, 1e-9},
+		{HSLModel, red, func(c color.Color) []float64 { v := c.(HSLColor); return []float64{v.H, v.S, v.L} }, []float64{0, 1, 0.5}, 1e-4},
+		{HSLModel, color.RGBA{0, 255, 0, 255}, func(c color.Color) []float64 { v := c.(HSLColor); return []float64{v.H, v.S, v.L} }, []float64{120, 1, 0.5}, 1e-4},
+		{LabModel, red, func(c color.Color) []float64 { v := c.(LabColor); return []float64{v.L, v.A, v.B} }, []float64{53.2408, 80.0925, 67.2032}, 1e-3},
+		{LabModel, color.White, func(c color.Color) []float64 { v := c.(LabColor); return []float64{v.L, v.A, v.B} }, []float64{100, 0, 0}, 1e-3},
+		{LChModel, red, func(c color.Color) []float64 { v := c.(LChColor); return []float64{v.L, v.C, v.H} }, []float64{53.2408, 104.5518, 39.999}, 1e-3},
+		{OKLabModel, red, func(c color.Color) []float64 { v := c.(OKLabColor); return []float64{v.L, v.A, v.B} }, []float64{0.62796, 0.22486, 0.12585}, 1e-4},
+		{OKLabModel, color.White, func(c color.Color) []float64 { v := c.(OKLabColor); return []float64{v.L, v.A, v.B} }, []float64{1, 0, 0}, 1e-4},
+		{OKLChModel, red, func(c color.Color) []float64 { v := c.(OKLChColor); return []float64{v.L, v.C, v.H} }, []float64{0.62796, 0.25768, 29.2339}, 1e-3},
+	}
+	for _, test := range tests {
+		converted := test.model.Convert(test.color)
+		if values := test.values(converted); !closeFloats(values, test.expected, test.tolerance) {
+			t.Errorf("%T of %v: expected %v, got %v", converted, test.color, test.expected, values)
+		}
+		// Converting back to RGB gives the same color
+		if c := color.RGBAModel.Convert(converted); c != color.RGBAModel.Convert(test.color) {
+			t.Errorf("%T: expected %v after a round trip, got %v", converted, test.color, c)
+		}
+		// Converting a color to its own model returns it unchanged
+		if again := test.model.Convert(converted); again != converted {
+			t.Errorf("%T: expected the color to be unchanged, got %v", converted, again)
+		}
+	}
+}
+
+func TestColorModelsRoundTrip(t *testing.T) {
+	models := []color.Model{HSVModel, HSLModel, LabModel, LChModel, OKLabModel, OKLChModel}
+	for r := 0; r < 256; r += 15 {
+		for g := 0; g < 256; g += 15 {
+			for b := 0; b < 256; b += 15 {
+				c := color.RGBA64{uint16(r * 257), uint16(g * 257), uint16(b * 257), 0xffff}
+				for _, model := range models {
+					converted := model.Convert(c)
+					cr, cg, cb, ca := converted.RGBA()
+					if absdiff16(uint16(cr), c.R) > 1 || absdiff16(uint16(cg), c.G) > 1 || absdiff16(uint16(cb), c.B) > 1 || ca != 0xffff {
+						t.Fatalf("%T: expected %v after a round trip, got (%d, %d, %d, %d)", converted, c, cr, cg, cb, ca)
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestColorModelsOutOfGamut(t *testing.T) {
+	// A very saturated green is outside of sRGB, and is clamped
+	c := color.RGBAModel.Convert(OKLChColor{0.8, 0.4, 140}).(color.RGBA)
+	if c.A != 255 || c.R != 0 || c.G < 200 {
+		t.Errorf("Expected a clamped green, got %v", c)
+	}
+}
+
+// hslImage is an image type that stores HSLColor values
+type hslImage struct {
+	rect image.Rectangle
+	pix  []HSLColor
+}
+
+func (m *hslImage) ColorModel() color.Model { return HSLModel }
+func (m *hslImage) Bounds() image.Rectangle { return m.rect }
+func (m *hslImage) At(x, y int) color.Color { return m.pix[y*m.rect.Dx()+x] }
+func (m *hslImage) Set(x, y int, c color.Color) {
+	m.pix[y*m.rect.Dx()+x] = HSLModel.Convert(c).(HSLColor)
+}
+
+func TestColorModelDraw(t *testing.T) {
+	m := &hslImage{image.Rect(0, 0, 2, 2), make([]HSLColor, 4)}
+	draw.Draw(m, m.rect, image.NewUniform(color.RGBA{0, 0, 255, 255}), image.Point{}, draw.Src)
+	if c := m.pix[3]; !closeFloats([]float64{c.H, c.S, c.L}, []float64{240, 1, 0.5}, 1e-4) {
+		t.Errorf("Expected blue, got %v", c)
+	}
+	dst := image.NewRGBA(m.rect)
+	draw.Draw(dst, dst.Rect, m, image.Point{}, draw.Src)
+	if c := dst.RGBAAt(1, 1); c != (color.RGBA{0, 0, 255, 255}) {
+		t.Errorf("Expected blue, got %v", c)
+	}
+}
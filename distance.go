@@ -0,0 +1,219 @@
+package plates
+
+import (
+	"image/color"
+	"math"
+)
+
+// Distance is a way of measuring how different two colors are.
+// A distance of 0 means that the colors are identical, and larger values
+// mean that the colors are further apart. Each implementation has its own
+// scale, so thresholds must be chosen for the Distance that is used.
+// The first color is the reference color, which is the ink or the target color
+// when a Distance is used by SeparateN, CloseTo1Distance and CloseTo2Distance,
+// and the second color is the pixel that is compared with it.
+type Distance interface {
+	Distance(c1, c2 color.RGBA) float64
+}
+
+// Distance64 is a Distance that can also measure how different two 16-bit colors are,
+// which is used for images with 16 bits per channel. Other distances are given
+// the colors with 8 bits per channel instead. All the distances in this package are Distance64.
+type Distance64 interface {
+	Distance
+	Distance64(c1, c2 color.RGBA64) float64
+}
+
+// DistanceFunc is a function that can be used as a Distance
+type DistanceFunc func(c1, c2 color.RGBA) float64
+
+// Distance returns the distance between two colors, by calling f
+func (f DistanceFunc) Distance(c1, c2 color.RGBA) float64 {
+	return f(c1, c2)
+}
+
+// floatDistance is a Distance that is calculated from colors with channels from 0 to 1,
+// so that it works the same for 8-bit and 16-bit colors
+type floatDistance func(c1, c2 rgbFloat) float64
+
+// Distance returns the distance between two 8-bit colors
+func (f floatDistance) Distance(c1, c2 color.RGBA) float64 {
+	return f(floatRGB(c1), floatRGB(c2))
+}
+
+// Distance64 returns the distance between two 16-bit colors
+func (f floatDistance) Distance64(c1, c2 color.RGBA64) float64 {
+	return f(floatRGB64(c1), floatRGB64(c2))
+}
+
+// distance64 returns the distance between two 16-bit colors, with 8-bit colors if d is not a Distance64
+func distance64(d Distance, c1, c2 color.RGBA64) float64 {
+	if d64, ok := d.(Distance64); ok {
+		return d64.Distance64(c1, c2)
+	}
+	return d.Distance(to8(c1), to8(c2))
+}
+
+// to8 converts a 16-bit color to an 8-bit color
+func to8(c color.RGBA64) color.RGBA {
+	return color.RGBA{uint8(c.R >> 8), uint8(c.G >> 8), uint8(c.B >> 8), uint8(c.A >> 8)}
+}
+
+var (
+	// EuclideanRGB is the straight line distance between two colors in the RGB cube.
+	// The range is from 0 to about 441.7 (the distance from black to white).
+	// It measures linear light instead of the gamma encoded values with the LinearLight option.
+	EuclideanRGB Distance = rgbDistance(euclideanRGB)
+
+	// Redmean is a weighted Euclidean RGB distance that is cheap to compute,
+	// but takes some of the sensitivity of the human eye into account.
+	// The range is from 0 to 1.
+	// It measures linear light instead of the gamma encoded values with the LinearLight option.
+	Redmean Distance = rgbDistance(redmean)
+
+	// DeltaE76 is the CIE76 color difference, the Euclidean distance in CIELAB.
+	// A difference of about 2.3 is just noticeable.
+	DeltaE76 Distance = floatDistance(deltaE76)
+
+	// DeltaE94 is the CIE94 color difference, with the weights for graphic arts.
+	// The first color is used as the reference color, which is the ink or the target color.
+	DeltaE94 Distance = floatDistance(deltaE94)
+
+	// DeltaE2000 is the CIEDE2000 color difference, which is the most accurate
+	// of the CIE color differences, but also the slowest.
+	DeltaE2000 Distance = floatDistance(deltaE2000)
+
+	// DeltaEOK is the Euclidean distance in the OKLab color space.
+	// The range is from 0 to about 1.
+	DeltaEOK Distance = floatDistance(deltaEOK)
+)
+
+// euclideanRGB returns the Euclidean distance between two colors in RGB space, with channels from 0 to 255
+func euclideanRGB(c1, c2 rgbFloat) float64 {
+	dr := c1[0] - c2[0]
+	dg := c1[1] - c2[1]
+	db := c1[2] - c2[2]
+	return math.Sqrt(dr*dr + dg*dg + db*db)
+}
+
+// redmean returns the "redmean" weighted Euclidean distance between two colors,
+// with channels from 0 to 255, which is a cheap approximation of how different the colors look.
+// The distance is scaled to be in the range 0 to 1.
+func redmean(c1, c2 rgbFloat) float64 {
+	rmean := (c1[0] + c2[0]) / 2.0
+	dr := c1[0] - c2[0]
+	dg := c1[1] - c2[1]
+	db := c1[2] - c2[2]
+	d := math.Sqrt((2.0+rmean/256.0)*dr*dr + 4.0*dg*dg + (2.0+(255.0-rmean)/256.0)*db*db)
+	return math.Min(d/(3.0*255.0), 1.0)
+}
+
+// deltaE76 returns the CIE76 color difference between two colors
+func deltaE76(c1, c2 rgbFloat) float64 {
+	l1, a1, b1 := floatToLab(c1)
+	l2, a2, b2 := floatToLab(c2)
+	return math.Sqrt(sq(l1-l2) + sq(a1-a2) + sq(b1-b2))
+}
+
+// deltaE94 returns the CIE94 color difference between two colors
+func deltaE94(c1, c2 rgbFloat) float64 {
+	l1, a1, b1 := floatToLab(c1)
+	l2, a2, b2 := floatToLab(c2)
+	return labDeltaE94(l1, a1, b1, l2, a2, b2)
+}
+
+// labDeltaE94 returns the CIE94 color difference between two CIELAB colors,
+// using the graphic arts weights (kL = 1, K1 = 0.045, K2 = 0.015)
+func labDeltaE94(l1, a1, b1, l2, a2, b2 float64) float64 {
+	c1 := math.Hypot(a1, b1)
+	c2 := math.Hypot(a2, b2)
+	dL := l1 - l2
+	dC := c1 - c2
+	dH2 := sq(a1-a2) + sq(b1-b2) - sq(dC)
+	if dH2 < 0 {
+		dH2 = 0
+	}
+	sc := 1.0 + 0.045*c1
+	sh := 1.0 + 0.015*c1
+	return math.Sqrt(sq(dL) + sq(dC/sc) + dH2/sq(sh))
+}
+
+// deltaE2000 returns the CIEDE2000 color difference between two colors
+func deltaE2000(c1, c2 rgbFloat) float64 {
+	l1, a1, b1 := floatToLab(c1)
+	l2, a2, b2 := floatToLab(c2)
+	return labDeltaE2000(l1, a1, b1, l2, a2, b2)
+}
+
+// labDeltaE2000 returns the CIEDE2000 color difference between two CIELAB colors.
+// Implemented as described by Sharma, Wu and Dalal (2005).
+func labDeltaE2000(l1, a1, b1, l2, a2, b2 float64) float64 {
+	const pow25to7 = 6103515625.0 // 25^7
+
+	cbar := (math.Hypot(a1, b1) + math.Hypot(a2, b2)) / 2.0
+	cbar7 := math.Pow(cbar, 7)
+	g := 0.5 * (1.0 - math.Sqrt(cbar7/(cbar7+pow25to7)))
+	a1p := (1.0 + g) * a1
+	a2p := (1.0 + g) * a2
+	c1p := math.Hypot(a1p, b1)
+	c2p := math.Hypot(a2p, b2)
+	h1p := hueDegrees(a1p, b1)
+	h2p := hueDegrees(a2p, b2)
+
+	dLp := l2 - l1
+	dCp := c2p - c1p
+	dhp := 0.0
+	if c1p*c2p != 0 {
+		dhp = h2p - h1p
+		if dhp > 180 {
+			dhp -= 360
+		} else if dhp < -180 {
+			dhp += 360
+		}
+	}
+	dHp := 2.0 * math.Sqrt(c1p*c2p) * math.Sin(radians(dhp/2.0))
+
+	lbarp := (l1 + l2) / 2.0
+	cbarp := (c1p + c2p) / 2.0
+	hbarp := h1p + h2p
+	if c1p*c2p != 0 {
+		if fabs(h1p-h2p) <= 180 {
+			hbarp /= 2.0
+		} else if h1p+h2p < 360 {
+			hbarp = (hbarp + 360) / 2.0
+		} else {
+			hbarp = (hbarp - 360) / 2.0
+		}
+	}
+
+	t := 1.0 - 0.17*math.Cos(radians(hbarp-30)) + 0.24*math.Cos(radians(2*hbarp)) +
+		0.32*math.Cos(radians(3*hbarp+6)) - 0.20*math.Cos(radians(4*hbarp-63))
+	dTheta := 30.0 * math.Exp(-sq((hbarp-275.0)/25.0))
+	cbarp7 := math.Pow(cbarp, 7)
+	rc := 2.0 * math.Sqrt(cbarp7/(cbarp7+pow25to7))
+	sl := 1.0 + 0.015*sq(lbarp-50.0)/math.Sqrt(20.0+sq(lbarp-50.0))
+	sc := 1.0 + 0.045*cbarp
+	sh := 1.0 + 0.015*cbarp*t
+	rt := -math.Sin(radians(2*dTheta)) * rc
+
+	return math.Sqrt(sq(dLp/sl) + sq(dCp/sc) + sq(dHp/sh) + rt*(dCp/sc)*(dHp/sh))
+}
+
+// deltaEOK returns the Euclidean distance between two colors in OKLab
+func deltaEOK(c1, c2 rgbFloat) float64 {
+	l1, a1, b1 := floatToOKLab(c1)
+	l2, a2, b2 := floatToOKLab(c2)
+	return math.Sqrt(sq(l1-l2) + sq(a1-a2) + sq(b1-b2))
+}
+
+// hueDegrees returns the hue angle of a and b, in degrees from 0 to 360
+func hueDegrees(a, b float64) float64 {
+	if a == 0 && b == 0 {
+		return 0
+	}
+	h := math.Atan2(b, a) * 180.0 / math.Pi
+	if h < 0 {
+		h += 360
+	}
+	return h
+}
@@ -0,0 +1,111 @@
+package plates
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"testing"
+)
+
+func TestLabDeltaE2000(t *testing.T) {
+	// Test data from Sharma, Wu and Dalal (2005)
+	tests := []struct {
+		l1, a1, b1, l2, a2, b2, expected float64
+	}{
+		{50.0000, 2.6772, -79.7751, 50.0000, 0.0000, -82.7485, 2.0425},
+		{50.0000, 3.1571, -77.2803, 50.0000, 0.0000, -82.7485, 2.8615},
+		{50.0000, -1.3802, -84.2814, 50.0000, 0.0000, -82.7485, 1.0000},
+		{50.0000, 2.5000, 0.0000, 50.0000, 0.0000, -2.5000, 4.3065},
+		{50.0000, 2.5000, 0.0000, 73.0000, 25.0000, -18.0000, 27.1492},
+		{60.2574, -34.0099, 36.2677, 60.4626, -34.1751, 39.4387, 1.2644},
+		{22.7233, 20.0904, -46.6940, 23.0331, 14.9730, -42.5619, 2.0373},
+		{90.8027, -2.0831, 1.4410, 91.1528, -1.6435, 0.0447, 1.4441},
+		{2.0776, 0.0795, -1.1350, 0.9033, -0.0636, -0.5514, 0.9082},
+	}
+	for _, test := range tests {
+		d := labDeltaE2000(test.l1, test.a1, test.b1, test.l2, test.a2, test.b2)
+		if math.Abs(d-test.expected) > 0.0001 {
+			t.Errorf("Expected %.4f, got %.4f for %v", test.expected, d, test)
+		}
+		// CIEDE2000 is symmetric
+		d = labDeltaE2000(test.l2, test.a2, test.b2, test.l1, test.a1, test.b1)
+		if math.Abs(d-test.expected) > 0.0001 {
+			t.Errorf("Expected %.4f, got %.4f for %v with the colors swapped", test.expected, d, test)
+		}
+	}
+}
+
+func TestRGBToLab(t *testing.T) {
+	l, a, b := rgbToLab(color.RGBA{255, 255, 255, 255})
+	if math.Abs(l-100) > 0.01 || math.Abs(a) > 0.01 || math.Abs(b) > 0.01 {
+		t.Errorf("Expected (100, 0, 0) for white, got (%f, %f, %f)", l, a, b)
+	}
+	// Reference value for sRGB red
+	l, a, b = rgbToLab(color.RGBA{255, 0, 0, 255})
+	if math.Abs(l-53.24) > 0.01 || math.Abs(a-80.09) > 0.01 || math.Abs(b-67.20) > 0.01 {
+		t.Errorf("Expected (53.24, 80.09, 67.20) for red, got (%f, %f, %f)", l, a, b)
+	}
+}
+
+func TestRGBToOKLab(t *testing.T) {
+	// Reference value for sRGB red, from the OKLab blog post by Björn Ottosson
+	l, a, b := rgbToOKLab(color.RGBA{255, 0, 0, 255})
+	if math.Abs(l-0.6280) > 0.0001 || math.Abs(a-0.2249) > 0.0001 || math.Abs(b-0.1258) > 0.0001 {
+		t.Errorf("Expected (0.6280, 0.2249, 0.1258) for red, got (%f, %f, %f)", l, a, b)
+	}
+}
+
+func TestDistances(t *testing.T) {
+	red := color.RGBA{255, 0, 0, 255}
+	darkRed := color.RGBA{200, 0, 0, 255}
+	blue := color.RGBA{0, 0, 255, 255}
+	for name, d := range map[string]Distance{
+		"EuclideanRGB": EuclideanRGB,
+		"Redmean":      Redmean,
+		"DeltaE76":     DeltaE76,
+		"DeltaE94":     DeltaE94,
+		"DeltaE2000":   DeltaE2000,
+		"DeltaEOK":     DeltaEOK,
+	} {
+		if same := d.Distance(red, red); same != 0 {
+			t.Errorf("%s: expected 0 for identical colors, got %f", name, same)
+		}
+		if near, far := d.Distance(red, darkRed), d.Distance(red, blue); near >= far {
+			t.Errorf("%s: expected dark red (%f) to be closer to red than blue (%f)", name, near, far)
+		}
+	}
+}
+
+func TestCloseTo2Distance(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 2, 1))
+	img.Set(0, 0, color.RGBA{250, 5, 5, 255})
+	img.Set(1, 0, color.RGBA{5, 5, 250, 255})
+	target := color.RGBA{255, 0, 0, 255}
+	newImage := CloseTo2Distance(img, target, DeltaE2000, 5)
+	if c := newImage.At(0, 0); c != target {
+		t.Errorf("Expected %v, got %v", target, c)
+	}
+	if _, _, _, a := newImage.At(1, 0).RGBA(); a != 0 {
+		t.Errorf("Expected a transparent pixel, got alpha %d", a)
+	}
+}
+
+func TestEuclideanRGBExact(t *testing.T) {
+	for a := 0; a < 256; a++ {
+		for b := 0; b < 256; b++ {
+			c1, c2 := color.RGBA{uint8(a), 0, 0, 255}, color.RGBA{uint8(b), 0, 0, 255}
+			want := float64(a - b)
+			if want < 0 {
+				want = -want
+			}
+			if d := EuclideanRGB.Distance(c1, c2); d != want {
+				t.Fatalf("Expected the distance between %v and %v to be %v, got %v", c1, c2, want, d)
+			}
+		}
+	}
+	m := image.NewRGBA(image.Rect(0, 0, 1, 1))
+	m.Set(0, 0, color.RGBA{33, 0, 0, 255})
+	if _, _, _, a := CloseTo2Distance(m, color.RGBA{0, 0, 0, 255}, EuclideanRGB, 33).At(0, 0).RGBA(); a != 0 {
+		t.Error("Expected a pixel exactly at the threshold to not be close")
+	}
+}
@@ -0,0 +1,68 @@
+package plates
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+)
+
+// errFarbfeld is returned when a farbfeld image could not be decoded
+var errFarbfeld = errors.New("invalid farbfeld image")
+
+// farbfeldMagic is the start of every farbfeld image
+const farbfeldMagic = "farbfeld"
+
+// DecodeFarbfeld decodes a farbfeld image from r. Farbfeld images have 16-bit
+// big-endian RGBA samples without premultiplied alpha, which is exactly the
+// layout of an *image.NRGBA64, so that is what is returned.
+func DecodeFarbfeld(r io.Reader) (image.Image, error) {
+	var header [16]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil || string(header[:8]) != farbfeldMagic {
+		return nil, errFarbfeld
+	}
+	width, height := int(binary.BigEndian.Uint32(header[8:])), int(binary.BigEndian.Uint32(header[12:]))
+	if width == 0 || height == 0 || width > maxPixels/height {
+		return nil, fmt.Errorf("%w: invalid size: %dx%d", errFarbfeld, width, height)
+	}
+	m := image.NewNRGBA64(image.Rect(0, 0, width, height))
+	if _, err := io.ReadFull(r, m.Pix); err != nil {
+		return nil, fmt.Errorf("%w: %v", errFarbfeld, err)
+	}
+	return m, nil
+}
+
+// EncodeFarbfeld writes the image m to w as a farbfeld image
+func EncodeFarbfeld(w io.Writer, m image.Image) error {
+	var (
+		bw     = bufio.NewWriter(w)
+		rect   = m.Bounds()
+		header [16]byte
+		pixel  [8]byte
+	)
+	copy(header[:], farbfeldMagic)
+	binary.BigEndian.PutUint32(header[8:], uint32(rect.Dx()))
+	binary.BigEndian.PutUint32(header[12:], uint32(rect.Dy()))
+	bw.Write(header[:])
+	if n, ok := m.(*image.NRGBA64); ok {
+		for y := rect.Min.Y; y < rect.Max.Y; y++ {
+			i := n.PixOffset(rect.Min.X, y)
+			bw.Write(n.Pix[i : i+8*rect.Dx()])
+		}
+		return bw.Flush()
+	}
+	for y := rect.Min.Y; y < rect.Max.Y; y++ {
+		for x := rect.Min.X; x < rect.Max.X; x++ {
+			c := color.NRGBA64Model.Convert(m.At(x, y)).(color.NRGBA64)
+			binary.BigEndian.PutUint16(pixel[0:], c.R)
+			binary.BigEndian.PutUint16(pixel[2:], c.G)
+			binary.BigEndian.PutUint16(pixel[4:], c.B)
+			binary.BigEndian.PutUint16(pixel[6:], c.A)
+			bw.Write(pixel[:])
+		}
+	}
+	return bw.Flush()
+}
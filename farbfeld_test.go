@@ -0,0 +1,39 @@
+package plates
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"strings"
+	"testing"
+)
+
+func TestFarbfeldRoundTrip(t *testing.T) {
+	testRoundTrip(t, EncodeFarbfeld, DecodeFarbfeld, color.NRGBA64Model)
+}
+
+func TestDecodeFarbfeld(t *testing.T) {
+	data := "farbfeld\x00\x00\x00\x01\x00\x00\x00\x01\x12\x34\x56\x78\x9a\xbc\xde\xf0"
+	m, err := DecodeFarbfeld(strings.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c := m.At(0, 0); c != (color.NRGBA64{0x1234, 0x5678, 0x9abc, 0xdef0}) {
+		t.Errorf("Expected big-endian 16-bit samples, got %v", c)
+	}
+	var buf bytes.Buffer
+	if err := EncodeFarbfeld(&buf, m); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != data {
+		t.Errorf("Expected %q, got %q", data, buf.String())
+	}
+	for _, data := range []string{"", "farbfelt\x00\x00\x00\x01\x00\x00\x00\x01", "farbfeld\x00\x00\x00\x00\x00\x00\x00\x01", data[:20]} {
+		if _, err := DecodeFarbfeld(strings.NewReader(data)); err == nil {
+			t.Errorf("Expected an error for %q", data)
+		}
+	}
+	if _, ok := m.(*image.NRGBA64); !ok {
+		t.Errorf("Expected an *image.NRGBA64, got %T", m)
+	}
+}
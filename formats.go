@@ -0,0 +1,388 @@
+package plates
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"image"
+	"image/draw"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	bmp "github.com/jsummers/gobmp"
+	"github.com/xyproto/xpm"
+	"golang.org/x/image/tiff"
+)
+
+// ErrUnknownFormat is returned when the format of an image could not be recognized
+var ErrUnknownFormat = errors.New("unrecognized image format")
+
+// maxPixels is the largest number of pixels that a decoded image may have,
+// for the formats where plates does the decoding
+const maxPixels = 1 << 28
+
+// format describes an image format that can be read and/or written
+type format struct {
+	name       string
+	extensions []string
+	// magic are the byte sequences that files in this format can start with.
+	// A "?" matches any byte.
+	magic  []string
+	decode func(io.Reader) (image.Image, error)
+	encode func(io.Writer, image.Image, *EncodeOptions) error
+}
+
+// builtinFormats are the image formats that plates supports without RegisterFormat
+var builtinFormats = []format{
+	{"png", []string{".png"}, []string{"\x89PNG\r\n\x1a\n"}, png.Decode, encodePNG},
+	{"jpeg", []string{".jpg", ".jpeg"}, []string{"\xff\xd8"}, jpeg.Decode, encodeJPEG},
+	{"gif", []string{".gif"}, []string{"GIF87a", "GIF89a"}, gif.Decode, encodeGIF},
+	{"ico", []string{".ico"}, []string{"\x00\x00\x01\x00"}, DecodeICO, encodeICO},
+	{"bmp", []string{".bmp"}, []string{"BM"}, bmp.Decode, encodeBMP},
+	{"webp", []string{".webp"}, []string{"RIFF????WEBP"}, decodeWebP, encodeWebP},
+	{"xpm", []string{".xpm"}, []string{"/* XPM */", "! XPM2"}, DecodeXPM, encodeXPM},
+	{"pbm", []string{".pbm"}, []string{"P1", "P4"}, DecodeNetpbm, encodeNetpbm("pbm")},
+	{"pgm", []string{".pgm"}, []string{"P2", "P5"}, DecodeNetpbm, encodeNetpbm("pgm")},
+	{"ppm", []string{".ppm", ".pnm"}, []string{"P3", "P6"}, DecodeNetpbm, encodeNetpbm("ppm")},
+	{"pam", []string{".pam"}, []string{"P7"}, DecodeNetpbm, encodeNetpbm("pam")},
+	{"tiff", []string{".tif", ".tiff"}, []string{"II*\x00", "MM\x00*"}, tiff.Decode, encodeTIFF},
+	{"qoi", []string{".qoi"}, []string{"qoif"}, DecodeQOI, encodeQOI},
+	{"farbfeld", []string{".ff"}, []string{"farbfeld"}, DecodeFarbfeld, encodeFarbfeld},
+	// TGA images have no magic bytes, so they are only recognized by their extension
+	{"tga", []string{".tga"}, nil, DecodeTGA, encodeTGA},
+}
+
+var (
+	// registryMutex is held while a format is being registered
+	registryMutex sync.Mutex
+
+	// registry holds the []format of all the registered formats, in the order they are checked.
+	// The slice is replaced instead of modified when a format is registered,
+	// so that it can be read without holding registryMutex.
+	registry atomic.Value
+)
+
+func init() {
+	registry.Store(builtinFormats)
+}
+
+// registeredFormats returns all the registered formats, in the order they are checked
+func registeredFormats() []format {
+	return registry.Load().([]format)
+}
+
+// RegisterFormat adds an image format, so that it can be used by Read, ReadFile, Write,
+// Decode, Encode and the puppyart command. The name is what Decode returns and what Encode
+// takes as the format. The extensions, like ".heic", are used for finding the format from a
+// filename, and magic are the byte sequences that files in this format start with, where "?"
+// matches any byte. Either decode or encode can be nil if the format can only be read or written.
+//
+// If a format with the same name has already been registered, it is replaced. The formats that
+// are registered last are checked first, so they can take over extensions from other formats.
+// For example, HEIF images could be read by running an external tool in decodeHEIF:
+//
+//	plates.RegisterFormat("heif", []string{".heic", ".heif"}, []string{"????ftypheic", "????ftypmif1"}, decodeHEIF, nil)
+func RegisterFormat(name string, extensions, magic []string, decode func(io.Reader) (image.Image, error), encode func(io.Writer, image.Image, *EncodeOptions) error) {
+	f := format{
+		name:   strings.ToLower(name),
+		magic:  append([]string(nil), magic...),
+		decode: decode,
+		encode: encode,
+	}
+	for _, ext := range extensions {
+		ext = strings.ToLower(ext)
+		if !strings.HasPrefix(ext, ".") {
+			ext = "." + ext
+		}
+		f.extensions = append(f.extensions, ext)
+	}
+	registryMutex.Lock()
+	defer registryMutex.Unlock()
+	updated := []format{f}
+	for _, existing := range registeredFormats() {
+		if existing.name != f.name {
+			updated = append(updated, existing)
+		}
+	}
+	registry.Store(updated)
+}
+
+// FormatInfo describes a registered image format
+type FormatInfo struct {
+	// Name is the name of the format, like "png"
+	Name string
+
+	// Extensions are the filename extensions for the format, like ".png"
+	Extensions []string
+
+	// CanDecode is true if images in this format can be read
+	CanDecode bool
+
+	// CanEncode is true if images in this format can be written
+	CanEncode bool
+}
+
+// Formats returns information about all the registered image formats, sorted by name.
+// This can be used for listing the supported formats in help text.
+func Formats() []FormatInfo {
+	var infos []FormatInfo
+	for _, f := range registeredFormats() {
+		infos = append(infos, FormatInfo{
+			Name:       f.name,
+			Extensions: append([]string(nil), f.extensions...),
+			CanDecode:  f.decode != nil,
+			CanEncode:  f.encode != nil,
+		})
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Name < infos[j].Name })
+	return infos
+}
+
+// EncodeOptions are options for encoding images.
+// Each option is only used by the format it is named after, except for Metadata,
+// and the zero value of an option gives the default behavior.
+type EncodeOptions struct {
+	// Metadata is written to JPEG, PNG, WebP and TIFF images, as far as each format supports it.
+	// PNG is the only format with text, and WebP has no resolution. The default is no metadata.
+	Metadata *Metadata
+
+	// JPEGQuality is the JPEG quality, from 1 to 100. The default is 75.
+	JPEGQuality int
+
+	// WebPLossless selects lossless WebP compression.
+	// When plates is built without cgo, or with the purego build tag,
+	// WebP images are always lossless and this option is not used.
+	WebPLossless bool
+
+	// WebPQuality is the quality of lossy WebP compression, from 1 to 100. The default is 90.
+	WebPQuality float32
+
+	// PNGCompression is the PNG compression level
+	PNGCompression png.CompressionLevel
+
+	// GIFNumColors is the maximum number of colors in a GIF image, from 1 to 256. The default is 256.
+	GIFNumColors int
+
+	// GIFQuantizer is used for making the GIF palette.
+	// The default is the Plan 9 palette, or the palette of the image if it is paletted.
+	GIFQuantizer draw.Quantizer
+
+	// GIFDrawer is used for converting the image to the GIF palette.
+	// The default is draw.FloydSteinberg, which dithers the image.
+	// Use draw.Src to only pick the nearest palette color for each pixel.
+	GIFDrawer draw.Drawer
+
+	// XPMName is the name of the image in the XPM C source. The default is "img".
+	XPMName string
+
+	// NetpbmPlain selects the plain (ASCII) variants of PBM, PGM and PPM
+	// instead of the binary variants. It is not used for PAM.
+	NetpbmPlain bool
+
+	// TIFFCompression is the TIFF compression. The default is no compression.
+	TIFFCompression TIFFCompression
+
+	// TGARLE selects run-length encoding for TGA images
+	TGARLE bool
+}
+
+func encodePNG(w io.Writer, m image.Image, opts *EncodeOptions) error {
+	enc := &png.Encoder{CompressionLevel: opts.PNGCompression}
+	return enc.Encode(w, m)
+}
+
+func encodeJPEG(w io.Writer, m image.Image, opts *EncodeOptions) error {
+	quality := jpeg.DefaultQuality
+	if opts.JPEGQuality > 0 {
+		quality = opts.JPEGQuality
+	}
+	return jpeg.Encode(w, m, &jpeg.Options{Quality: quality})
+}
+
+func encodeGIF(w io.Writer, m image.Image, opts *EncodeOptions) error {
+	numColors := 256
+	if opts.GIFNumColors > 0 {
+		numColors = opts.GIFNumColors
+	}
+	return gif.Encode(w, m, &gif.Options{NumColors: numColors, Quantizer: opts.GIFQuantizer, Drawer: opts.GIFDrawer})
+}
+
+func encodeBMP(w io.Writer, m image.Image, _ *EncodeOptions) error {
+	return bmp.Encode(w, m)
+}
+
+func encodeXPM(w io.Writer, m image.Image, opts *EncodeOptions) error {
+	name := "img"
+	if opts.XPMName != "" {
+		name = opts.XPMName
+	}
+	return xpm.NewEncoder(name).Encode(w, m)
+}
+
+// encodeNetpbm returns an encoder for the given kind of Netpbm image
+func encodeNetpbm(kind string) func(io.Writer, image.Image, *EncodeOptions) error {
+	return func(w io.Writer, m image.Image, opts *EncodeOptions) error {
+		return EncodeNetpbm(w, m, kind, opts.NetpbmPlain)
+	}
+}
+
+func encodeQOI(w io.Writer, m image.Image, _ *EncodeOptions) error {
+	return EncodeQOI(w, m)
+}
+
+func encodeFarbfeld(w io.Writer, m image.Image, _ *EncodeOptions) error {
+	return EncodeFarbfeld(w, m)
+}
+
+func encodeTGA(w io.Writer, m image.Image, opts *EncodeOptions) error {
+	return EncodeTGA(w, m, opts.TGARLE)
+}
+
+// formatByExtension returns the format for the extension of the given filename
+func formatByExtension(filename string) (*format, bool) {
+	ext := strings.ToLower(filepath.Ext(filename))
+	formats := registeredFormats()
+	for i := range formats {
+		for _, e := range formats[i].extensions {
+			if e == ext {
+				return &formats[i], true
+			}
+		}
+	}
+	return nil, false
+}
+
+// formatByName returns the format with the given name, like "png".
+// Extensions, with or without the leading dot, are also accepted as names.
+func formatByName(name string) (*format, bool) {
+	name = strings.ToLower(name)
+	formats := registeredFormats()
+	for i := range formats {
+		if formats[i].name == name {
+			return &formats[i], true
+		}
+	}
+	if !strings.HasPrefix(name, ".") {
+		name = "." + name
+	}
+	return formatByExtension(name)
+}
+
+// match checks if the given header starts with the magic byte sequence
+func match(magic string, header []byte) bool {
+	if len(header) < len(magic) {
+		return false
+	}
+	for i := 0; i < len(magic); i++ {
+		if magic[i] != '?' && magic[i] != header[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// matches checks if the given header starts with one of the magic byte sequences for f
+func (f *format) matches(header []byte) bool {
+	for _, magic := range f.magic {
+		if match(magic, header) {
+			return true
+		}
+	}
+	return false
+}
+
+// peekHeader returns the first bytes of r, without consuming them.
+// The header is long enough to be checked against all the known magic byte sequences,
+// unless r is shorter than that.
+func peekHeader(r *bufio.Reader) []byte {
+	n := 0
+	formats := registeredFormats()
+	for i := range formats {
+		for _, magic := range formats[i].magic {
+			if len(magic) > n {
+				n = len(magic)
+			}
+		}
+	}
+	// A short read is fine, the data may be shorter than the longest magic
+	header, _ := r.Peek(n)
+	return header
+}
+
+// sniff returns the format that the given header looks like
+func sniff(header []byte) (*format, bool) {
+	formats := registeredFormats()
+	for i := range formats {
+		if formats[i].matches(header) {
+			return &formats[i], true
+		}
+	}
+	return nil, false
+}
+
+// decodeAs decodes an image in the given format
+func decodeAs(f *format, r io.Reader) (image.Image, string, error) {
+	if f.decode == nil {
+		return nil, f.name, errors.New("decoding is not supported for the image format: " + f.name)
+	}
+	m, err := f.decode(r)
+	return m, f.name, err
+}
+
+// Decode decodes an image from r, by looking at the first bytes to find the format.
+// The built-in formats that can be recognized are PNG, JPEG, GIF, ICO, BMP, WebP, XPM,
+// Netpbm (PBM, PGM, PPM and PAM), TIFF, QOI and farbfeld, and formats can be added with RegisterFormat.
+// TGA images can not be recognized this way, use DecodeTGA instead.
+// The returned string is the name of the format, like "png".
+func Decode(r io.Reader) (image.Image, string, error) {
+	br := bufio.NewReader(r)
+	f, ok := sniff(peekHeader(br))
+	if !ok {
+		return nil, "", ErrUnknownFormat
+	}
+	return decodeAs(f, br)
+}
+
+// Encode writes the image m to w in the given format, like "png" or "jpeg".
+// The built-in formats are PNG, JPEG, GIF, ICO, BMP, WebP, XPM, Netpbm ("pbm", "pgm", "ppm" and "pam"),
+// TIFF, QOI, farbfeld and TGA, and formats can be added with RegisterFormat.
+// If opts is nil, the default options are used.
+func Encode(w io.Writer, m image.Image, format string, opts *EncodeOptions) error {
+	f, ok := formatByName(format)
+	if !ok {
+		return errors.New("unrecognized image format: " + format)
+	}
+	return encodeAs(f, w, m, opts)
+}
+
+// encodeAs encodes an image in the given format
+func encodeAs(f *format, w io.Writer, m image.Image, opts *EncodeOptions) error {
+	if f.encode == nil {
+		return errors.New("encoding is not supported for the image format: " + f.name)
+	}
+	if opts == nil {
+		opts = &EncodeOptions{}
+	}
+	addMetadata, ok := metadataWriters[f.name]
+	if opts.Metadata == nil || !ok {
+		return f.encode(w, m, opts)
+	}
+	// The metadata is added to the encoded image, since the encoders can not write it
+	var buf bytes.Buffer
+	if err := f.encode(&buf, m, opts); err != nil {
+		return err
+	}
+	data, err := addMetadata(buf.Bytes(), m, opts.Metadata)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
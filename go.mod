@@ -3,10 +3,10 @@ module github.com/xyproto/plates
 go 1.20
 
 require (
-	github.com/biessek/golang-ico v0.0.0-20250805151044-6d8ea19fb761
 	github.com/chai2010/webp v1.4.0
 	github.com/jsummers/gobmp v0.0.0-20230614200233-a9de23ed2e25
 	github.com/xyproto/xpm v1.3.0
+	golang.org/x/image v0.18.0
 )
 
 require (
@@ -0,0 +1,655 @@
+package plates
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+	"strings"
+	"sync"
+	"unicode/utf16"
+)
+
+// errICC is returned when an ICC profile could not be parsed
+var errICC = errors.New("invalid ICC profile")
+
+// iccD50 is the white point of the ICC profile connection space
+var iccD50 = [3]float64{0.9642, 1.0, 0.8249}
+
+// iccLUTSize is the number of steps in the lookup tables that are used for converting pixels
+const iccLUTSize = 1 << 16
+
+// iccMatrix is a 3x3 matrix that converts between color spaces
+type iccMatrix [3][3]float64
+
+// apply multiplies the matrix with a column vector
+func (m *iccMatrix) apply(v [3]float64) [3]float64 {
+	return [3]float64{
+		m[0][0]*v[0] + m[0][1]*v[1] + m[0][2]*v[2],
+		m[1][0]*v[0] + m[1][1]*v[1] + m[1][2]*v[2],
+		m[2][0]*v[0] + m[2][1]*v[1] + m[2][2]*v[2],
+	}
+}
+
+// mul returns the matrix product m * n
+func (m *iccMatrix) mul(n *iccMatrix) iccMatrix {
+	var p iccMatrix
+	for i := 0; i < 3; i++ {
+		for j := 0; j < 3; j++ {
+			p[i][j] = m[i][0]*n[0][j] + m[i][1]*n[1][j] + m[i][2]*n[2][j]
+		}
+	}
+	return p
+}
+
+// det returns the determinant of the matrix
+func (m *iccMatrix) det() float64 {
+	return m[0][0]*(m[1][1]*m[2][2]-m[1][2]*m[2][1]) -
+		m[0][1]*(m[1][0]*m[2][2]-m[1][2]*m[2][0]) +
+		m[0][2]*(m[1][0]*m[2][1]-m[1][1]*m[2][0])
+}
+
+// inverse returns the inverse of the matrix, which must not be singular
+func (m *iccMatrix) inverse() iccMatrix {
+	det := m.det()
+	return iccMatrix{
+		{(m[1][1]*m[2][2] - m[1][2]*m[2][1]) / det, (m[0][2]*m[2][1] - m[0][1]*m[2][2]) / det, (m[0][1]*m[1][2] - m[0][2]*m[1][1]) / det},
+		{(m[1][2]*m[2][0] - m[1][0]*m[2][2]) / det, (m[0][0]*m[2][2] - m[0][2]*m[2][0]) / det, (m[0][2]*m[1][0] - m[0][0]*m[1][2]) / det},
+		{(m[1][0]*m[2][1] - m[1][1]*m[2][0]) / det, (m[0][1]*m[2][0] - m[0][0]*m[2][1]) / det, (m[0][0]*m[1][1] - m[0][1]*m[1][0]) / det},
+	}
+}
+
+// iccCurve is a tone reproduction curve, which converts an encoded value (0 to 1) to linear light
+type iccCurve struct {
+	// table has the values of a sampled curve, which are interpolated.
+	// If it is empty, the parametric curve is used instead.
+	table []float64
+	// kind is the parametric function type, from 0 to 4, with the parameters g, a, b, c, d, e and f
+	kind   int
+	params [7]float64
+}
+
+// eval returns the linear light value for the encoded value x
+func (c *iccCurve) eval(x float64) float64 {
+	x = math.Max(0, math.Min(1, x))
+	if len(c.table) > 0 {
+		if len(c.table) == 1 {
+			return c.table[0]
+		}
+		pos := x * float64(len(c.table)-1)
+		i := int(pos)
+		if i >= len(c.table)-1 {
+			return c.table[len(c.table)-1]
+		}
+		return c.table[i] + (c.table[i+1]-c.table[i])*(pos-float64(i))
+	}
+	g, a, b, cc, d, e, f := c.params[0], c.params[1], c.params[2], c.params[3], c.params[4], c.params[5], c.params[6]
+	var y float64
+	switch c.kind {
+	case 0:
+		y = math.Pow(x, g)
+	case 1:
+		if a*x+b >= 0 {
+			y = math.Pow(a*x+b, g)
+		}
+	case 2:
+		y = cc
+		if a*x+b >= 0 {
+			y += math.Pow(a*x+b, g)
+		}
+	case 3:
+		y = cc * x
+		if x >= d {
+			y = math.Pow(a*x+b, g)
+		}
+	case 4:
+		y = cc*x + f
+		if x >= d {
+			y = math.Pow(a*x+b, g) + e
+		}
+	}
+	return math.Max(0, math.Min(1, y))
+}
+
+// inverseTable returns a table with iccLUTSize+1 encoded values for evenly spaced linear light values.
+// The curve is sampled and inverted by walking along it, which works for curves that never decrease.
+func (c *iccCurve) inverseTable() []float64 {
+	var (
+		inverse = make([]float64, iccLUTSize+1)
+		prevX   = 0.0
+		prevY   = c.eval(0)
+		i       = 1
+	)
+	for j := range inverse {
+		t := float64(j) / iccLUTSize
+		y := c.eval(float64(i) / iccLUTSize)
+		for y < t && i < iccLUTSize {
+			prevX, prevY = float64(i)/iccLUTSize, y
+			i++
+			y = c.eval(float64(i) / iccLUTSize)
+		}
+		x := float64(i) / iccLUTSize
+		switch {
+		case t <= prevY:
+			inverse[j] = prevX
+		case y <= t || y == prevY:
+			inverse[j] = x
+		default:
+			inverse[j] = prevX + (x-prevX)*(t-prevY)/(y-prevY)
+		}
+	}
+	return inverse
+}
+
+// ICCProfile is an ICC color profile that describes an RGB or grayscale color space
+// with tone reproduction curves and, for RGB, a matrix to CIE XYZ.
+// Profiles with lookup tables, and CMYK profiles, are not supported.
+type ICCProfile struct {
+	// Description is the name of the profile, like "sRGB"
+	Description string
+
+	// Gray is true for grayscale profiles
+	Gray bool
+
+	data   []byte
+	matrix iccMatrix // from linear RGB to XYZ, relative to D50
+	curves [3]iccCurve
+
+	once    sync.Once
+	inverse [3][]float64
+}
+
+// Bytes returns the encoded profile, which can be used as Metadata.ICC.
+// The returned slice must not be modified.
+func (p *ICCProfile) Bytes() []byte {
+	return p.data
+}
+
+// String returns the description of the profile
+func (p *ICCProfile) String() string {
+	return p.Description
+}
+
+// inverseTables returns the inverse curves of the profile, which are calculated the first time
+func (p *ICCProfile) inverseTables() [3][]float64 {
+	p.once.Do(func() {
+		for i := range p.curves {
+			if i > 0 && p.Gray {
+				break
+			}
+			p.inverse[i] = p.curves[i].inverseTable()
+		}
+	})
+	return p.inverse
+}
+
+// ParseICCProfile parses an ICC profile, for example from Metadata.ICC.
+// RGB profiles must have red, green and blue colorants and tone reproduction curves,
+// and grayscale profiles must have a gray tone reproduction curve.
+func ParseICCProfile(data []byte) (*ICCProfile, error) {
+	if len(data) < 132 || string(data[36:40]) != "acsp" {
+		return nil, errICC
+	}
+	if size := int(binary.BigEndian.Uint32(data)); size < 132 || size > len(data) {
+		return nil, fmt.Errorf("%w: invalid size", errICC)
+	}
+	var (
+		space = string(data[16:20])
+		pcs   = string(data[20:24])
+		n     = int(binary.BigEndian.Uint32(data[128:]))
+		tags  = make(map[string][]byte)
+	)
+	if n > (len(data)-132)/12 {
+		return nil, fmt.Errorf("%w: invalid tag count", errICC)
+	}
+	for i := 0; i < n; i++ {
+		entry := data[132+12*i:]
+		offset, size := int(binary.BigEndian.Uint32(entry[4:])), int(binary.BigEndian.Uint32(entry[8:]))
+		if offset < 0 || size < 8 || offset > len(data)-size {
+			return nil, fmt.Errorf("%w: invalid tag", errICC)
+		}
+		tags[string(entry[:4])] = data[offset : offset+size]
+	}
+	if pcs != "XYZ " || (space != "RGB " && space != "GRAY") {
+		return nil, fmt.Errorf("%w: unsupported color space %q with connection space %q", errICC, strings.TrimSpace(space), strings.TrimSpace(pcs))
+	}
+	p := &ICCProfile{
+		Description: iccText(tags["desc"]),
+		Gray:        space == "GRAY",
+		data:        append([]byte(nil), data...),
+	}
+	if p.Gray {
+		curve, err := iccParseCurve(tags["kTRC"])
+		if err != nil {
+			return nil, err
+		}
+		p.curves[0] = curve
+		return p, nil
+	}
+	for i, channel := range []string{"r", "g", "b"} {
+		xyz, err := iccParseXYZ(tags[channel+"XYZ"])
+		if err != nil {
+			return nil, err
+		}
+		for j := range xyz {
+			p.matrix[j][i] = xyz[j]
+		}
+		if p.curves[i], err = iccParseCurve(tags[channel+"TRC"]); err != nil {
+			return nil, err
+		}
+	}
+	if p.matrix.det() == 0 {
+		return nil, fmt.Errorf("%w: the colorants can not be inverted", errICC)
+	}
+	return p, nil
+}
+
+// s15Fixed16 converts a signed 15.16 fixed-point number
+func s15Fixed16(b []byte) float64 {
+	return float64(int32(binary.BigEndian.Uint32(b))) / 65536
+}
+
+// iccParseXYZ parses an XYZ tag with a single XYZ number
+func iccParseXYZ(tag []byte) ([3]float64, error) {
+	if len(tag) < 20 || string(tag[:4]) != "XYZ " {
+		return [3]float64{}, fmt.Errorf("%w: missing or invalid colorant", errICC)
+	}
+	return [3]float64{s15Fixed16(tag[8:]), s15Fixed16(tag[12:]), s15Fixed16(tag[16:])}, nil
+}
+
+// iccParamCounts is the number of parameters for each parametric curve type
+var iccParamCounts = []int{1, 3, 4, 5, 7}
+
+// iccParseCurve parses a curv or para tag
+func iccParseCurve(tag []byte) (iccCurve, error) {
+	var c iccCurve
+	if len(tag) < 12 {
+		return c, fmt.Errorf("%w: missing or invalid tone reproduction curve", errICC)
+	}
+	switch string(tag[:4]) {
+	case "curv":
+		n := int(binary.BigEndian.Uint32(tag[8:]))
+		if n > (len(tag)-12)/2 {
+			return c, fmt.Errorf("%w: invalid curve", errICC)
+		}
+		switch n {
+		case 0:
+			// The identity curve
+			c.params[0] = 1
+		case 1:
+			// A gamma value, as an unsigned 8.8 fixed-point number
+			c.params[0] = float64(binary.BigEndian.Uint16(tag[12:])) / 256
+		default:
+			c.table = make([]float64, n)
+			for i := range c.table {
+				c.table[i] = float64(binary.BigEndian.Uint16(tag[12+2*i:])) / 65535
+			}
+		}
+		return c, nil
+	case "para":
+		c.kind = int(binary.BigEndian.Uint16(tag[8:]))
+		if c.kind >= len(iccParamCounts) || len(tag) < 12+4*iccParamCounts[c.kind] {
+			return c, fmt.Errorf("%w: invalid parametric curve", errICC)
+		}
+		for i := 0; i < iccParamCounts[c.kind]; i++ {
+			c.params[i] = s15Fixed16(tag[12+4*i:])
+		}
+		return c, nil
+	}
+	return c, fmt.Errorf("%w: unsupported curve type %q", errICC, tag[:4])
+}
+
+// iccText returns the English text of a desc (ICC version 2) or mluc (ICC version 4) tag
+func iccText(tag []byte) string {
+	if len(tag) < 12 {
+		return ""
+	}
+	switch string(tag[:4]) {
+	case "desc":
+		n := int(binary.BigEndian.Uint32(tag[8:]))
+		if n > len(tag)-12 {
+			return ""
+		}
+		return string(bytes.TrimRight(tag[12:12+n], "\x00"))
+	case "mluc":
+		n, recordSize := int(binary.BigEndian.Uint32(tag[8:])), int(binary.BigEndian.Uint32(tag[12:]))
+		if n < 1 || recordSize < 12 || len(tag) < 16+recordSize {
+			return ""
+		}
+		// The first record is used, which is normally English
+		length, offset := int(binary.BigEndian.Uint32(tag[20:])), int(binary.BigEndian.Uint32(tag[24:]))
+		if offset < 0 || length < 0 || offset > len(tag)-length {
+			return ""
+		}
+		units := make([]uint16, length/2)
+		for i := range units {
+			units[i] = binary.BigEndian.Uint16(tag[offset+2*i:])
+		}
+		return string(utf16.Decode(units))
+	}
+	return ""
+}
+
+// iccBuilder collects tags for an ICC profile, in the order they are added
+type iccBuilder struct {
+	sigs []string
+	data [][]byte
+}
+
+// add adds a tag
+func (b *iccBuilder) add(sig string, data []byte) {
+	b.sigs = append(b.sigs, sig)
+	b.data = append(b.data, data)
+}
+
+// bytes returns the profile, with the given color space, like "RGB " or "GRAY".
+// Tags with the same data share the data in the profile.
+func (b *iccBuilder) bytes(space string) []byte {
+	var (
+		header = make([]byte, 128)
+		table  = binary.BigEndian.AppendUint32(nil, uint32(len(b.sigs)))
+		body   []byte
+		start  = 128 + 4 + 12*len(b.sigs)
+		shared = make(map[string]int)
+	)
+	for i, sig := range b.sigs {
+		offset, ok := shared[string(b.data[i])]
+		if !ok {
+			offset = start + len(body)
+			shared[string(b.data[i])] = offset
+			body = append(body, b.data[i]...)
+			// Tags start at offsets that are multiples of 4
+			for len(body)%4 != 0 {
+				body = append(body, 0)
+			}
+		}
+		table = append(table, sig...)
+		table = binary.BigEndian.AppendUint32(table, uint32(offset))
+		table = binary.BigEndian.AppendUint32(table, uint32(len(b.data[i])))
+	}
+	binary.BigEndian.PutUint32(header, uint32(start+len(body)))
+	binary.BigEndian.PutUint32(header[8:], 0x04300000) // version 4.3
+	copy(header[12:], "mntr")
+	copy(header[16:], space)
+	copy(header[20:], "XYZ ")
+	// The creation date, which is fixed so that the profile is always the same
+	for i, v := range []uint16{2024, 1, 1, 0, 0, 0} {
+		binary.BigEndian.PutUint16(header[24+2*i:], v)
+	}
+	copy(header[36:], "acsp")
+	copy(header[68:], iccXYZ(iccD50)[8:])
+	profile := append(header, table...)
+	return append(profile, body...)
+}
+
+// iccFixed returns a signed 15.16 fixed-point number
+func iccFixed(v float64) []byte {
+	return binary.BigEndian.AppendUint32(nil, uint32(int32(math.Round(v*65536))))
+}
+
+// iccXYZ returns an XYZ tag
+func iccXYZ(xyz [3]float64) []byte {
+	tag := []byte("XYZ \x00\x00\x00\x00")
+	for _, v := range xyz {
+		tag = append(tag, iccFixed(v)...)
+	}
+	return tag
+}
+
+// iccMLUC returns an mluc tag with an English text
+func iccMLUC(text string) []byte {
+	units := utf16.Encode([]rune(text))
+	tag := []byte("mluc\x00\x00\x00\x00\x00\x00\x00\x01\x00\x00\x00\x0cenUS")
+	tag = binary.BigEndian.AppendUint32(tag, uint32(2*len(units)))
+	tag = binary.BigEndian.AppendUint32(tag, 28)
+	for _, u := range units {
+		tag = binary.BigEndian.AppendUint16(tag, u)
+	}
+	return tag
+}
+
+// iccPara returns a parametric curve tag
+func iccPara(kind int, params ...float64) []byte {
+	tag := []byte("para\x00\x00\x00\x00")
+	tag = binary.BigEndian.AppendUint16(tag, uint16(kind))
+	tag = append(tag, 0, 0)
+	for _, v := range params {
+		tag = append(tag, iccFixed(v)...)
+	}
+	return tag
+}
+
+// xyToXYZ converts CIE xy chromaticity coordinates to XYZ with Y = 1
+func xyToXYZ(x, y float64) [3]float64 {
+	return [3]float64{x / y, 1, (1 - x - y) / y}
+}
+
+// bradford is the Bradford matrix, which is used for chromatic adaptation
+var bradford = iccMatrix{
+	{0.8951, 0.2664, -0.1614},
+	{-0.7502, 1.7135, 0.0367},
+	{0.0389, -0.0685, 1.0296},
+}
+
+// adaptation returns the matrix that adapts XYZ colors from one white point to another
+func adaptation(from, to [3]float64) iccMatrix {
+	var (
+		src   = bradford.apply(from)
+		dst   = bradford.apply(to)
+		scale iccMatrix
+		inv   = bradford.inverse()
+	)
+	for i := 0; i < 3; i++ {
+		scale[i][i] = dst[i] / src[i]
+	}
+	m := inv.mul(&scale)
+	return m.mul(&bradford)
+}
+
+// newRGBProfile creates an ICC profile from the xy chromaticities of the red, green
+// and blue primaries and the white point, together with a parametric curve tag
+func newRGBProfile(description string, primaries [4][2]float64, curve []byte) *ICCProfile {
+	var (
+		white = xyToXYZ(primaries[3][0], primaries[3][1])
+		rgb   iccMatrix
+	)
+	for i := 0; i < 3; i++ {
+		xyz := xyToXYZ(primaries[i][0], primaries[i][1])
+		for j := range xyz {
+			rgb[j][i] = xyz[j]
+		}
+	}
+	// Scale the primaries so that they add up to the white point, and adapt them to D50
+	inv := rgb.inverse()
+	scale := inv.apply(white)
+	for i := 0; i < 3; i++ {
+		for j := 0; j < 3; j++ {
+			rgb[j][i] *= scale[i]
+		}
+	}
+	chad := adaptation(white, iccD50)
+	rgb = chad.mul(&rgb)
+
+	var b iccBuilder
+	b.add("desc", iccMLUC(description))
+	b.add("cprt", iccMLUC("No copyright, use freely"))
+	b.add("wtpt", iccXYZ(iccD50))
+	chadTag := []byte("sf32\x00\x00\x00\x00")
+	for i := 0; i < 3; i++ {
+		for j := 0; j < 3; j++ {
+			chadTag = append(chadTag, iccFixed(chad[i][j])...)
+		}
+	}
+	b.add("chad", chadTag)
+	for i, channel := range []string{"r", "g", "b"} {
+		b.add(channel+"XYZ", iccXYZ([3]float64{rgb[0][i], rgb[1][i], rgb[2][i]}))
+	}
+	for _, channel := range []string{"r", "g", "b"} {
+		b.add(channel+"TRC", curve)
+	}
+	p, err := ParseICCProfile(b.bytes("RGB "))
+	if err != nil {
+		panic(err)
+	}
+	return p
+}
+
+// The chromaticity of the D65 white point
+var d65xy = [2]float64{0.3127, 0.3290}
+
+// The sRGB tone reproduction curve, which is also used by Display P3
+var srgbCurve = iccPara(3, 2.4, 1/1.055, 0.055/1.055, 1/12.92, 0.04045)
+
+var (
+	// SRGBProfile is the sRGB color space, which is what images without an ICC profile are assumed to use
+	SRGBProfile = newRGBProfile("sRGB", [4][2]float64{{0.64, 0.33}, {0.30, 0.60}, {0.15, 0.06}, d65xy}, srgbCurve)
+
+	// DisplayP3Profile is the Display P3 color space, which is used by many phones
+	DisplayP3Profile = newRGBProfile("Display P3", [4][2]float64{{0.680, 0.320}, {0.265, 0.690}, {0.150, 0.060}, d65xy}, srgbCurve)
+
+	// AdobeRGBProfile is the Adobe RGB (1998) color space
+	AdobeRGBProfile = newRGBProfile("Adobe RGB (1998)", [4][2]float64{{0.64, 0.33}, {0.21, 0.71}, {0.15, 0.06}, d65xy}, iccPara(0, 563.0/256))
+)
+
+// sameProfile checks if two profiles describe the same color space
+func sameProfile(a, b *ICCProfile) bool {
+	return a == b || bytes.Equal(a.data, b.data)
+}
+
+// ConvertProfile converts the colors of m from the color space of one ICC profile to another,
+// with the relative colorimetric rendering intent, where colors outside of the target color space are clipped.
+// Images with 16-bit channels give an *image.NRGBA64 and other images give an *image.NRGBA,
+// or *image.Gray16 and *image.Gray if the target profile is a grayscale profile.
+// If the profiles are the same, m is returned as it is.
+//
+// To do the color math of for example Separate3 in sRGB, convert the image from the profile in
+// Metadata.ICC to SRGBProfile, and convert the result back afterwards to keep the original color space.
+func ConvertProfile(m image.Image, from, to *ICCProfile, opts ...Option) image.Image {
+	newImage, _ := ConvertProfileContext(context.Background(), m, from, to, opts...)
+	return newImage
+}
+
+// ConvertProfileContext is like ConvertProfile, but stops and returns the error from ctx if ctx is done
+// before all rows have been processed.
+func ConvertProfileContext(ctx context.Context, m image.Image, from, to *ICCProfile, opts ...Option) (image.Image, error) {
+	if sameProfile(from, to) {
+		return m, nil
+	}
+	// The combined matrix goes from linear source RGB to linear target RGB, through XYZ.
+	// Gray is converted to and from XYZ as the D50 white point scaled by the gray value.
+	var (
+		combined iccMatrix
+		toInv    = to.matrix.inverse()
+		inverse  = to.inverseTables()
+		rect     = m.Bounds()
+		read     = newRowReader64(m, rect)
+		deep     = is16Bit(m)
+		maxValue = 255.0
+		shift    = uint(8)
+	)
+	switch {
+	case from.Gray && to.Gray:
+		combined[0][0] = 1
+	case from.Gray:
+		rgb := toInv.apply(iccD50)
+		for i := 0; i < 3; i++ {
+			combined[i][0] = rgb[i]
+		}
+	case to.Gray:
+		// The luminance is the Y row of the matrix to XYZ
+		combined[0] = from.matrix[1]
+	default:
+		combined = toInv.mul(&from.matrix)
+	}
+	if deep {
+		maxValue, shift = 65535, 0
+	}
+	// The source curves are turned into lookup tables for every possible channel value
+	var lut [3][]float64
+	for i := range lut {
+		curve := &from.curves[i]
+		if from.Gray {
+			curve = &from.curves[0]
+		}
+		lut[i] = make([]float64, int(maxValue)+1)
+		for v := range lut[i] {
+			lut[i][v] = curve.eval(float64(v) / maxValue)
+		}
+	}
+	encode := func(i int, v float64) float64 {
+		v = math.Max(0, math.Min(1, v)) * iccLUTSize
+		j := int(v)
+		if j >= iccLUTSize {
+			return math.Round(inverse[i][iccLUTSize] * maxValue)
+		}
+		return math.Round((inverse[i][j] + (inverse[i][j+1]-inverse[i][j])*(v-float64(j))) * maxValue)
+	}
+
+	// put stores the converted color and the 16-bit alpha of the pixel at x, y in the new image
+	var (
+		dstRect  = image.Rect(0, 0, rect.Dx(), rect.Dy())
+		newImage image.Image
+		put      func(x, y int, c [3]float64, a uint16)
+	)
+	switch {
+	case to.Gray && deep:
+		dst := image.NewGray16(dstRect)
+		newImage = dst
+		put = func(x, y int, c [3]float64, _ uint16) {
+			binary.BigEndian.PutUint16(dst.Pix[dst.PixOffset(x, y):], uint16(c[0]))
+		}
+	case to.Gray:
+		dst := image.NewGray(dstRect)
+		newImage = dst
+		put = func(x, y int, c [3]float64, _ uint16) {
+			dst.Pix[dst.PixOffset(x, y)] = uint8(c[0])
+		}
+	case deep:
+		dst := image.NewNRGBA64(dstRect)
+		newImage = dst
+		put = func(x, y int, c [3]float64, a uint16) {
+			put64(dst.Pix[dst.PixOffset(x, y):], color.RGBA64{uint16(c[0]), uint16(c[1]), uint16(c[2]), a})
+		}
+	default:
+		dst := image.NewNRGBA(dstRect)
+		newImage = dst
+		put = func(x, y int, c [3]float64, a uint16) {
+			pix := dst.Pix[dst.PixOffset(x, y):]
+			pix[0], pix[1], pix[2], pix[3] = uint8(c[0]), uint8(c[1]), uint8(c[2]), uint8(a>>8)
+		}
+	}
+	err := eachRow(ctx, newConfig(opts), rect, 8*rect.Dx(), func(y int, buf []uint8) {
+		read(y, buf)
+		for x, i := 0, 0; i < len(buf); x, i = x+1, i+8 {
+			var (
+				c       = get64(buf[i:])
+				r, g, b int
+			)
+			if c.A != 0 {
+				r, g, b = int(unpremultiply16(c.R, c.A)>>shift), int(unpremultiply16(c.G, c.A)>>shift), int(unpremultiply16(c.B, c.A)>>shift)
+			}
+			out := combined.apply([3]float64{lut[0][r], lut[1][g], lut[2][b]})
+			if to.Gray {
+				put(x, y-rect.Min.Y, [3]float64{encode(0, out[0])}, c.A)
+			} else {
+				put(x, y-rect.Min.Y, [3]float64{encode(0, out[0]), encode(1, out[1]), encode(2, out[2])}, c.A)
+			}
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return newImage, nil
+}
+
+// unpremultiply16 returns the 16-bit color value v, premultiplied with the alpha a, without the alpha
+func unpremultiply16(v, a uint16) uint16 {
+	if a == 0xffff {
+		return v
+	}
+	return uint16(uint32(v) * 0xffff / uint32(a))
+}
@@ -0,0 +1,152 @@
+package plates
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"image"
+	"image/color"
+	"path/filepath"
+	"testing"
+)
+
+// closeColor checks if every channel of two colors differ by at most 2. The ICC profiles store
+// numbers with 16 fractional bits, and the Adobe RGB curve is steep for dark colors.
+func closeColor(a, b color.NRGBA) bool {
+	return absdiff(a.R, b.R) <= 2 && absdiff(a.G, b.G) <= 2 && absdiff(a.B, b.B) <= 2 && a.A == b.A
+}
+
+func TestParseICCProfile(t *testing.T) {
+	for _, p := range []*ICCProfile{SRGBProfile, DisplayP3Profile, AdobeRGBProfile} {
+		parsed, err := ParseICCProfile(p.Bytes())
+		if err != nil {
+			t.Fatalf("%s: %v", p, err)
+		}
+		if parsed.Description != p.Description || parsed.Gray || parsed.matrix != p.matrix {
+			t.Errorf("%s: expected the parsed profile to be the same, got %q", p, parsed.Description)
+		}
+		// The green colorant of a display profile has the most luminance, and the colorants add up to D50
+		var white [3]float64
+		for i := 0; i < 3; i++ {
+			white[i] = p.matrix[i][0] + p.matrix[i][1] + p.matrix[i][2]
+		}
+		for i := range white {
+			if d := white[i] - iccD50[i]; d > 0.001 || d < -0.001 {
+				t.Errorf("%s: expected the white point to be D50, got %v", p, white)
+			}
+		}
+	}
+	if SRGBProfile.matrix[1][1] < SRGBProfile.matrix[1][0] {
+		t.Error("Expected green to be brighter than red")
+	}
+	cmyk := append([]byte(nil), SRGBProfile.Bytes()...)
+	copy(cmyk[16:], "CMYK")
+	for _, data := range [][]byte{nil, SRGBProfile.Bytes()[:200], cmyk} {
+		if _, err := ParseICCProfile(data); !errors.Is(err, errICC) {
+			t.Errorf("Expected an invalid ICC profile error, got %v", err)
+		}
+	}
+	desc := []byte("desc\x00\x00\x00\x00\x00\x00\x00\x05Gray\x00")
+	if text := iccText(desc); text != "Gray" {
+		t.Errorf("Expected an ICC version 2 description, got %q", text)
+	}
+}
+
+func TestConvertProfile(t *testing.T) {
+	m := image.NewNRGBA(image.Rect(5, 5, 10, 6))
+	colors := []color.NRGBA{{255, 0, 0, 255}, {0, 255, 0, 128}, {255, 255, 255, 255}, {0, 0, 0, 255}, {10, 100, 200, 255}}
+	for i, c := range colors {
+		m.SetNRGBA(5+i, 5, c)
+	}
+	if ConvertProfile(m, SRGBProfile, SRGBProfile) != image.Image(m) {
+		t.Error("Expected the same profile to leave the image as it is")
+	}
+	adobe := ConvertProfile(m, SRGBProfile, AdobeRGBProfile).(*image.NRGBA)
+	if adobe.Bounds() != image.Rect(0, 0, 5, 1) {
+		t.Errorf("Expected the converted image to start at (0, 0), got %v", adobe.Bounds())
+	}
+	// These are the sRGB colors in Adobe RGB (1998), as converted by other color management systems
+	for i, expected := range []color.NRGBA{{219, 0, 0, 255}, {144, 255, 60, 128}, {255, 255, 255, 255}, {0, 0, 0, 255}} {
+		if c := adobe.NRGBAAt(i, 0); !closeColor(c, expected) {
+			t.Errorf("Expected %v in Adobe RGB to be %v, got %v", colors[i], expected, c)
+		}
+	}
+	if c := ConvertProfile(m, SRGBProfile, DisplayP3Profile).(*image.NRGBA).NRGBAAt(0, 0); !closeColor(c, color.NRGBA{234, 51, 35, 255}) {
+		t.Errorf("Expected sRGB red in Display P3 to be (234, 51, 35), got %v", c)
+	}
+	back := ConvertProfile(adobe, AdobeRGBProfile, SRGBProfile).(*image.NRGBA)
+	for i, c := range colors {
+		if converted := back.NRGBAAt(i, 0); !closeColor(converted, c) {
+			t.Errorf("Expected %v to convert back, got %v", c, converted)
+		}
+	}
+
+	// A grayscale profile with linear light values
+	var b iccBuilder
+	b.add("desc", iccMLUC("Linear gray"))
+	b.add("kTRC", iccPara(0, 1))
+	linearGray, err := ParseICCProfile(b.bytes("GRAY"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !linearGray.Gray || linearGray.Description != "Linear gray" {
+		t.Errorf("Expected a grayscale profile, got %q", linearGray)
+	}
+	gray := image.NewGray(image.Rect(0, 0, 1, 1))
+	gray.Pix[0] = 128
+	if c := ConvertProfile(gray, linearGray, SRGBProfile).At(0, 0).(color.NRGBA); !closeColor(c, color.NRGBA{188, 188, 188, 255}) {
+		t.Errorf("Expected linear gray to be brighter in sRGB, got %v", c)
+	}
+	if c := ConvertProfile(m, SRGBProfile, linearGray).At(2, 0); c != (color.Gray{255}) {
+		t.Errorf("Expected white to stay white, got %v", c)
+	}
+	deep := image.NewNRGBA64(image.Rect(0, 0, 1, 1))
+	deep.SetNRGBA64(0, 0, color.NRGBA64{0xffff, 0, 0, 0xffff})
+	if c := ConvertProfile(deep, SRGBProfile, AdobeRGBProfile).At(0, 0).(color.NRGBA64); c.R>>8 < 218 || c.R>>8 > 219 || c.G > 0x300 {
+		t.Errorf("Expected 16-bit sRGB red in Adobe RGB, got %v", c)
+	}
+}
+
+func TestConvertProfileContext(t *testing.T) {
+	for name, m := range randomImages(17, 13) {
+		expected := ConvertProfile(m, SRGBProfile, AdobeRGBProfile, Workers(1))
+		for _, n := range []int{2, 5} {
+			same(t, name, expected, ConvertProfile(m, SRGBProfile, AdobeRGBProfile, Workers(n)))
+		}
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := ConvertProfileContext(ctx, randomImages(8, 8)["RGBA"], SRGBProfile, AdobeRGBProfile); err != context.Canceled {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+}
+
+func TestReadWorkingSpace(t *testing.T) {
+	var (
+		m        = image.NewNRGBA(image.Rect(0, 0, 2, 2))
+		filename = filepath.Join(t.TempDir(), "adobe.png")
+	)
+	for i := 0; i < len(m.Pix); i += 4 {
+		copy(m.Pix[i:], []uint8{219, 0, 0, 255})
+	}
+	if err := Write(filename, m, &EncodeOptions{Metadata: &Metadata{ICC: AdobeRGBProfile.Bytes()}}); err != nil {
+		t.Fatal(err)
+	}
+	read, md, err := ReadWithMetadata(filename, &ReadOptions{WorkingSpace: SRGBProfile})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c := color.NRGBAModel.Convert(read.At(0, 0)).(color.NRGBA); !closeColor(c, color.NRGBA{255, 0, 0, 255}) {
+		t.Errorf("Expected Adobe RGB red to be converted to sRGB red, got %v", c)
+	}
+	if !bytes.Equal(md.ICC, SRGBProfile.Bytes()) {
+		t.Error("Expected the ICC profile to be the sRGB profile")
+	}
+	read, err = Read(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c := color.NRGBAModel.Convert(read.At(0, 0)).(color.NRGBA); c != (color.NRGBA{219, 0, 0, 255}) {
+		t.Errorf("Expected the colors to be left as they are without a working space, got %v", c)
+	}
+}
@@ -0,0 +1,458 @@
+package plates
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"math/bits"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// errICO is returned when an ICO image could not be decoded
+var errICO = errors.New("invalid ICO image")
+
+// ICOSizes are the sizes that WriteICO uses if no sizes are given
+var ICOSizes = []int{16, 24, 32, 48, 64, 128, 256}
+
+// Sizes of the ICO structures
+const (
+	icoHeaderSize    = 6
+	icoEntrySize     = 16
+	icoDIBHeaderSize = 40
+	icoMaxSize       = 256
+	// icoPNGSize is the smallest size that is stored as PNG instead of as a bitmap
+	icoPNGSize = 128
+)
+
+// ICOEntry is one of the images in an ICO file
+type ICOEntry struct {
+	// Image is the image, which is an *image.NRGBA for bitmap entries
+	Image image.Image
+
+	// BitDepth is the number of bits per pixel, like 32 for 8-bit RGBA or 8 for 256 colors
+	BitDepth int
+
+	// PNG is true if the entry is stored as a PNG image instead of as a bitmap
+	PNG bool
+}
+
+// DecodeICOAll decodes all the images in an ICO file from r, in the order they are stored.
+// Both bitmap entries, with 1, 4, 8, 16, 24 or 32 bits per pixel, and PNG entries are supported.
+func DecodeICOAll(r io.Reader) ([]ICOEntry, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < icoHeaderSize || binary.LittleEndian.Uint16(data) != 0 || binary.LittleEndian.Uint16(data[2:]) != 1 {
+		return nil, errICO
+	}
+	n := int(binary.LittleEndian.Uint16(data[4:]))
+	if n == 0 || len(data) < icoHeaderSize+n*icoEntrySize {
+		return nil, fmt.Errorf("%w: invalid number of images: %d", errICO, n)
+	}
+	entries := make([]ICOEntry, n)
+	for i := range entries {
+		dir := data[icoHeaderSize+i*icoEntrySize:]
+		size, offset := int(binary.LittleEndian.Uint32(dir[8:])), int(binary.LittleEndian.Uint32(dir[12:]))
+		if offset < 0 || size < 0 || offset > len(data) || size > len(data)-offset {
+			return nil, fmt.Errorf("%w: image %d is outside of the file", errICO, i)
+		}
+		entry := data[offset : offset+size]
+		if bytes.HasPrefix(entry, []byte(pngHeader)) {
+			m, err := png.Decode(bytes.NewReader(entry))
+			if err != nil {
+				return nil, fmt.Errorf("%w: image %d: %v", errICO, i, err)
+			}
+			entries[i] = ICOEntry{Image: m, BitDepth: pngBitDepth(entry), PNG: true}
+			continue
+		}
+		m, depth, err := decodeICOBitmap(entry)
+		if err != nil {
+			return nil, fmt.Errorf("%w: image %d: %v", errICO, i, err)
+		}
+		entries[i] = ICOEntry{Image: m, BitDepth: depth}
+	}
+	return entries, nil
+}
+
+// pngHeader is the signature at the start of every PNG image
+const pngHeader = "\x89PNG\r\n\x1a\n"
+
+// pngBitDepth returns the number of bits per pixel of a PNG image, from the IHDR chunk
+func pngBitDepth(data []byte) int {
+	if len(data) < 26 {
+		return 0
+	}
+	depth := int(data[24])
+	switch data[25] {
+	case 2: // RGB
+		return 3 * depth
+	case 4: // gray and alpha
+		return 2 * depth
+	case 6: // RGBA
+		return 4 * depth
+	}
+	return depth
+}
+
+// bitfield is the position of a channel in the pixels of a 16-bit or 32-bit bitmap
+type bitfield struct {
+	shift, bits uint
+}
+
+// newBitfield returns the bitfield for a mask, or false if the bits of the mask are not next to each other
+func newBitfield(mask uint32) (bitfield, bool) {
+	if mask == 0 {
+		return bitfield{}, true
+	}
+	f := bitfield{uint(bits.TrailingZeros32(mask)), uint(bits.OnesCount32(mask))}
+	return f, uint64(mask>>f.shift) == uint64(1)<<f.bits-1
+}
+
+// value returns the channel in the pixel v, scaled to 8 bits
+func (f bitfield) value(v uint32) uint8 {
+	max := uint64(1)<<f.bits - 1
+	return uint8(uint64(v>>f.shift) & max * 255 / max)
+}
+
+// bitfields are the red, green, blue and alpha channels of a 16-bit or 32-bit bitmap
+type bitfields [4]bitfield
+
+// color returns the color of the pixel v, which is opaque if there is no alpha channel
+func (fs *bitfields) color(v uint32) color.NRGBA {
+	c := color.NRGBA{fs[0].value(v), fs[1].value(v), fs[2].value(v), 255}
+	if fs[3].bits > 0 {
+		c.A = fs[3].value(v)
+	}
+	return c
+}
+
+// decodeICOBitmap decodes a bitmap entry, which is a BMP image without the file header,
+// with twice the height, since the color bitmap is followed by a 1-bit transparency mask.
+// Both are stored from the bottom row and up, with rows that are padded to 4 bytes.
+func decodeICOBitmap(data []byte) (*image.NRGBA, int, error) {
+	if len(data) < icoDIBHeaderSize {
+		return nil, 0, errors.New("the bitmap header is too short")
+	}
+	var (
+		headerSize  = int(binary.LittleEndian.Uint32(data))
+		width       = int(int32(binary.LittleEndian.Uint32(data[4:])))
+		height      = int(int32(binary.LittleEndian.Uint32(data[8:]))) / 2
+		depth       = int(binary.LittleEndian.Uint16(data[14:]))
+		compression = binary.LittleEndian.Uint32(data[16:])
+		colors      = int(binary.LittleEndian.Uint32(data[32:]))
+	)
+	if headerSize < icoDIBHeaderSize || headerSize > len(data) || width <= 0 || height <= 0 || width > icoMaxSize || height > icoMaxSize {
+		return nil, 0, fmt.Errorf("invalid bitmap size: %dx%d", width, height)
+	}
+	// Only uncompressed bitmaps are supported, or bitfields for 16-bit and 32-bit bitmaps
+	if compression != 0 && !(compression == 3 && (depth == 16 || depth == 32)) {
+		return nil, 0, fmt.Errorf("unsupported bitmap compression: %d", compression)
+	}
+	var palette []color.NRGBA
+	switch depth {
+	case 1, 4, 8:
+		if colors == 0 || colors > 1<<depth {
+			colors = 1 << depth
+		}
+		if headerSize+4*colors > len(data) {
+			return nil, 0, errors.New("the palette is too short")
+		}
+		palette = make([]color.NRGBA, colors)
+		for i := range palette {
+			p := data[headerSize+4*i:]
+			palette[i] = color.NRGBA{p[2], p[1], p[0], 255}
+		}
+	case 16, 24, 32:
+	default:
+		return nil, 0, fmt.Errorf("unsupported bit depth: %d", depth)
+	}
+	// The masks for red, green, blue and alpha in 16-bit and 32-bit bitmaps, which are
+	// given after the header, or in the header if it is large enough, for bitfields
+	var masks [4]uint32
+	switch depth {
+	case 16:
+		masks = [4]uint32{0x7c00, 0x03e0, 0x001f, 0}
+	case 32:
+		masks = [4]uint32{0xff0000, 0xff00, 0xff, 0xff000000}
+	}
+	if compression == 3 {
+		offset := icoDIBHeaderSize
+		if headerSize < icoDIBHeaderSize+12 {
+			offset = headerSize
+			headerSize += 12
+		}
+		if headerSize > len(data) {
+			return nil, 0, errors.New("the bitmap is too short")
+		}
+		for i := 0; i < 3; i++ {
+			masks[i] = binary.LittleEndian.Uint32(data[offset+4*i:])
+		}
+		if headerSize >= icoDIBHeaderSize+16 {
+			masks[3] = binary.LittleEndian.Uint32(data[icoDIBHeaderSize+12:])
+		}
+	}
+	var fields bitfields
+	if depth == 16 || depth == 32 {
+		for i, mask := range masks {
+			var ok bool
+			if fields[i], ok = newBitfield(mask); !ok || (i < 3 && mask == 0) {
+				return nil, 0, fmt.Errorf("unsupported bitmap masks: %#x", masks)
+			}
+		}
+	}
+	if headerSize+4*len(palette) > len(data) {
+		return nil, 0, errors.New("the bitmap is too short")
+	}
+	var (
+		pixels     = data[headerSize+4*len(palette):]
+		stride     = (width*depth + 31) / 32 * 4
+		maskStride = (width + 31) / 32 * 4
+		m          = image.NewNRGBA(image.Rect(0, 0, width, height))
+		hasAlpha   bool
+	)
+	if len(pixels) < stride*height {
+		return nil, 0, errors.New("the bitmap is too short")
+	}
+	mask := pixels[stride*height:]
+	for row := 0; row < height; row++ {
+		var (
+			src = pixels[row*stride:]
+			dst = m.Pix[m.PixOffset(0, height-1-row):]
+		)
+		for x := 0; x < width; x++ {
+			var c color.NRGBA
+			switch depth {
+			case 1, 4, 8:
+				i := int(src[x*depth/8]>>(8-depth-x*depth%8)) & (1<<depth - 1)
+				if i >= len(palette) {
+					return nil, 0, errors.New("color index out of range")
+				}
+				c = palette[i]
+			case 16:
+				c = fields.color(uint32(binary.LittleEndian.Uint16(src[2*x:])))
+			case 24:
+				c = color.NRGBA{src[3*x+2], src[3*x+1], src[3*x], 255}
+			case 32:
+				c = fields.color(binary.LittleEndian.Uint32(src[4*x:]))
+				hasAlpha = hasAlpha || c.A != 0
+			}
+			dst[4*x], dst[4*x+1], dst[4*x+2], dst[4*x+3] = c.R, c.G, c.B, c.A
+		}
+	}
+	// The mask is used if there is no alpha channel, or if the alpha channel is empty,
+	// which some old icons with 32 bits per pixel have. The mask is optional.
+	if depth == 32 && !hasAlpha {
+		for i := 3; i < len(m.Pix); i += 4 {
+			m.Pix[i] = 255
+		}
+	}
+	if (depth != 32 || !hasAlpha) && len(mask) >= maskStride*height {
+		for row := 0; row < height; row++ {
+			dst := m.Pix[m.PixOffset(0, height-1-row):]
+			for x := 0; x < width; x++ {
+				if mask[row*maskStride+x/8]&(0x80>>(x%8)) != 0 {
+					dst[4*x], dst[4*x+1], dst[4*x+2], dst[4*x+3] = 0, 0, 0, 0
+				}
+			}
+		}
+	}
+	return m, depth, nil
+}
+
+// DecodeICO decodes an ICO image from r, and returns the largest image in it.
+// If there are several images of the largest size, the one with the most bits per pixel is returned.
+func DecodeICO(r io.Reader) (image.Image, error) {
+	entries, err := DecodeICOAll(r)
+	if err != nil {
+		return nil, err
+	}
+	best := entries[0]
+	for _, entry := range entries[1:] {
+		size, bestSize := entry.Image.Bounds().Size(), best.Image.Bounds().Size()
+		if size.X*size.Y > bestSize.X*bestSize.Y || (size == bestSize && entry.BitDepth > best.BitDepth) {
+			best = entry
+		}
+	}
+	return best.Image, nil
+}
+
+// ReadICOAll reads all the images in an ICO file, with every size and bit depth
+func ReadICOAll(filename string) ([]ICOEntry, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return DecodeICOAll(f)
+}
+
+// EncodeICO writes the given images to w as an ICO file, with one entry per image.
+// The images can be at most 256x256. Images that are 128x128 or larger are stored as PNG,
+// and the other images are stored as bitmaps with 32 bits per pixel.
+func EncodeICO(w io.Writer, images []image.Image) error {
+	if len(images) == 0 {
+		return errors.New("there are no images to write")
+	}
+	if len(images) > 0xffff {
+		return errors.New("too many images for an ICO file")
+	}
+	var (
+		header  = make([]byte, icoHeaderSize+icoEntrySize*len(images))
+		entries = make([][]byte, len(images))
+		offset  = len(header)
+	)
+	binary.LittleEndian.PutUint16(header[2:], 1)
+	binary.LittleEndian.PutUint16(header[4:], uint16(len(images)))
+	for i, m := range images {
+		size := m.Bounds().Size()
+		if size.X < 1 || size.Y < 1 || size.X > icoMaxSize || size.Y > icoMaxSize {
+			return fmt.Errorf("the image is too large for ICO: %dx%d", size.X, size.Y)
+		}
+		if size.X >= icoPNGSize || size.Y >= icoPNGSize {
+			var buf bytes.Buffer
+			if err := (&png.Encoder{CompressionLevel: png.BestCompression}).Encode(&buf, m); err != nil {
+				return err
+			}
+			entries[i] = buf.Bytes()
+		} else {
+			entries[i] = encodeICOBitmap(m)
+		}
+		// A width or height of 256 is stored as 0
+		dir := header[icoHeaderSize+i*icoEntrySize:]
+		dir[0], dir[1] = uint8(size.X), uint8(size.Y)
+		binary.LittleEndian.PutUint16(dir[4:], 1)
+		binary.LittleEndian.PutUint16(dir[6:], 32)
+		binary.LittleEndian.PutUint32(dir[8:], uint32(len(entries[i])))
+		binary.LittleEndian.PutUint32(dir[12:], uint32(offset))
+		offset += len(entries[i])
+	}
+	if _, err := w.Write(header); err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if _, err := w.Write(entry); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// encodeICOBitmap returns an ICO bitmap entry with 32 bits per pixel, and a mask
+// where the fully transparent pixels are set, for programs that do not use the alpha channel
+func encodeICOBitmap(m image.Image) []byte {
+	var (
+		rect       = m.Bounds()
+		width      = rect.Dx()
+		height     = rect.Dy()
+		maskStride = (width + 31) / 32 * 4
+		data       = make([]byte, icoDIBHeaderSize+4*width*height+maskStride*height)
+		pixels     = data[icoDIBHeaderSize:]
+		mask       = pixels[4*width*height:]
+	)
+	binary.LittleEndian.PutUint32(data, icoDIBHeaderSize)
+	binary.LittleEndian.PutUint32(data[4:], uint32(width))
+	binary.LittleEndian.PutUint32(data[8:], uint32(2*height))
+	binary.LittleEndian.PutUint16(data[12:], 1)
+	binary.LittleEndian.PutUint16(data[14:], 32)
+	binary.LittleEndian.PutUint32(data[20:], uint32(len(data)-icoDIBHeaderSize))
+	for row := 0; row < height; row++ {
+		y := rect.Max.Y - 1 - row
+		for x := 0; x < width; x++ {
+			c := color.NRGBAModel.Convert(m.At(rect.Min.X+x, y)).(color.NRGBA)
+			p := pixels[4*(row*width+x):]
+			p[0], p[1], p[2], p[3] = c.B, c.G, c.R, c.A
+			if c.A == 0 {
+				mask[row*maskStride+x/8] |= 0x80 >> (x % 8)
+			}
+		}
+	}
+	return data
+}
+
+// WriteICO writes an ICO file with the image m scaled to each of the given sizes, like 16 for 16x16.
+// If no sizes are given, ICOSizes is used. The sizes must be from 1 to 256.
+// Images that are not square are scaled to fit, and centered on a transparent background.
+// The file is replaced atomically, like with Write.
+func WriteICO(filename string, sizes []int, m image.Image) error {
+	if f, ok := formatByExtension(filename); !ok || f.name != "ico" {
+		return errors.New("icons can only be written to ICO files, not: " + filepath.Ext(filename))
+	}
+	if len(sizes) == 0 {
+		sizes = ICOSizes
+	}
+	// Sort the sizes and remove duplicates, without changing the given slice
+	sorted := append([]int(nil), sizes...)
+	sort.Ints(sorted)
+	var images []image.Image
+	for i, size := range sorted {
+		if size < 1 || size > icoMaxSize {
+			return fmt.Errorf("invalid icon size: %d", size)
+		}
+		if i > 0 && size == sorted[i-1] {
+			continue
+		}
+		icon, err := iconImage(m, size)
+		if err != nil {
+			return err
+		}
+		images = append(images, icon)
+	}
+	return writeAtomically(filename, func(w io.Writer) error {
+		return EncodeICO(w, images)
+	})
+}
+
+// iconImage scales m to fit within a square of the given size, centered on a transparent background.
+// An error is returned if m is empty.
+func iconImage(m image.Image, size int) (*image.NRGBA, error) {
+	var (
+		rect = m.Bounds()
+		w, h = size, size
+	)
+	if rect.Empty() {
+		return nil, fmt.Errorf("can not make an icon from an empty image: %dx%d", rect.Dx(), rect.Dy())
+	}
+	if rect.Dx() > rect.Dy() {
+		h = max1(size * rect.Dy() / rect.Dx())
+	} else if rect.Dy() > rect.Dx() {
+		w = max1(size * rect.Dx() / rect.Dy())
+	}
+	scaled := resize(m, w, h)
+	if w == size && h == size {
+		return scaled, nil
+	}
+	icon := image.NewNRGBA(image.Rect(0, 0, size, size))
+	x0, y0 := (size-w)/2, (size-h)/2
+	for y := 0; y < h; y++ {
+		copy(icon.Pix[icon.PixOffset(x0, y0+y):], scaled.Pix[scaled.PixOffset(0, y):scaled.PixOffset(w, y)])
+	}
+	return icon, nil
+}
+
+// max1 returns n, or 1 if n is smaller than 1
+func max1(n int) int {
+	if n < 1 {
+		return 1
+	}
+	return n
+}
+
+func encodeICO(w io.Writer, m image.Image, _ *EncodeOptions) error {
+	if size := m.Bounds().Size(); size.X > icoMaxSize || size.Y > icoMaxSize {
+		// Large images are scaled down, like with WriteICO
+		icon, err := iconImage(m, icoMaxSize)
+		if err != nil {
+			return err
+		}
+		return EncodeICO(w, []image.Image{icon})
+	}
+	return EncodeICO(w, []image.Image{m})
+}
@@ -0,0 +1,238 @@
+package plates
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/color"
+	"path/filepath"
+	"testing"
+)
+
+func TestWriteICO(t *testing.T) {
+	var (
+		filename = filepath.Join(t.TempDir(), "test.ico")
+		m        = image.NewNRGBA(image.Rect(0, 0, 300, 300))
+	)
+	for i := range m.Pix {
+		m.Pix[i] = 0xc0
+	}
+	if err := WriteICO(filename, nil, m); err != nil {
+		t.Fatal(err)
+	}
+	entries, err := ReadICOAll(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != len(ICOSizes) {
+		t.Fatalf("Expected %d entries, got %d", len(ICOSizes), len(entries))
+	}
+	for i, entry := range entries {
+		size := ICOSizes[i]
+		if entry.Image.Bounds() != image.Rect(0, 0, size, size) {
+			t.Errorf("Expected entry %d to be %dx%d, got %v", i, size, size, entry.Image.Bounds())
+		}
+		if entry.PNG != (size >= 128) {
+			t.Errorf("%dx%d: expected PNG to be %v", size, size, size >= 128)
+		}
+		if entry.BitDepth != 32 {
+			t.Errorf("%dx%d: expected 32 bits per pixel, got %d", size, size, entry.BitDepth)
+		}
+		if c := color.NRGBAModel.Convert(entry.Image.At(size/2, size/2)); c != (color.NRGBA{0xc0, 0xc0, 0xc0, 0xc0}) {
+			t.Errorf("%dx%d: unexpected color: %v", size, size, c)
+		}
+	}
+	// The largest entry is returned when reading the file as an image
+	read, err := Read(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if read.Bounds().Dx() != 256 {
+		t.Errorf("Expected the 256x256 entry, got %v", read.Bounds())
+	}
+	if err := WriteICO(filename, []int{16, 512}, m); err == nil {
+		t.Error("Expected an error for an icon size of 512")
+	}
+	if err := WriteICO(filename, nil, image.NewRGBA(image.Rect(0, 0, 0, 0))); err == nil {
+		t.Error("Expected an error for an empty image")
+	}
+	if err := Write(filename, image.NewRGBA(image.Rect(0, 0, 1000, 0))); err == nil {
+		t.Error("Expected an error for an empty image that is too wide")
+	}
+	if err := WriteICO(filepath.Join(t.TempDir(), "test.png"), nil, m); err == nil {
+		t.Error("Expected an error for writing an icon to a PNG file")
+	}
+}
+
+func TestWriteICONotSquare(t *testing.T) {
+	var (
+		filename = filepath.Join(t.TempDir(), "test.ico")
+		m        = image.NewRGBA(image.Rect(0, 0, 40, 20))
+	)
+	for i := range m.Pix {
+		m.Pix[i] = 0xff
+	}
+	if err := WriteICO(filename, []int{32, 16, 32}, m); err != nil {
+		t.Fatal(err)
+	}
+	entries, err := ReadICOAll(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 || entries[0].Image.Bounds().Dx() != 16 || entries[1].Image.Bounds().Dx() != 32 {
+		t.Fatalf("Expected a 16x16 and a 32x32 entry, got %d entries", len(entries))
+	}
+	// The image is centered, with transparent rows above and below
+	m32 := entries[1].Image
+	if _, _, _, a := m32.At(16, 0).RGBA(); a != 0 {
+		t.Errorf("Expected the top row to be transparent, got alpha %d", a)
+	}
+	if c := color.NRGBAModel.Convert(m32.At(16, 16)); c != (color.NRGBA{0xff, 0xff, 0xff, 0xff}) {
+		t.Errorf("Expected white in the center, got %v", c)
+	}
+}
+
+// icoBitmap returns an ICO file with one 2x2 bitmap entry with 8 bits per pixel,
+// a palette of two colors and a mask where the top left pixel is transparent
+func icoBitmap() []byte {
+	var (
+		header  = []byte{0, 0, 1, 0, 1, 0, 2, 2, 2, 0, 1, 0, 8, 0, 0, 0, 0, 0, 22, 0, 0, 0}
+		dib     = make([]byte, icoDIBHeaderSize)
+		palette = []byte{0, 0, 255, 0, 255, 0, 0, 0} // red and blue, as BGR0
+		// Rows are stored from the bottom and up, padded to 4 bytes
+		pixels = []byte{0, 1, 0, 0, 1, 1, 0, 0}
+		mask   = []byte{0, 0, 0, 0, 0x80, 0, 0, 0}
+	)
+	binary.LittleEndian.PutUint32(dib, icoDIBHeaderSize)
+	binary.LittleEndian.PutUint32(dib[4:], 2)
+	binary.LittleEndian.PutUint32(dib[8:], 4)
+	binary.LittleEndian.PutUint16(dib[12:], 1)
+	binary.LittleEndian.PutUint16(dib[14:], 8)
+	binary.LittleEndian.PutUint32(dib[32:], 2)
+	entry := append(append(append(dib, palette...), pixels...), mask...)
+	binary.LittleEndian.PutUint32(header[14:], uint32(len(entry)))
+	return append(header, entry...)
+}
+
+func TestDecodeICOBitmap(t *testing.T) {
+	entries, err := DecodeICOAll(bytes.NewReader(icoBitmap()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].BitDepth != 8 || entries[0].PNG {
+		t.Fatalf("Unexpected entries: %+v", entries)
+	}
+	m := entries[0].Image
+	expected := [][]color.NRGBA{
+		{{}, {0, 0, 255, 255}},
+		{{255, 0, 0, 255}, {0, 0, 255, 255}},
+	}
+	for y, row := range expected {
+		for x, want := range row {
+			if c := color.NRGBAModel.Convert(m.At(x, y)); c != want {
+				t.Errorf("(%d, %d): expected %v, got %v", x, y, want, c)
+			}
+		}
+	}
+	data := icoBitmap()
+	if _, err := DecodeICOAll(bytes.NewReader(data[:30])); err == nil {
+		t.Error("Expected an error for a truncated ICO file")
+	}
+	// A 32-bit bitmap with bitfields, where the entry ends before the color masks
+	data = data[:icoHeaderSize+icoEntrySize+icoDIBHeaderSize]
+	binary.LittleEndian.PutUint32(data[14:], icoDIBHeaderSize)
+	entry := data[icoHeaderSize+icoEntrySize:]
+	binary.LittleEndian.PutUint16(entry[14:], 32)
+	binary.LittleEndian.PutUint32(entry[16:], 3)
+	if _, err := DecodeICOAll(bytes.NewReader(data)); !errors.Is(err, errICO) {
+		t.Errorf("Expected errICO for a truncated bitmap with bitfields, got %v", err)
+	}
+
+	// A 16-bit bitmap with 5-6-5 bitfields, with red and green pixels
+	data = icoBitfields(16, []uint32{0xf800, 0x07e0, 0x001f}, []byte{0x00, 0xf8, 0xe0, 0x07})
+	m, err = DecodeICO(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for x, want := range []color.NRGBA{{255, 0, 0, 255}, {0, 255, 0, 255}} {
+		if c := color.NRGBAModel.Convert(m.At(x, 0)); c != want {
+			t.Errorf("5-6-5 (%d, 0): expected %v, got %v", x, want, c)
+		}
+	}
+	// Masks with bits that are not next to each other are not supported
+	data = icoBitfields(16, []uint32{0xf801, 0x07e0, 0x001e}, []byte{0, 0, 0, 0})
+	if _, err := DecodeICO(bytes.NewReader(data)); !errors.Is(err, errICO) {
+		t.Errorf("Expected errICO for invalid bitfields, got %v", err)
+	}
+}
+
+// icoBitfields returns an ICO file with one bitmap that is one row of pixels, with the given
+// bit depth, bitfield masks and pixel data, which must be padded to 4 bytes
+func icoBitfields(depth int, masks []uint32, pixels []byte) []byte {
+	var (
+		width  = len(pixels) * 8 / depth
+		header = []byte{0, 0, 1, 0, 1, 0, byte(width), 1, 0, 0, 1, 0, byte(depth), 0, 0, 0, 0, 0, 22, 0, 0, 0}
+		dib    = make([]byte, icoDIBHeaderSize+4*len(masks))
+		mask   = make([]byte, 4)
+	)
+	binary.LittleEndian.PutUint32(dib, icoDIBHeaderSize)
+	binary.LittleEndian.PutUint32(dib[4:], uint32(width))
+	binary.LittleEndian.PutUint32(dib[8:], 2)
+	binary.LittleEndian.PutUint16(dib[12:], 1)
+	binary.LittleEndian.PutUint16(dib[14:], uint16(depth))
+	binary.LittleEndian.PutUint32(dib[16:], 3)
+	for i, m := range masks {
+		binary.LittleEndian.PutUint32(dib[icoDIBHeaderSize+4*i:], m)
+	}
+	entry := append(append(dib, pixels...), mask...)
+	binary.LittleEndian.PutUint32(header[14:], uint32(len(entry)))
+	return append(header, entry...)
+}
+
+func TestEncodeICORoundTrip(t *testing.T) {
+	m := testImage()
+	m.Set(1, 1, color.RGBA{})
+	var buf bytes.Buffer
+	if err := EncodeICO(&buf, []image.Image{m}); err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := DecodeICO(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for y := 0; y < 3; y++ {
+		for x := 0; x < 4; x++ {
+			if c1, c2 := color.NRGBAModel.Convert(m.At(x, y)), decoded.At(x, y); c1 != c2 {
+				t.Errorf("(%d, %d): expected %v, got %v", x, y, c1, c2)
+			}
+		}
+	}
+	if err := EncodeICO(&buf, []image.Image{image.NewRGBA(image.Rect(0, 0, 257, 16))}); err == nil {
+		t.Error("Expected an error for an image that is too wide")
+	}
+}
+
+func TestResize(t *testing.T) {
+	m := image.NewNRGBA(image.Rect(10, 10, 14, 14))
+	// The left half is opaque red and the right half is transparent
+	for y := 10; y < 14; y++ {
+		m.Set(10, y, color.NRGBA{255, 0, 0, 255})
+		m.Set(11, y, color.NRGBA{255, 0, 0, 255})
+	}
+	// The edges are blended, but the transparent pixels do not darken the red
+	small := resize(m, 2, 2)
+	if c := small.NRGBAAt(0, 0); c.A < 192 || c.R != 255 || c.G != 0 || c.B != 0 {
+		t.Errorf("Expected a mostly opaque red, got %v", c)
+	}
+	if c := small.NRGBAAt(1, 0); c.A > 64 || c.R != 255 {
+		t.Errorf("Expected a mostly transparent red, got %v", c)
+	}
+	large := resize(m, 8, 8)
+	if large.Bounds() != image.Rect(0, 0, 8, 8) {
+		t.Errorf("Unexpected size: %v", large.Bounds())
+	}
+	if c := large.NRGBAAt(0, 0); c != (color.NRGBA{255, 0, 0, 255}) {
+		t.Errorf("Expected opaque red, got %v", c)
+	}
+}
@@ -0,0 +1,151 @@
+package plates
+
+import (
+	"image/color"
+	"math"
+)
+
+// D65 reference white, used for converting from XYZ to CIELAB
+const (
+	whiteX = 0.95047
+	whiteY = 1.0
+	whiteZ = 1.08883
+)
+
+// srgbToLinear converts a gamma encoded sRGB value (0 to 1) to linear light
+func srgbToLinear(v float64) float64 {
+	if v <= 0.04045 {
+		return v / 12.92
+	}
+	return math.Pow((v+0.055)/1.055, 2.4)
+}
+
+// rgbFloat is an sRGB color with red, green and blue from 0 to 1
+type rgbFloat [3]float64
+
+// floatRGB converts an 8-bit color to an rgbFloat
+func floatRGB(cr color.RGBA) rgbFloat {
+	return rgbFloat{float64(cr.R) / 255.0, float64(cr.G) / 255.0, float64(cr.B) / 255.0}
+}
+
+// floatRGB64 converts a 16-bit color to an rgbFloat
+func floatRGB64(cr color.RGBA64) rgbFloat {
+	return rgbFloat{float64(cr.R) / 65535.0, float64(cr.G) / 65535.0, float64(cr.B) / 65535.0}
+}
+
+// linearRGB returns the linear light red, green and blue components (0 to 1) of a color
+func linearRGB(c rgbFloat) (float64, float64, float64) {
+	return srgbToLinear(c[0]), srgbToLinear(c[1]), srgbToLinear(c[2])
+}
+
+// linearToXYZ converts linear sRGB to CIE XYZ, using the D65 white point
+func linearToXYZ(r, g, b float64) (float64, float64, float64) {
+	x := 0.4124564*r + 0.3575761*g + 0.1804375*b
+	y := 0.2126729*r + 0.7151522*g + 0.0721750*b
+	z := 0.0193339*r + 0.1191920*g + 0.9503041*b
+	return x, y, z
+}
+
+// labF is the nonlinear companding function used by CIELAB
+func labF(t float64) float64 {
+	const delta = 6.0 / 29.0
+	if t > delta*delta*delta {
+		return math.Cbrt(t)
+	}
+	return t/(3.0*delta*delta) + 4.0/29.0
+}
+
+// xyzToLab converts CIE XYZ to CIELAB, using the D65 white point
+func xyzToLab(x, y, z float64) (float64, float64, float64) {
+	fx := labF(x / whiteX)
+	fy := labF(y / whiteY)
+	fz := labF(z / whiteZ)
+	return 116.0*fy - 16.0, 500.0 * (fx - fy), 200.0 * (fy - fz)
+}
+
+// rgbToLab converts an sRGB color to CIELAB (L from 0 to 100)
+func rgbToLab(cr color.RGBA) (float64, float64, float64) {
+	return floatToLab(floatRGB(cr))
+}
+
+// floatToLab converts an sRGB color to CIELAB (L from 0 to 100)
+func floatToLab(c rgbFloat) (float64, float64, float64) {
+	return xyzToLab(linearToXYZ(linearRGB(c)))
+}
+
+// linearToOKLab converts linear sRGB to OKLab (L from 0 to 1)
+func linearToOKLab(r, g, b float64) (float64, float64, float64) {
+	l := math.Cbrt(0.4122214708*r + 0.5363325363*g + 0.0514459929*b)
+	m := math.Cbrt(0.2119034982*r + 0.6806995451*g + 0.1073969566*b)
+	s := math.Cbrt(0.0883024619*r + 0.2817188376*g + 0.6299787005*b)
+	return 0.2104542553*l + 0.7936177850*m - 0.0040720468*s,
+		1.9779984951*l - 2.4285922050*m + 0.4505937099*s,
+		0.0259040371*l + 0.7827717662*m - 0.8086757660*s
+}
+
+// rgbToOKLab converts an sRGB color to OKLab (L from 0 to 1)
+func rgbToOKLab(cr color.RGBA) (float64, float64, float64) {
+	return floatToOKLab(floatRGB(cr))
+}
+
+// floatToOKLab converts an sRGB color to OKLab (L from 0 to 1)
+func floatToOKLab(c rgbFloat) (float64, float64, float64) {
+	return linearToOKLab(linearRGB(c))
+}
+
+// linearToSRGB converts a linear light value (0 to 1) to gamma encoded sRGB
+func linearToSRGB(v float64) float64 {
+	if v <= 0.0031308 {
+		return v * 12.92
+	}
+	return 1.055*math.Pow(v, 1.0/2.4) - 0.055
+}
+
+// srgbFromLinear returns the gamma encoded sRGB color for linear light red, green and blue
+func srgbFromLinear(r, g, b float64) rgbFloat {
+	return rgbFloat{linearToSRGB(r), linearToSRGB(g), linearToSRGB(b)}
+}
+
+// xyzToLinear converts CIE XYZ to linear sRGB, using the D65 white point
+func xyzToLinear(x, y, z float64) (float64, float64, float64) {
+	r := 3.2404542*x - 1.5371385*y - 0.4985314*z
+	g := -0.9692660*x + 1.8760108*y + 0.0415560*z
+	b := 0.0556434*x - 0.2040259*y + 1.0572252*z
+	return r, g, b
+}
+
+// labFInverse is the inverse of labF
+func labFInverse(t float64) float64 {
+	const delta = 6.0 / 29.0
+	if t > delta {
+		return t * t * t
+	}
+	return 3.0 * delta * delta * (t - 4.0/29.0)
+}
+
+// labToXYZ converts CIELAB to CIE XYZ, using the D65 white point
+func labToXYZ(l, a, b float64) (float64, float64, float64) {
+	fy := (l + 16.0) / 116.0
+	return whiteX * labFInverse(fy+a/500.0), whiteY * labFInverse(fy), whiteZ * labFInverse(fy-b/200.0)
+}
+
+// labToFloat converts CIELAB to an sRGB color, which may be outside of 0 to 1
+func labToFloat(l, a, b float64) rgbFloat {
+	return srgbFromLinear(xyzToLinear(labToXYZ(l, a, b)))
+}
+
+// okLabToLinear converts OKLab to linear sRGB
+func okLabToLinear(l, a, b float64) (float64, float64, float64) {
+	lc := l + 0.3963377774*a + 0.2158037573*b
+	mc := l - 0.1055613458*a - 0.0638541728*b
+	sc := l - 0.0894841775*a - 1.2914855480*b
+	lc, mc, sc = lc*lc*lc, mc*mc*mc, sc*sc*sc
+	return 4.0767416621*lc - 3.3077115913*mc + 0.2309699292*sc,
+		-1.2684380046*lc + 2.6097574011*mc - 0.3413193965*sc,
+		-0.0041960863*lc - 0.7034186147*mc + 1.7076147010*sc
+}
+
+// okLabToFloat converts OKLab to an sRGB color, which may be outside of 0 to 1
+func okLabToFloat(l, a, b float64) rgbFloat {
+	return srgbFromLinear(okLabToLinear(l, a, b))
+}
@@ -0,0 +1,150 @@
+package plates
+
+import (
+	"image/color"
+	"sync"
+)
+
+// Linear light is proportional to the amount of light, while sRGB values are gamma encoded,
+// so that they are closer to how bright the colors look. Averaging gamma encoded values
+// gives mixes that are too dark, so mixing and blending is more accurate in linear light.
+
+var (
+	// srgbToLinearTable has the linear light value for each 8-bit sRGB value
+	srgbToLinearTable = func() (table [256]float64) {
+		for i := range table {
+			table[i] = srgbToLinear(float64(i) / 255.0)
+		}
+		return table
+	}()
+
+	// linearToSRGBTable has the 8-bit sRGB value for each 16-bit linear light value.
+	// It is created the first time it is needed, by linearToSRGBOnce.
+	linearToSRGBTable []uint8
+	linearToSRGBOnce  sync.Once
+)
+
+// SRGBToLinear converts an 8-bit sRGB value to linear light, from 0 to 1, with a lookup table
+func SRGBToLinear(v uint8) float64 {
+	return srgbToLinearTable[v]
+}
+
+// LinearToSRGB converts linear light, from 0 to 1, to an 8-bit sRGB value, with a lookup table.
+// Values outside of 0 to 1 are clamped.
+func LinearToSRGB(v float64) uint8 {
+	linearToSRGBOnce.Do(func() {
+		linearToSRGBTable = make([]uint8, 1<<16)
+		for i := range linearToSRGBTable {
+			linearToSRGBTable[i] = uint8(linearToSRGB(float64(i)/65535.0)*255.0 + 0.5)
+		}
+	})
+	return linearToSRGBTable[int(clamp01(v)*65535.0+0.5)]
+}
+
+// SRGB16ToLinear converts a 16-bit sRGB value to linear light, from 0 to 1
+func SRGB16ToLinear(v uint16) float64 {
+	return srgbToLinear(float64(v) / 65535.0)
+}
+
+// LinearToSRGB16 converts linear light, from 0 to 1, to a 16-bit sRGB value.
+// Values outside of 0 to 1 are clamped.
+func LinearToSRGB16(v float64) uint16 {
+	return uint16(linearToSRGB(clamp01(v))*65535.0 + 0.5)
+}
+
+// LinearRGB returns the red, green and blue components of an 8-bit sRGB color in linear light, from 0 to 1
+func LinearRGB(c color.RGBA) (float64, float64, float64) {
+	return SRGBToLinear(c.R), SRGBToLinear(c.G), SRGBToLinear(c.B)
+}
+
+// LinearToRGBA converts red, green and blue in linear light, from 0 to 1, to an 8-bit sRGB color with the given alpha.
+// The color components are not premultiplied, so they should be at most alpha for a valid color.RGBA.
+func LinearToRGBA(r, g, b float64, alpha uint8) color.RGBA {
+	return color.RGBA{LinearToSRGB(r), LinearToSRGB(g), LinearToSRGB(b), alpha}
+}
+
+// LinearLight is an Option for mixing, blending and measuring distances in linear light
+// instead of with the gamma encoded sRGB values. It is used by PaintMix, Mix, and by the
+// EuclideanRGB and Redmean distances, including when they are used by SeparateN, Separate3Distance,
+// CloseTo1Distance and CloseTo2Distance. The other distances already convert to linear light.
+func LinearLight() Option {
+	return func(cfg *config) {
+		cfg.linear = true
+	}
+}
+
+// rgbDistance is a Distance that measures gamma encoded sRGB values, with channels from 0 to 255,
+// which can measure linear light values instead, with linearDistance.
+// 8-bit colors are measured with their integer values, so that the distances are exact.
+type rgbDistance func(c1, c2 rgbFloat) float64
+
+// Distance returns the distance between two 8-bit colors
+func (f rgbDistance) Distance(c1, c2 color.RGBA) float64 {
+	return f(rgbFloat{float64(c1.R), float64(c1.G), float64(c1.B)}, rgbFloat{float64(c2.R), float64(c2.G), float64(c2.B)})
+}
+
+// Distance64 returns the distance between two 16-bit colors
+func (f rgbDistance) Distance64(c1, c2 color.RGBA64) float64 {
+	return f(rgbFloat{float64(c1.R) / 257.0, float64(c1.G) / 257.0, float64(c1.B) / 257.0}, rgbFloat{float64(c2.R) / 257.0, float64(c2.G) / 257.0, float64(c2.B) / 257.0})
+}
+
+// linearDistance returns a Distance that measures linear light values if d is one of the
+// distances in this package that measures gamma encoded sRGB values, and d otherwise
+func linearDistance(d Distance) Distance {
+	f, ok := d.(rgbDistance)
+	if !ok {
+		return d
+	}
+	return floatDistance(func(c1, c2 rgbFloat) float64 {
+		r1, g1, b1 := linearRGB(c1)
+		r2, g2, b2 := linearRGB(c2)
+		return f(rgbFloat{r1 * 255.0, g1 * 255.0, b1 * 255.0}, rgbFloat{r2 * 255.0, g2 * 255.0, b2 * 255.0})
+	})
+}
+
+// distance returns the Distance to use for the configuration, which measures linear light if cfg.linear is set
+func (cfg *config) distance(d Distance) Distance {
+	if cfg.linear {
+		return linearDistance(d)
+	}
+	return d
+}
+
+// Mix blends two colors, where t is the amount of c2, from 0 to 1.
+// The colors are blended with premultiplied alpha, and with the gamma encoded
+// sRGB values unless the LinearLight option is given.
+func Mix(c1, c2 color.RGBA, t float64, opts ...Option) color.RGBA {
+	var (
+		t1, t2 = 1 - clamp01(t), clamp01(t)
+		a      = t1*float64(c1.A) + t2*float64(c2.A)
+	)
+	if !newConfig(opts).linear {
+		return color.RGBA{
+			uint8(t1*float64(c1.R) + t2*float64(c2.R) + 0.5),
+			uint8(t1*float64(c1.G) + t2*float64(c2.G) + 0.5),
+			uint8(t1*float64(c1.B) + t2*float64(c2.B) + 0.5),
+			uint8(a + 0.5),
+		}
+	}
+	if a == 0 {
+		return color.RGBA{}
+	}
+	mix := func(v1, a1, v2, a2 uint8) uint8 {
+		l := t1*premultipliedToLinear(v1, a1) + t2*premultipliedToLinear(v2, a2)
+		return uint8(float64(LinearToSRGB(l/a))*a/255.0 + 0.5)
+	}
+	return color.RGBA{mix(c1.R, c1.A, c2.R, c2.A), mix(c1.G, c1.A, c2.G, c2.A), mix(c1.B, c1.A, c2.B, c2.A), uint8(a + 0.5)}
+}
+
+// premultipliedToLinear converts a premultiplied 8-bit sRGB value to linear light,
+// premultiplied with alpha from 0 to 255
+func premultipliedToLinear(v, alpha uint8) float64 {
+	if alpha == 0 {
+		return 0
+	}
+	u := (int(v)*255 + int(alpha)/2) / int(alpha)
+	if u > 255 {
+		u = 255
+	}
+	return SRGBToLinear(uint8(u)) * float64(alpha)
+}
@@ -0,0 +1,97 @@
+package plates
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"testing"
+)
+
+func TestSRGBToLinear(t *testing.T) {
+	if SRGBToLinear(0) != 0 || SRGBToLinear(255) != 1 {
+		t.Errorf("Expected 0 and 1, got %f and %f", SRGBToLinear(0), SRGBToLinear(255))
+	}
+	// The middle sRGB value is only about 21% of the light
+	if v := SRGBToLinear(128); math.Abs(v-0.2158605) > 1e-6 {
+		t.Errorf("Expected 0.2158605, got %f", v)
+	}
+	for i := 0; i < 256; i++ {
+		if v := LinearToSRGB(SRGBToLinear(uint8(i))); v != uint8(i) {
+			t.Errorf("%d: got %d after a round trip", i, v)
+		}
+	}
+	for i := 0; i < 65536; i += 257 {
+		if v := LinearToSRGB16(SRGB16ToLinear(uint16(i))); v != uint16(i) {
+			t.Errorf("%d: got %d after a round trip", i, v)
+		}
+	}
+	if LinearToSRGB(-1) != 0 || LinearToSRGB(2) != 255 || LinearToSRGB16(2) != 0xffff {
+		t.Error("Expected values outside of 0 to 1 to be clamped")
+	}
+	if r, g, b := LinearRGB(color.RGBA{12, 34, 56, 255}); LinearToRGBA(r, g, b, 255) != (color.RGBA{12, 34, 56, 255}) {
+		t.Errorf("Expected the same color after a round trip, got %v", LinearToRGBA(r, g, b, 255))
+	}
+}
+
+func TestMix(t *testing.T) {
+	var (
+		black = color.RGBA{0, 0, 0, 255}
+		white = color.RGBA{255, 255, 255, 255}
+	)
+	if c := Mix(black, white, 0.5); c != (color.RGBA{128, 128, 128, 255}) {
+		t.Errorf("Expected the gamma encoded middle, got %v", c)
+	}
+	// Half of the light of white is brighter than the gamma encoded middle
+	if c := Mix(black, white, 0.5, LinearLight()); c != (color.RGBA{188, 188, 188, 255}) {
+		t.Errorf("Expected the linear light middle, got %v", c)
+	}
+	if c := Mix(black, white, 0, LinearLight()); c != black {
+		t.Errorf("Expected black, got %v", c)
+	}
+	// Transparent pixels do not darken the mix
+	red := color.RGBA{255, 0, 0, 255}
+	if c := Mix(red, color.RGBA{}, 0.5, LinearLight()); c != (color.RGBA{128, 0, 0, 128}) {
+		t.Errorf("Expected half transparent red, got %v", c)
+	}
+}
+
+func TestPaintMixLinear(t *testing.T) {
+	var (
+		black = color.RGBA{0, 0, 0, 255}
+		white = color.RGBA{255, 255, 255, 255}
+	)
+	if c := PaintMix(black, white); c.R != 127 {
+		t.Errorf("Expected 127, got %v", c)
+	}
+	if c := PaintMix(black, white, LinearLight()); c != (color.RGBA{188, 188, 188, 255}) {
+		t.Errorf("Expected the linear light middle, got %v", c)
+	}
+}
+
+func TestLinearDistance(t *testing.T) {
+	var (
+		c1  = color.RGBA{10, 10, 10, 255}
+		c2  = color.RGBA{20, 20, 20, 255}
+		cfg = newConfig([]Option{LinearLight()})
+	)
+	// Dark colors are closer to each other in linear light
+	if d, linear := EuclideanRGB.Distance(c1, c2), cfg.distance(EuclideanRGB).Distance(c1, c2); linear >= d/2 {
+		t.Errorf("Expected a much smaller distance in linear light, got %f and %f", d, linear)
+	}
+	if d := cfg.distance(Redmean).Distance(c1, c1); d != 0 {
+		t.Errorf("Expected 0, got %f", d)
+	}
+	// The distances in other color spaces are unchanged
+	if d1, d2 := DeltaEOK.Distance(c1, c2), cfg.distance(DeltaEOK).Distance(c1, c2); d1 != d2 {
+		t.Errorf("Expected the same distance, got %f and %f", d1, d2)
+	}
+	// With a threshold that only lets the target color through in linear light
+	m := image.NewRGBA(image.Rect(0, 0, 1, 1))
+	m.SetRGBA(0, 0, c2)
+	if _, _, _, a := CloseTo2Distance(m, c1, EuclideanRGB, 5).At(0, 0).RGBA(); a != 0 {
+		t.Error("Expected the pixel to be too far away from the target")
+	}
+	if c := CloseTo2Distance(m, c1, EuclideanRGB, 5, LinearLight()).At(0, 0); c != c1 {
+		t.Errorf("Expected the target color in linear light, got %v", c)
+	}
+}
@@ -0,0 +1,519 @@
+package plates
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"image"
+	"io"
+	"math"
+	"sort"
+	"unicode/utf8"
+)
+
+// Metadata is the information that is stored in an image file next to the pixels.
+// The zero value means that there is no metadata.
+type Metadata struct {
+	// EXIF is the raw EXIF data, which starts with a TIFF header, like "II*\x00"
+	EXIF []byte
+
+	// XMP is the XMP packet, which is XML
+	XMP []byte
+
+	// ICC is the ICC color profile
+	ICC []byte
+
+	// Text are the text chunks of PNG images, like "Title" or "Author", as UTF-8
+	Text map[string]string
+
+	// DPI is the resolution in pixels per inch, or 0 if it is not known
+	DPI float64
+}
+
+// Orientation returns the orientation in the EXIF data, from 1 to 8, where 1 is the right way up.
+// It is 1 if there is no EXIF data. See ApplyOrientation.
+func (md *Metadata) Orientation() int {
+	return exifOrientation(md.EXIF)
+}
+
+// Prefixes of the JPEG APP segments and PNG keyword that hold metadata
+const (
+	jpegEXIFPrefix = "Exif\x00\x00"
+	jpegXMPPrefix  = "http://ns.adobe.com/xap/1.0/\x00"
+	jpegICCPrefix  = "ICC_PROFILE\x00"
+	pngXMPKeyword  = "XML:com.adobe.xmp"
+	inchesPerMeter = 1 / 0.0254
+	// jpegMaxSegment is the largest amount of data in a JPEG segment, after the length
+	jpegMaxSegment = 0xffff - 2
+)
+
+// metadataReaders extract the metadata from a complete image file, by format name
+var metadataReaders = map[string]func([]byte) *Metadata{
+	"jpeg": readJPEGMetadata,
+	"png":  readPNGMetadata,
+	"webp": readWebPMetadata,
+	"tiff": readTIFFMetadata,
+}
+
+// metadataWriters add metadata to a complete image file, by format name.
+// TIFF metadata is written by EncodeTIFF itself.
+var metadataWriters = map[string]func([]byte, image.Image, *Metadata) ([]byte, error){
+	"jpeg": writeJPEGMetadata,
+	"png":  writePNGMetadata,
+	"webp": writeWebPMetadata,
+}
+
+// readMetadata extracts the metadata from an image file in the given format.
+// Formats without metadata give an empty Metadata.
+func readMetadata(formatName string, data []byte) *Metadata {
+	if read, ok := metadataReaders[formatName]; ok {
+		return read(data)
+	}
+	return &Metadata{}
+}
+
+// trimEXIF removes the "Exif\0\0" prefix, which some WebP and PNG writers include
+func trimEXIF(exif []byte) []byte {
+	return bytes.TrimPrefix(exif, []byte(jpegEXIFPrefix))
+}
+
+// readJPEGMetadata reads the APP segments before the image data of a JPEG image
+func readJPEGMetadata(data []byte) *Metadata {
+	var (
+		md         = &Metadata{}
+		iccChunks  = make(map[int][]byte)
+		iccCount   int
+		i          = 2
+		jfifPrefix = "JFIF\x00"
+	)
+	for i+4 <= len(data) && data[i] == 0xff {
+		marker := data[i+1]
+		// The start of scan marker comes right before the image data
+		if marker == 0xda || marker == 0xd9 {
+			break
+		}
+		length := int(binary.BigEndian.Uint16(data[i+2:]))
+		if length < 2 || i+2+length > len(data) {
+			break
+		}
+		segment := data[i+4 : i+2+length]
+		switch {
+		case marker == 0xe0 && bytes.HasPrefix(segment, []byte(jfifPrefix)) && len(segment) >= 12:
+			units, density := segment[7], float64(binary.BigEndian.Uint16(segment[8:]))
+			switch units {
+			case 1:
+				md.DPI = density
+			case 2:
+				md.DPI = density * 2.54
+			}
+		case marker == 0xe1 && bytes.HasPrefix(segment, []byte(jpegEXIFPrefix)):
+			md.EXIF = append([]byte(nil), segment[len(jpegEXIFPrefix):]...)
+		case marker == 0xe1 && bytes.HasPrefix(segment, []byte(jpegXMPPrefix)):
+			md.XMP = append([]byte(nil), segment[len(jpegXMPPrefix):]...)
+		case marker == 0xe2 && bytes.HasPrefix(segment, []byte(jpegICCPrefix)) && len(segment) >= len(jpegICCPrefix)+2:
+			// The ICC profile may be split into several numbered chunks
+			seq := int(segment[len(jpegICCPrefix)])
+			iccCount = int(segment[len(jpegICCPrefix)+1])
+			iccChunks[seq] = segment[len(jpegICCPrefix)+2:]
+		}
+		i += 2 + length
+	}
+	if iccCount > 0 && len(iccChunks) == iccCount {
+		for seq := 1; seq <= iccCount; seq++ {
+			md.ICC = append(md.ICC, iccChunks[seq]...)
+		}
+	}
+	return md
+}
+
+// jpegSegment returns a JPEG marker segment with the given marker and data
+func jpegSegment(marker byte, parts ...[]byte) []byte {
+	length := 2
+	for _, part := range parts {
+		length += len(part)
+	}
+	segment := []byte{0xff, marker, byte(length >> 8), byte(length)}
+	for _, part := range parts {
+		segment = append(segment, part...)
+	}
+	return segment
+}
+
+// writeJPEGMetadata inserts the metadata as APP segments after the start of image marker
+func writeJPEGMetadata(data []byte, _ image.Image, md *Metadata) ([]byte, error) {
+	if len(data) < 2 {
+		return nil, errors.New("invalid JPEG image")
+	}
+	var segments []byte
+	if md.DPI > 0 {
+		density := uint16(math.Min(math.Round(md.DPI), 0xffff))
+		jfif := []byte{'J', 'F', 'I', 'F', 0, 1, 2, 1, byte(density >> 8), byte(density), byte(density >> 8), byte(density), 0, 0}
+		segments = append(segments, jpegSegment(0xe0, jfif)...)
+	}
+	if len(md.EXIF) > 0 {
+		if len(jpegEXIFPrefix)+len(md.EXIF) > jpegMaxSegment {
+			return nil, errors.New("the EXIF data is too large for a JPEG image")
+		}
+		segments = append(segments, jpegSegment(0xe1, []byte(jpegEXIFPrefix), md.EXIF)...)
+	}
+	if len(md.XMP) > 0 {
+		if len(jpegXMPPrefix)+len(md.XMP) > jpegMaxSegment {
+			return nil, errors.New("the XMP data is too large for a JPEG image")
+		}
+		segments = append(segments, jpegSegment(0xe1, []byte(jpegXMPPrefix), md.XMP)...)
+	}
+	if len(md.ICC) > 0 {
+		chunkSize := jpegMaxSegment - len(jpegICCPrefix) - 2
+		count := (len(md.ICC) + chunkSize - 1) / chunkSize
+		if count > 255 {
+			return nil, errors.New("the ICC profile is too large for a JPEG image")
+		}
+		for seq := 1; seq <= count; seq++ {
+			chunk := md.ICC[(seq-1)*chunkSize:]
+			if len(chunk) > chunkSize {
+				chunk = chunk[:chunkSize]
+			}
+			segments = append(segments, jpegSegment(0xe2, []byte(jpegICCPrefix), []byte{byte(seq), byte(count)}, chunk)...)
+		}
+	}
+	result := append([]byte(nil), data[:2]...)
+	result = append(result, segments...)
+	return append(result, data[2:]...), nil
+}
+
+// pngChunk returns a PNG chunk with the given type and data, including the checksum
+func pngChunk(kind string, data []byte) []byte {
+	chunk := make([]byte, 8, 12+len(data))
+	binary.BigEndian.PutUint32(chunk, uint32(len(data)))
+	copy(chunk[4:], kind)
+	chunk = append(chunk, data...)
+	return binary.BigEndian.AppendUint32(chunk, crc32.ChecksumIEEE(chunk[4:]))
+}
+
+// latin1ToUTF8 converts ISO 8859-1 text, which is used by tEXt and zTXt chunks, to UTF-8
+func latin1ToUTF8(b []byte) string {
+	runes := make([]rune, len(b))
+	for i, c := range b {
+		runes[i] = rune(c)
+	}
+	return string(runes)
+}
+
+// utf8ToLatin1 converts UTF-8 text to ISO 8859-1, if all the characters can be converted
+func utf8ToLatin1(s string) ([]byte, bool) {
+	var b []byte
+	for _, r := range s {
+		if r > 0xff {
+			return nil, false
+		}
+		b = append(b, byte(r))
+	}
+	return b, true
+}
+
+// inflate decompresses zlib data
+func inflate(data []byte) ([]byte, error) {
+	zr, err := zlib.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+	return io.ReadAll(zr)
+}
+
+// deflate compresses data with zlib
+func deflate(data []byte) []byte {
+	var buf bytes.Buffer
+	zw := zlib.NewWriter(&buf)
+	zw.Write(data)
+	zw.Close()
+	return buf.Bytes()
+}
+
+// readPNGMetadata reads the eXIf, iCCP, pHYs, tEXt, zTXt and iTXt chunks of a PNG image.
+// XMP is stored in an iTXt chunk with a special keyword.
+func readPNGMetadata(data []byte) *Metadata {
+	md := &Metadata{}
+	addText := func(keyword, text string) {
+		if md.Text == nil {
+			md.Text = make(map[string]string)
+		}
+		md.Text[keyword] = text
+	}
+	for i := 8; i+12 <= len(data); {
+		length := int(binary.BigEndian.Uint32(data[i:]))
+		if length < 0 || i+12+length > len(data) {
+			break
+		}
+		kind, chunk := string(data[i+4:i+8]), data[i+8:i+8+length]
+		i += 12 + length
+		keyword, rest, _ := bytes.Cut(chunk, []byte{0})
+		switch kind {
+		case "IEND":
+			return md
+		case "eXIf":
+			md.EXIF = trimEXIF(append([]byte(nil), chunk...))
+		case "pHYs":
+			if length == 9 && chunk[8] == 1 {
+				// Pixels per meter are rounded, so round the DPI to two decimals, which turns 11811 into 300
+				md.DPI = math.Round(float64(binary.BigEndian.Uint32(chunk))/inchesPerMeter*100) / 100
+			}
+		case "iCCP":
+			// A compression method byte, which must be 0 for zlib, comes before the profile
+			if len(rest) > 1 && rest[0] == 0 {
+				if icc, err := inflate(rest[1:]); err == nil {
+					md.ICC = icc
+				}
+			}
+		case "tEXt":
+			addText(string(keyword), latin1ToUTF8(rest))
+		case "zTXt":
+			if len(rest) > 1 && rest[0] == 0 {
+				if text, err := inflate(rest[1:]); err == nil {
+					addText(string(keyword), latin1ToUTF8(text))
+				}
+			}
+		case "iTXt":
+			// A compression flag, a compression method, a language tag and a translated keyword come before the text
+			if len(rest) < 2 {
+				continue
+			}
+			compressed := rest[0] == 1
+			parts := bytes.SplitN(rest[2:], []byte{0}, 3)
+			if len(parts) != 3 {
+				continue
+			}
+			text := parts[2]
+			if compressed {
+				var err error
+				if text, err = inflate(text); err != nil {
+					continue
+				}
+			}
+			if string(keyword) == pngXMPKeyword {
+				md.XMP = append([]byte(nil), text...)
+			} else if utf8.Valid(text) {
+				addText(string(keyword), string(text))
+			}
+		}
+	}
+	return md
+}
+
+// writePNGMetadata inserts the metadata as chunks right after the IHDR chunk
+func writePNGMetadata(data []byte, _ image.Image, md *Metadata) ([]byte, error) {
+	// The signature is 8 bytes, and the IHDR chunk is 25 bytes
+	const ihdrEnd = 8 + 25
+	if len(data) < ihdrEnd || string(data[12:16]) != "IHDR" {
+		return nil, errors.New("invalid PNG image")
+	}
+	var chunks []byte
+	if len(md.ICC) > 0 {
+		chunks = append(chunks, pngChunk("iCCP", append([]byte("ICC profile\x00\x00"), deflate(md.ICC)...))...)
+	}
+	if md.DPI > 0 {
+		ppm := uint32(math.Round(md.DPI * inchesPerMeter))
+		phys := make([]byte, 9)
+		binary.BigEndian.PutUint32(phys, ppm)
+		binary.BigEndian.PutUint32(phys[4:], ppm)
+		phys[8] = 1 // the unit is meters
+		chunks = append(chunks, pngChunk("pHYs", phys)...)
+	}
+	if len(md.EXIF) > 0 {
+		chunks = append(chunks, pngChunk("eXIf", md.EXIF)...)
+	}
+	if len(md.XMP) > 0 {
+		chunks = append(chunks, pngChunk("iTXt", append([]byte(pngXMPKeyword+"\x00\x00\x00\x00\x00"), md.XMP...))...)
+	}
+	// Sort the keywords, so that the same metadata always gives the same file
+	keywords := make([]string, 0, len(md.Text))
+	for keyword := range md.Text {
+		keywords = append(keywords, keyword)
+	}
+	sort.Strings(keywords)
+	for _, keyword := range keywords {
+		if len(keyword) < 1 || len(keyword) > 79 {
+			return nil, errors.New("PNG text keywords must be from 1 to 79 characters long: " + keyword)
+		}
+		if latin1, ok := utf8ToLatin1(md.Text[keyword]); ok {
+			chunks = append(chunks, pngChunk("tEXt", append([]byte(keyword+"\x00"), latin1...))...)
+		} else {
+			chunks = append(chunks, pngChunk("iTXt", append([]byte(keyword+"\x00\x00\x00\x00\x00"), md.Text[keyword]...))...)
+		}
+	}
+	result := append([]byte(nil), data[:ihdrEnd]...)
+	result = append(result, chunks...)
+	return append(result, data[ihdrEnd:]...), nil
+}
+
+// riffChunk is a chunk in a RIFF container, like a WebP image
+type riffChunk struct {
+	kind string
+	data []byte
+}
+
+// parseRIFF returns the chunks of a WebP image
+func parseRIFF(data []byte) ([]riffChunk, error) {
+	if len(data) < 12 || string(data[:4]) != "RIFF" || string(data[8:12]) != "WEBP" {
+		return nil, errors.New("invalid WebP image")
+	}
+	var chunks []riffChunk
+	for i := 12; i+8 <= len(data); {
+		length := int(binary.LittleEndian.Uint32(data[i+4:]))
+		if length < 0 || i+8+length > len(data) {
+			return nil, errors.New("invalid WebP chunk")
+		}
+		chunks = append(chunks, riffChunk{string(data[i : i+4]), data[i+8 : i+8+length]})
+		// Chunks are padded to an even length
+		i += 8 + length + length%2
+	}
+	return chunks, nil
+}
+
+// readWebPMetadata reads the EXIF, XMP and ICCP chunks of a WebP image
+func readWebPMetadata(data []byte) *Metadata {
+	md := &Metadata{}
+	chunks, _ := parseRIFF(data)
+	for _, chunk := range chunks {
+		switch chunk.kind {
+		case "EXIF":
+			md.EXIF = trimEXIF(append([]byte(nil), chunk.data...))
+		case "XMP ":
+			md.XMP = append([]byte(nil), chunk.data...)
+		case "ICCP":
+			md.ICC = append([]byte(nil), chunk.data...)
+		}
+	}
+	return md
+}
+
+// writeWebPMetadata rewrites a WebP image in the extended format, with a VP8X chunk
+// that tells which metadata chunks are present. WebP images have no resolution, so DPI is not written.
+func writeWebPMetadata(data []byte, m image.Image, md *Metadata) ([]byte, error) {
+	chunks, err := parseRIFF(data)
+	if err != nil {
+		return nil, err
+	}
+	var (
+		flags  byte
+		images []riffChunk
+	)
+	for _, chunk := range chunks {
+		switch chunk.kind {
+		case "VP8 ", "VP8L", "ALPH":
+			images = append(images, chunk)
+			if chunk.kind == "ALPH" {
+				// VP8L images have the alpha channel in the bitstream, without this flag
+				flags |= 0x10
+			}
+		}
+	}
+	all := []riffChunk{{"VP8X", nil}}
+	if len(md.ICC) > 0 {
+		flags |= 0x20
+		all = append(all, riffChunk{"ICCP", md.ICC})
+	}
+	all = append(all, images...)
+	if len(md.EXIF) > 0 {
+		flags |= 0x08
+		all = append(all, riffChunk{"EXIF", md.EXIF})
+	}
+	if len(md.XMP) > 0 {
+		flags |= 0x04
+		all = append(all, riffChunk{"XMP ", md.XMP})
+	}
+	rect := m.Bounds()
+	all[0].data = vp8xData(flags, rect.Dx(), rect.Dy())
+	return riffBytes(all), nil
+}
+
+// vp8xData returns the data of a VP8X chunk, which has the flags, 3 reserved bytes
+// and the canvas size minus one, as 24-bit numbers
+func vp8xData(flags byte, width, height int) []byte {
+	vp8x := make([]byte, 10)
+	vp8x[0] = flags
+	putUint24(vp8x[4:], width-1)
+	putUint24(vp8x[7:], height-1)
+	return vp8x
+}
+
+// putUint24 stores a little-endian 24-bit number
+func putUint24(b []byte, v int) {
+	b[0], b[1], b[2] = byte(v), byte(v>>8), byte(v>>16)
+}
+
+// uint24 returns a little-endian 24-bit number
+func uint24(b []byte) int {
+	return int(b[0]) | int(b[1])<<8 | int(b[2])<<16
+}
+
+// riffBytes returns a WebP image with the given chunks
+func riffBytes(chunks []riffChunk) []byte {
+	result := []byte("RIFF\x00\x00\x00\x00WEBP")
+	for _, chunk := range chunks {
+		result = append(result, chunk.kind...)
+		result = binary.LittleEndian.AppendUint32(result, uint32(len(chunk.data)))
+		result = append(result, chunk.data...)
+		if len(chunk.data)%2 == 1 {
+			result = append(result, 0)
+		}
+	}
+	binary.LittleEndian.PutUint32(result[4:], uint32(len(result)-8))
+	return result
+}
+
+// readTIFFMetadata reads the resolution, ICC profile and XMP packet from the first page of a TIFF image
+func readTIFFMetadata(data []byte) *Metadata {
+	md := &Metadata{}
+	if len(data) < 8 {
+		return md
+	}
+	var order binary.ByteOrder = binary.BigEndian
+	if data[0] == 'I' {
+		order = binary.LittleEndian
+	}
+	// The offsets and counts are unsigned 32-bit values, which are compared as uint64,
+	// so that they can not overflow or be negative, like an int can be on 32-bit platforms
+	var (
+		size       = uint64(len(data))
+		ifd        = uint64(order.Uint32(data[4:]))
+		resolution float64
+		unit       = tiffInch
+	)
+	if ifd < 8 || ifd+2 > size {
+		return md
+	}
+	n := uint64(order.Uint16(data[ifd:]))
+	for i := uint64(0); i < n && ifd+2+12*(i+1) <= size; i++ {
+		entry := data[ifd+2+12*i:]
+		tag, count, offset := order.Uint16(entry), uint64(order.Uint32(entry[4:])), uint64(order.Uint32(entry[8:]))
+		switch tag {
+		case tiffXResolution:
+			if offset+8 <= size && order.Uint32(data[offset+4:]) != 0 {
+				resolution = float64(order.Uint32(data[offset:])) / float64(order.Uint32(data[offset+4:]))
+			}
+		case tiffResolutionUnit:
+			unit = int(order.Uint16(entry[8:]))
+		case tiffICCProfile, tiffXMP:
+			// These are byte arrays, which are longer than 4 bytes, so they are stored at the offset
+			if count <= 4 || offset+count > size {
+				continue
+			}
+			value := append([]byte(nil), data[offset:offset+count]...)
+			if tag == tiffICCProfile {
+				md.ICC = value
+			} else {
+				md.XMP = value
+			}
+		}
+	}
+	switch unit {
+	case tiffInch:
+		md.DPI = resolution
+	case tiffCentimeter:
+		md.DPI = resolution * 2.54
+	}
+	return md
+}
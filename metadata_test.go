@@ -0,0 +1,124 @@
+package plates
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"path/filepath"
+	"testing"
+)
+
+func TestMetadataRoundTrip(t *testing.T) {
+	var (
+		m   = testImage()
+		dir = t.TempDir()
+		md  = &Metadata{
+			EXIF: exifWithOrientation(1, false),
+			XMP:  []byte(`<x:xmpmeta xmlns:x="adobe:ns:meta/"></x:xmpmeta>`),
+			ICC:  bytes.Repeat([]byte("icc profile "), 7000),
+			Text: map[string]string{"Title": "Plates", "Author": "Åse", "Comment": "日本"},
+			DPI:  300,
+		}
+	)
+	for _, ext := range []string{".jpg", ".png", ".webp", ".tif"} {
+		filename := filepath.Join(dir, "metadata"+ext)
+		if err := Write(filename, m, &EncodeOptions{Metadata: md}); err != nil {
+			t.Fatalf("%s: %v", ext, err)
+		}
+		read, readMetadata, err := ReadWithMetadata(filename)
+		if err != nil {
+			t.Fatalf("%s: %v", ext, err)
+		}
+		if read.Bounds().Size() != m.Bounds().Size() {
+			t.Errorf("%s: expected the size %v, got %v", ext, m.Bounds().Size(), read.Bounds().Size())
+		}
+		if ext != ".tif" && !bytes.Equal(readMetadata.EXIF, md.EXIF) {
+			t.Errorf("%s: expected the EXIF data to be kept", ext)
+		}
+		if !bytes.Equal(readMetadata.XMP, md.XMP) {
+			t.Errorf("%s: expected the XMP packet to be kept, got %q", ext, readMetadata.XMP)
+		}
+		if !bytes.Equal(readMetadata.ICC, md.ICC) {
+			t.Errorf("%s: expected the ICC profile to be kept, got %d bytes", ext, len(readMetadata.ICC))
+		}
+		if ext != ".webp" && readMetadata.DPI != md.DPI {
+			t.Errorf("%s: expected %v DPI, got %v", ext, md.DPI, readMetadata.DPI)
+		}
+		if ext == ".png" && len(readMetadata.Text) != len(md.Text) {
+			t.Errorf("%s: expected the text %v, got %v", ext, md.Text, readMetadata.Text)
+		}
+		for keyword, text := range md.Text {
+			if ext == ".png" && readMetadata.Text[keyword] != text {
+				t.Errorf("%s: expected %q for %s, got %q", ext, text, keyword, readMetadata.Text[keyword])
+			}
+		}
+	}
+
+	// Formats without metadata give an empty Metadata
+	filename := filepath.Join(dir, "metadata.bmp")
+	if err := Write(filename, m, &EncodeOptions{Metadata: md}); err != nil {
+		t.Fatal(err)
+	}
+	if _, readMetadata, err := ReadWithMetadata(filename); err != nil || readMetadata.EXIF != nil || readMetadata.DPI != 0 {
+		t.Errorf("Expected no metadata for BMP, got %v, %v", readMetadata, err)
+	}
+}
+
+func TestAutoOrient(t *testing.T) {
+	var (
+		m        = image.NewRGBA(image.Rect(0, 0, 40, 20))
+		filename = filepath.Join(t.TempDir(), "phone.jpg")
+	)
+	if err := Write(filename, m, &EncodeOptions{Metadata: &Metadata{EXIF: exifWithOrientation(6, true)}}); err != nil {
+		t.Fatal(err)
+	}
+	read, err := Read(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size := read.Bounds().Size(); size != (image.Point{40, 20}) {
+		t.Errorf("Expected the image to be read as it is stored, got %v", size)
+	}
+	read, format, err := ReadFile(filename, &ReadOptions{AutoOrient: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size := read.Bounds().Size(); size != (image.Point{20, 40}) || format != "jpeg" {
+		t.Errorf("Expected a rotated JPEG image, got %v and %q", size, format)
+	}
+	_, md, err := ReadWithMetadata(filename, &ReadOptions{AutoOrient: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if o := md.Orientation(); o != 1 {
+		t.Errorf("Expected the orientation to be reset to 1, got %d", o)
+	}
+}
+
+func TestWriteJPEGMetadataTooLarge(t *testing.T) {
+	var buf bytes.Buffer
+	opts := &EncodeOptions{Metadata: &Metadata{EXIF: make([]byte, 70000)}}
+	if err := Encode(&buf, testImage(), "jpeg", opts); err == nil {
+		t.Error("Expected an error for EXIF data that does not fit in a JPEG segment")
+	}
+}
+
+func TestReadTIFFMetadataInvalid(t *testing.T) {
+	// Offsets and counts near the largest 32-bit value, which are negative as an int on 32-bit platforms
+	data := make([]byte, 64)
+	copy(data, "II*\x00")
+	binary.LittleEndian.PutUint32(data[4:], 8)
+	binary.LittleEndian.PutUint16(data[8:], 2)
+	binary.LittleEndian.PutUint16(data[10:], tiffXResolution)
+	binary.LittleEndian.PutUint32(data[18:], 0xfffffffc)
+	binary.LittleEndian.PutUint16(data[22:], tiffICCProfile)
+	binary.LittleEndian.PutUint32(data[26:], 0xffffffff)
+	binary.LittleEndian.PutUint32(data[30:], 0x20)
+	if md := readTIFFMetadata(data); md.DPI != 0 || md.ICC != nil {
+		t.Errorf("Expected no metadata, got %+v", md)
+	}
+	binary.LittleEndian.PutUint32(data[4:], 0xfffffffe)
+	if md := readTIFFMetadata(data); md.DPI != 0 || md.ICC != nil {
+		t.Errorf("Expected no metadata, got %+v", md)
+	}
+}
@@ -0,0 +1,460 @@
+package plates
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// errNetpbm is returned when a Netpbm image could not be decoded
+var errNetpbm = errors.New("invalid Netpbm image")
+
+// netpbmReader reads the tokens and samples of a Netpbm image
+type netpbmReader struct {
+	r *bufio.Reader
+}
+
+// skipSpace skips whitespace and comments, which last until the end of the line
+func (nr *netpbmReader) skipSpace() error {
+	for {
+		b, err := nr.r.ReadByte()
+		if err != nil {
+			return err
+		}
+		switch b {
+		case ' ', '\t', '\r', '\n', '\v', '\f':
+		case '#':
+			if _, err := nr.r.ReadString('\n'); err != nil {
+				return err
+			}
+		default:
+			return nr.r.UnreadByte()
+		}
+	}
+}
+
+// token reads the next whitespace separated word
+func (nr *netpbmReader) token() (string, error) {
+	if err := nr.skipSpace(); err != nil {
+		return "", err
+	}
+	var sb strings.Builder
+	for {
+		b, err := nr.r.ReadByte()
+		if err == io.EOF && sb.Len() > 0 {
+			return sb.String(), nil
+		} else if err != nil {
+			return "", err
+		}
+		if b == ' ' || b == '\t' || b == '\r' || b == '\n' || b == '\v' || b == '\f' || b == '#' {
+			return sb.String(), nr.r.UnreadByte()
+		}
+		sb.WriteByte(b)
+	}
+}
+
+// number reads the next token as a non-negative number
+func (nr *netpbmReader) number() (int, error) {
+	s, err := nr.token()
+	if err != nil {
+		return 0, fmt.Errorf("%w: %v", errNetpbm, err)
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("%w: invalid number: %q", errNetpbm, s)
+	}
+	return n, nil
+}
+
+// netpbmHeader is the information in the header of a Netpbm image
+type netpbmHeader struct {
+	magic         string
+	width, height int
+	depth         int
+	maxval        int
+	tupleType     string
+}
+
+// readHeader reads the header, up to and including the single whitespace character before the samples
+func (nr *netpbmReader) readHeader() (*netpbmHeader, error) {
+	var magic [2]byte
+	if _, err := io.ReadFull(nr.r, magic[:]); err != nil || magic[0] != 'P' || magic[1] < '1' || magic[1] > '7' {
+		return nil, errNetpbm
+	}
+	h := &netpbmHeader{magic: string(magic[:]), maxval: 1}
+	if h.magic == "P7" {
+		if err := nr.readPAMHeader(h); err != nil {
+			return nil, err
+		}
+	} else {
+		var err error
+		if h.width, err = nr.number(); err != nil {
+			return nil, err
+		}
+		if h.height, err = nr.number(); err != nil {
+			return nil, err
+		}
+		if h.magic != "P1" && h.magic != "P4" {
+			if h.maxval, err = nr.number(); err != nil {
+				return nil, err
+			}
+		}
+		h.depth = 1
+		if h.magic == "P3" || h.magic == "P6" {
+			h.depth = 3
+		}
+		// A single whitespace character separates the header from binary samples
+		if h.magic >= "P4" {
+			if _, err := nr.r.ReadByte(); err != nil {
+				return nil, fmt.Errorf("%w: %v", errNetpbm, err)
+			}
+		}
+	}
+	if h.maxval < 1 || h.maxval > 65535 {
+		return nil, fmt.Errorf("%w: invalid maxval: %d", errNetpbm, h.maxval)
+	}
+	if h.width == 0 || h.height == 0 || h.width > maxPixels/h.height {
+		return nil, fmt.Errorf("%w: invalid size: %dx%d", errNetpbm, h.width, h.height)
+	}
+	return h, nil
+}
+
+// readPAMHeader reads the header lines of a PAM (P7) image, up to and including ENDHDR
+func (nr *netpbmReader) readPAMHeader(h *netpbmHeader) error {
+	for {
+		line, err := nr.r.ReadString('\n')
+		if err != nil {
+			return fmt.Errorf("%w: %v", errNetpbm, err)
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		if fields[0] == "ENDHDR" {
+			break
+		}
+		if len(fields) < 2 {
+			return fmt.Errorf("%w: invalid header line: %q", errNetpbm, line)
+		}
+		if fields[0] == "TUPLTYPE" {
+			h.tupleType = strings.Join(fields[1:], " ")
+			continue
+		}
+		n, err := strconv.Atoi(fields[1])
+		if err != nil || n < 0 {
+			return fmt.Errorf("%w: invalid header line: %q", errNetpbm, line)
+		}
+		switch fields[0] {
+		case "WIDTH":
+			h.width = n
+		case "HEIGHT":
+			h.height = n
+		case "DEPTH":
+			h.depth = n
+		case "MAXVAL":
+			h.maxval = n
+		}
+	}
+	if h.depth < 1 || h.depth > 4 {
+		return fmt.Errorf("%w: unsupported depth: %d", errNetpbm, h.depth)
+	}
+	return nil
+}
+
+// DecodeNetpbm decodes a Netpbm image from r. All the formats from P1 to P7 are supported:
+// PBM (P1, P4) and PGM (P2, P5) give an *image.Gray, or *image.Gray16 if maxval is larger than 255,
+// PPM (P3, P6) gives an *image.RGBA or *image.RGBA64, and PAM (P7) gives a grayscale or
+// RGB image depending on the depth, which is an *image.NRGBA or *image.NRGBA64 if there is alpha.
+func DecodeNetpbm(r io.Reader) (image.Image, error) {
+	nr := &netpbmReader{bufio.NewReader(r)}
+	h, err := nr.readHeader()
+	if err != nil {
+		return nil, err
+	}
+	var (
+		plain  = h.magic <= "P3"
+		wide   = h.maxval > 255
+		gray   = h.depth <= 2
+		alpha  = h.depth == 2 || h.depth == 4
+		rect   = image.Rect(0, 0, h.width, h.height)
+		sample = make([]int, h.depth)
+		set    func(x, y int, s []int)
+	)
+	// Scale a sample to 16 bits
+	scale := func(v int) uint16 {
+		if v > h.maxval {
+			v = h.maxval
+		}
+		return uint16((v*0xffff + h.maxval/2) / h.maxval)
+	}
+	var m image.Image
+	switch {
+	case gray && !alpha && wide:
+		g := image.NewGray16(rect)
+		set = func(x, y int, s []int) { g.SetGray16(x, y, color.Gray16{scale(s[0])}) }
+		m = g
+	case gray && !alpha:
+		g := image.NewGray(rect)
+		set = func(x, y int, s []int) { g.Pix[y*g.Stride+x] = uint8(scale(s[0]) >> 8) }
+		m = g
+	case !alpha && wide:
+		c := image.NewRGBA64(rect)
+		set = func(x, y int, s []int) {
+			c.SetRGBA64(x, y, color.RGBA64{scale(s[0]), scale(s[1]), scale(s[2]), 0xffff})
+		}
+		m = c
+	case !alpha:
+		c := image.NewRGBA(rect)
+		set = func(x, y int, s []int) {
+			c.SetRGBA(x, y, color.RGBA{uint8(scale(s[0]) >> 8), uint8(scale(s[1]) >> 8), uint8(scale(s[2]) >> 8), 0xff})
+		}
+		m = c
+	case wide:
+		c := image.NewNRGBA64(rect)
+		set = func(x, y int, s []int) {
+			if gray {
+				v := scale(s[0])
+				c.SetNRGBA64(x, y, color.NRGBA64{v, v, v, scale(s[1])})
+				return
+			}
+			c.SetNRGBA64(x, y, color.NRGBA64{scale(s[0]), scale(s[1]), scale(s[2]), scale(s[3])})
+		}
+		m = c
+	default:
+		c := image.NewNRGBA(rect)
+		set = func(x, y int, s []int) {
+			if gray {
+				v := uint8(scale(s[0]) >> 8)
+				c.SetNRGBA(x, y, color.NRGBA{v, v, v, uint8(scale(s[1]) >> 8)})
+				return
+			}
+			c.SetNRGBA(x, y, color.NRGBA{uint8(scale(s[0]) >> 8), uint8(scale(s[1]) >> 8), uint8(scale(s[2]) >> 8), uint8(scale(s[3]) >> 8)})
+		}
+		m = c
+	}
+
+	// In PBM images, 1 is black, while in PAM BLACKANDWHITE images, 1 is white
+	bitmap := h.magic == "P1" || h.magic == "P4"
+	if bitmap {
+		h.maxval = 1
+		inner := set
+		set = func(x, y int, s []int) {
+			s[0] = 1 - s[0]
+			inner(x, y, s)
+		}
+	}
+
+	switch {
+	case h.magic == "P4":
+		row := make([]byte, (h.width+7)/8)
+		for y := 0; y < h.height; y++ {
+			if _, err := io.ReadFull(nr.r, row); err != nil {
+				return nil, fmt.Errorf("%w: %v", errNetpbm, err)
+			}
+			for x := 0; x < h.width; x++ {
+				sample[0] = int(row[x/8]>>(7-uint(x%8))) & 1
+				set(x, y, sample)
+			}
+		}
+	case h.magic == "P1":
+		for y := 0; y < h.height; y++ {
+			for x := 0; x < h.width; x++ {
+				// The bits do not have to be separated by whitespace
+				if err := nr.skipSpace(); err != nil {
+					return nil, fmt.Errorf("%w: %v", errNetpbm, err)
+				}
+				b, err := nr.r.ReadByte()
+				if err != nil || (b != '0' && b != '1') {
+					return nil, fmt.Errorf("%w: invalid bit", errNetpbm)
+				}
+				sample[0] = int(b - '0')
+				set(x, y, sample)
+			}
+		}
+	case plain:
+		for y := 0; y < h.height; y++ {
+			for x := 0; x < h.width; x++ {
+				for i := range sample {
+					if sample[i], err = nr.number(); err != nil {
+						return nil, err
+					}
+				}
+				set(x, y, sample)
+			}
+		}
+	default:
+		bytesPerSample := 1
+		if wide {
+			bytesPerSample = 2
+		}
+		row := make([]byte, h.width*h.depth*bytesPerSample)
+		for y := 0; y < h.height; y++ {
+			if _, err := io.ReadFull(nr.r, row); err != nil {
+				return nil, fmt.Errorf("%w: %v", errNetpbm, err)
+			}
+			for x, i := 0, 0; x < h.width; x++ {
+				for j := range sample {
+					if wide {
+						sample[j] = int(row[i])<<8 | int(row[i+1])
+					} else {
+						sample[j] = int(row[i])
+					}
+					i += bytesPerSample
+				}
+				set(x, y, sample)
+			}
+		}
+	}
+	return m, nil
+}
+
+// netpbmWriter writes the samples of a Netpbm image, either as binary or as plain text
+type netpbmWriter struct {
+	w         *bufio.Writer
+	plain     bool
+	wide      bool
+	lineWidth int
+}
+
+// sample writes a single sample
+func (nw *netpbmWriter) sample(v uint16) {
+	if !nw.plain {
+		if nw.wide {
+			nw.w.WriteByte(byte(v >> 8))
+		}
+		nw.w.WriteByte(byte(v))
+		return
+	}
+	s := strconv.Itoa(int(v))
+	// Lines in plain images should not be longer than 70 characters
+	if nw.lineWidth > 0 && nw.lineWidth+1+len(s) > 70 {
+		nw.w.WriteByte('\n')
+		nw.lineWidth = 0
+	}
+	if nw.lineWidth > 0 {
+		nw.w.WriteByte(' ')
+		nw.lineWidth++
+	}
+	nw.w.WriteString(s)
+	nw.lineWidth += len(s)
+}
+
+// endRow ends a row of samples
+func (nw *netpbmWriter) endRow() {
+	if nw.plain && nw.lineWidth > 0 {
+		nw.w.WriteByte('\n')
+		nw.lineWidth = 0
+	}
+}
+
+// isGray checks if an image only has shades of gray
+func isGray(m image.Image) bool {
+	switch m.(type) {
+	case *image.Gray, *image.Gray16:
+		return true
+	}
+	return false
+}
+
+// EncodeNetpbm writes the image m to w as a Netpbm image. The kind is one of
+// "pbm", "pgm", "ppm" or "pam". If plain is true, the ASCII variants
+// P1, P2 and P3 are written instead of the binary variants P4, P5 and P6.
+// PAM images are always binary. Images with 16 bits per channel are written
+// with a maxval of 65535. PBM images are black where the gray level is below 50%.
+// PGM and PPM images have no alpha channel, so only PAM keeps transparency.
+func EncodeNetpbm(w io.Writer, m image.Image, kind string, plain bool) error {
+	var (
+		bw   = bufio.NewWriter(w)
+		rect = m.Bounds()
+		nw   = &netpbmWriter{w: bw, plain: plain, wide: is16Bit(m)}
+	)
+	maxval := 255
+	if nw.wide {
+		maxval = 65535
+	}
+	magic := map[string]int{"pbm": 1, "pgm": 2, "ppm": 3, "pam": 7}[kind]
+	if magic == 0 {
+		return errors.New("unknown Netpbm format: " + kind)
+	}
+	if kind == "pam" {
+		nw.plain = false
+	} else if !plain {
+		magic += 3
+	}
+	channels := []int{0, 1, 2}
+	switch kind {
+	case "pbm":
+		fmt.Fprintf(bw, "P%d\n%d %d\n", magic, rect.Dx(), rect.Dy())
+	case "pgm", "ppm":
+		fmt.Fprintf(bw, "P%d\n%d %d\n%d\n", magic, rect.Dx(), rect.Dy(), maxval)
+		if kind == "pgm" {
+			channels = []int{0}
+		}
+	case "pam":
+		var tupleType string
+		gray, opaque := isGray(m), !hasTransparency(m)
+		switch {
+		case gray && opaque:
+			channels, tupleType = []int{0}, "GRAYSCALE"
+		case gray:
+			channels, tupleType = []int{0, 3}, "GRAYSCALE_ALPHA"
+		case opaque:
+			tupleType = "RGB"
+		default:
+			channels, tupleType = []int{0, 1, 2, 3}, "RGB_ALPHA"
+		}
+		fmt.Fprintf(bw, "P7\nWIDTH %d\nHEIGHT %d\nDEPTH %d\nMAXVAL %d\nTUPLTYPE %s\nENDHDR\n", rect.Dx(), rect.Dy(), len(channels), maxval, tupleType)
+	}
+
+	var bits byte
+	for y := rect.Min.Y; y < rect.Max.Y; y++ {
+		for x := rect.Min.X; x < rect.Max.X; x++ {
+			switch kind {
+			case "pbm":
+				black := color.Gray16Model.Convert(m.At(x, y)).(color.Gray16).Y < 0x8000
+				i := x - rect.Min.X
+				if plain {
+					bit := uint16(0)
+					if black {
+						bit = 1
+					}
+					nw.sample(bit)
+					continue
+				}
+				if black {
+					bits |= 0x80 >> uint(i%8)
+				}
+				if i%8 == 7 || x == rect.Max.X-1 {
+					bw.WriteByte(bits)
+					bits = 0
+				}
+			case "pgm":
+				nw.sample(scaleTo(color.Gray16Model.Convert(m.At(x, y)).(color.Gray16).Y, maxval))
+			default:
+				c := color.NRGBA64Model.Convert(m.At(x, y)).(color.NRGBA64)
+				if len(channels) <= 2 {
+					c.R = color.Gray16Model.Convert(m.At(x, y)).(color.Gray16).Y
+				}
+				values := [4]uint16{c.R, c.G, c.B, c.A}
+				for _, ch := range channels {
+					nw.sample(scaleTo(values[ch], maxval))
+				}
+			}
+		}
+		nw.endRow()
+	}
+	return bw.Flush()
+}
+
+// scaleTo scales a 16-bit value to the range 0 to maxval, which is either 255 or 65535
+func scaleTo(v uint16, maxval int) uint16 {
+	if maxval == 255 {
+		return v >> 8
+	}
+	return v
+}
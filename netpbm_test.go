@@ -0,0 +1,119 @@
+package plates
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"strings"
+	"testing"
+)
+
+func TestDecodeNetpbmPlain(t *testing.T) {
+	// The bits in plain PBM images do not need to be separated by whitespace
+	m, err := DecodeNetpbm(strings.NewReader("P1\n# a comment\n3 2\n010\n1 0 1\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []uint8{255, 0, 255, 0, 255, 0}
+	if g, ok := m.(*image.Gray); !ok || !bytes.Equal(g.Pix, expected) {
+		t.Errorf("Expected %v, got %v", expected, m)
+	}
+
+	m, err = DecodeNetpbm(strings.NewReader("P2 2 1 15 0 15"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if g, ok := m.(*image.Gray); !ok || g.Pix[0] != 0 || g.Pix[1] != 255 {
+		t.Errorf("Expected the samples to be scaled from a maxval of 15, got %v", m)
+	}
+
+	m, err = DecodeNetpbm(strings.NewReader("P3\n1 1\n65535\n65535 0 32768\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c := m.At(0, 0); c != (color.RGBA64{65535, 0, 32768, 65535}) {
+		t.Errorf("Expected a 16-bit color, got %v", c)
+	}
+}
+
+func TestDecodePAM(t *testing.T) {
+	data := "P7\nWIDTH 2\nHEIGHT 1\nDEPTH 1\nMAXVAL 1\nTUPLTYPE BLACKANDWHITE\nENDHDR\n\x00\x01"
+	m, err := DecodeNetpbm(strings.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if g, ok := m.(*image.Gray); !ok || g.Pix[0] != 0 || g.Pix[1] != 255 {
+		t.Errorf("Expected black and white, got %v", m)
+	}
+	data = "P7\nWIDTH 1\nHEIGHT 1\nDEPTH 4\nMAXVAL 255\nTUPLTYPE RGB_ALPHA\nENDHDR\n\x10\x20\x30\x80"
+	if m, err = DecodeNetpbm(strings.NewReader(data)); err != nil {
+		t.Fatal(err)
+	}
+	if c := m.At(0, 0); c != (color.NRGBA{0x10, 0x20, 0x30, 0x80}) {
+		t.Errorf("Expected a color with alpha, got %v", c)
+	}
+}
+
+func TestDecodeNetpbmErrors(t *testing.T) {
+	for _, data := range []string{"", "P8 1 1 1", "P2 1 1 0 0", "P2 0 1 255", "P5 2 2 255\n\x00", "P1 2 1 02", "P7\nWIDTH 1\nHEIGHT 1\nDEPTH 5\nMAXVAL 255\nENDHDR\n"} {
+		if _, err := DecodeNetpbm(strings.NewReader(data)); err == nil {
+			t.Errorf("Expected an error for %q", data)
+		}
+	}
+}
+
+func TestNetpbmRoundTrip(t *testing.T) {
+	rgba := testImage()
+	gray := image.NewGray(rgba.Bounds())
+	gray16 := image.NewGray16(rgba.Bounds())
+	rgba64 := image.NewRGBA64(rgba.Bounds())
+	nrgba := image.NewNRGBA(rgba.Bounds())
+	bw := image.NewGray(rgba.Bounds())
+	for y := 0; y < 3; y++ {
+		for x := 0; x < 4; x++ {
+			gray.Set(x, y, rgba.At(x, y))
+			gray16.SetGray16(x, y, color.Gray16{uint16(x*20000 + y*1000 + 1)})
+			rgba64.SetRGBA64(x, y, color.RGBA64{uint16(x * 20001), uint16(y * 30001), 12345, 65535})
+			nrgba.SetNRGBA(x, y, color.NRGBA{uint8(x * 80), uint8(y * 120), 128, uint8(x * 60)})
+			bw.SetGray(x, y, color.Gray{uint8((x + y) % 2 * 255)})
+		}
+	}
+	tests := []struct {
+		format string
+		m      image.Image
+	}{
+		{"pbm", bw},
+		{"pgm", gray},
+		{"pgm", gray16},
+		{"ppm", rgba},
+		{"ppm", rgba64},
+		{"pam", gray},
+		{"pam", rgba64},
+		{"pam", nrgba},
+	}
+	for _, test := range tests {
+		for _, plain := range []bool{false, true} {
+			var buf bytes.Buffer
+			if err := Encode(&buf, test.m, test.format, &EncodeOptions{NetpbmPlain: plain}); err != nil {
+				t.Fatal(err)
+			}
+			m, format, err := Decode(&buf)
+			if err != nil {
+				t.Fatalf("%s: %v", test.format, err)
+			}
+			if format != test.format {
+				t.Errorf("Expected %s, got %s", test.format, format)
+			}
+			rect := test.m.Bounds()
+			for y := rect.Min.Y; y < rect.Max.Y; y++ {
+				for x := rect.Min.X; x < rect.Max.X; x++ {
+					c1 := color.NRGBA64Model.Convert(test.m.At(x, y))
+					c2 := color.NRGBA64Model.Convert(m.At(x, y))
+					if c1 != c2 {
+						t.Fatalf("%s (%T, plain: %v): expected %v at (%d, %d), got %v", test.format, test.m, plain, c1, x, y, c2)
+					}
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package plates
+
+import (
+	"runtime"
+)
+
+// Option configures how an image is processed.
+// Options can be given at the end of the argument list of the functions
+// that process images, for example:
+//
+//	plates.Separate3(img, color1, color2, color3, 255, plates.Workers(4))
+type Option func(*config)
+
+// config is the configuration that is built up by a list of Option
+type config struct {
+	workers   int
+	progress  func(done, total int)
+	linear    bool
+	threshold float64
+	metric    Distance
+	cmyk      CMYKOptions
+}
+
+// newConfig returns the configuration for the given options
+func newConfig(opts []Option) *config {
+	cfg := &config{
+		workers: 1,
+		cmyk:    DefaultCMYKOptions,
+	}
+	for _, opt := range opts {
+		if opt != nil {
+			opt(cfg)
+		}
+	}
+	return cfg
+}
+
+// Workers sets the number of goroutines that are used for processing an image.
+// The image is split into bands of rows, that are processed concurrently.
+// The result is the same regardless of the number of workers.
+// By default, one worker is used. If n is 0 or less, the number of workers is runtime.GOMAXPROCS(0).
+// When more than one worker is used, a custom Distance must be safe for concurrent use.
+func Workers(n int) Option {
+	return func(cfg *config) {
+		if n <= 0 {
+			n = runtime.GOMAXPROCS(0)
+		}
+		cfg.workers = n
+	}
+}
+
+// Progress sets a function that is called after each row of the image
+// has been processed, with the number of completed rows and the total
+// number of rows. The calls are never concurrent, and done increases
+// by one for each call, even when several workers are used.
+func Progress(f func(done, total int)) Option {
+	return func(cfg *config) {
+		cfg.progress = f
+	}
+}
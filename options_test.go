@@ -0,0 +1,111 @@
+package plates
+
+import (
+	"context"
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestWorkers(t *testing.T) {
+	var (
+		red    = color.RGBA{255, 0, 0, 255}
+		green  = color.RGBA{0, 255, 0, 255}
+		blue   = color.RGBA{0, 0, 255, 255}
+		m      = randomImages(31, 23)["YCbCr"]
+		plates = SeparateN(m, []color.RGBA{red, green, blue}, Workers(1))
+	)
+	for _, n := range []int{0, 2, 3, 7, 23, 100} {
+		same(t, "Blue", Blue(m, Workers(1)), Blue(m, Workers(n)))
+		same(t, "CloseTo1", CloseTo1(m, red, 80, Workers(1)), CloseTo1(m, red, 80, Workers(n)))
+		same(t, "AddToAs", AddToAs(m, m, red, Workers(1)), AddToAs(m, m, red, Workers(n)))
+		for i, plate := range SeparateN(m, []color.RGBA{red, green, blue}, Workers(n)) {
+			same(t, "SeparateN", plates[i], plate)
+		}
+		c1, m1, y1, k1 := SeparateCMYK(m, Workers(1))
+		c2, m2, y2, k2 := SeparateCMYK(m, Workers(n))
+		same(t, "SeparateCMYK", c1, c2)
+		same(t, "SeparateCMYK", m1, m2)
+		same(t, "SeparateCMYK", y1, y2)
+		same(t, "SeparateCMYK", k1, k2)
+	}
+}
+
+func TestWorkersEmpty(t *testing.T) {
+	m := image.NewRGBA(image.Rect(0, 0, 0, 0))
+	if b := Red(m, Workers(4)).Bounds(); !b.Empty() {
+		t.Errorf("Expected an empty image, got %v", b)
+	}
+}
+
+func benchmarkWorkers(b *testing.B, n int) {
+	b.ReportAllocs()
+	m := benchmarkImages["RGBA"]
+	c1, c2, c3 := color.RGBA{255, 0, 0, 255}, color.RGBA{0, 255, 0, 255}, color.RGBA{0, 0, 255, 255}
+	for i := 0; i < b.N; i++ {
+		Separate3(m, c1, c2, c3, 255, Workers(n))
+	}
+}
+
+func BenchmarkSeparate3Workers1(b *testing.B) {
+	benchmarkWorkers(b, 1)
+}
+
+func BenchmarkSeparate3Workers4(b *testing.B) {
+	benchmarkWorkers(b, 4)
+}
+
+func TestProgress(t *testing.T) {
+	m := randomImages(8, 50)["RGBA"]
+	for _, n := range []int{1, 4} {
+		var calls, last int
+		Separate3(m, color.RGBA{255, 0, 0, 255}, color.RGBA{0, 255, 0, 255}, color.RGBA{0, 0, 255, 255}, 255, Workers(n), Progress(func(done, total int) {
+			calls++
+			if done != last+1 || total != 50 {
+				t.Errorf("Unexpected progress: %d of %d after %d", done, total, last)
+			}
+			last = done
+		}))
+		if calls != 50 {
+			t.Errorf("Expected 50 calls to the progress function, got %d", calls)
+		}
+	}
+}
+
+func TestContextCancel(t *testing.T) {
+	m := randomImages(8, 50)["RGBA"]
+	red := color.RGBA{255, 0, 0, 255}
+	for _, n := range []int{1, 4} {
+		ctx, cancel := context.WithCancel(context.Background())
+		rows := 0
+		_, err := AddToAsContext(ctx, m, m, red, Workers(n), Progress(func(done, total int) {
+			rows = done
+			if done == 10 {
+				cancel()
+			}
+		}))
+		if err != context.Canceled {
+			t.Errorf("Expected context.Canceled, got %v", err)
+		}
+		if rows >= 50 {
+			t.Errorf("Expected the processing to stop early, but all %d rows were processed", rows)
+		}
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, _, _, err := Separate3Context(ctx, m, red, red, red, 255); err != context.Canceled {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+	if _, _, _, _, err := SeparateCMYKContext(ctx, m); err != context.Canceled {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+	if _, err := CloseTo2Context(context.Background(), m, red, 10); err != nil {
+		t.Errorf("Expected no error, got %v", err)
+	}
+}
+
+func TestWorkersDefault(t *testing.T) {
+	if workers := newConfig(nil).workers; workers != 1 {
+		t.Errorf("Expected one worker by default, got %d", workers)
+	}
+}
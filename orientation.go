@@ -0,0 +1,132 @@
+package plates
+
+import (
+	"encoding/binary"
+	"image"
+	"image/color"
+)
+
+// exifOrientationTag is the EXIF tag for the orientation of the image
+const exifOrientationTag = 0x0112
+
+// exifOrientationOffset returns the offset of the orientation value in EXIF data,
+// which is TIFF structured, together with the byte order. The offset is -1 if
+// there is no orientation tag.
+func exifOrientationOffset(exif []byte) (int, binary.ByteOrder) {
+	if len(exif) < 8 {
+		return -1, nil
+	}
+	var order binary.ByteOrder
+	switch string(exif[:4]) {
+	case "II*\x00":
+		order = binary.LittleEndian
+	case "MM\x00*":
+		order = binary.BigEndian
+	default:
+		return -1, nil
+	}
+	ifd := int(order.Uint32(exif[4:]))
+	if ifd < 8 || ifd+2 > len(exif) {
+		return -1, nil
+	}
+	n := int(order.Uint16(exif[ifd:]))
+	for i := 0; i < n; i++ {
+		entry := ifd + 2 + 12*i
+		if entry+12 > len(exif) {
+			break
+		}
+		// The orientation is a single SHORT, which is stored in the entry itself
+		if order.Uint16(exif[entry:]) == exifOrientationTag && order.Uint16(exif[entry+2:]) == tiffShort {
+			return entry + 8, order
+		}
+	}
+	return -1, nil
+}
+
+// exifOrientation returns the orientation from EXIF data, from 1 to 8, or 1 if there is none
+func exifOrientation(exif []byte) int {
+	offset, order := exifOrientationOffset(exif)
+	if offset < 0 {
+		return 1
+	}
+	if o := int(order.Uint16(exif[offset:])); o >= 1 && o <= 8 {
+		return o
+	}
+	return 1
+}
+
+// setEXIFOrientation changes the orientation in EXIF data, if it has an orientation tag
+func setEXIFOrientation(exif []byte, orientation int) {
+	if offset, order := exifOrientationOffset(exif); offset >= 0 {
+		order.PutUint16(exif[offset:], uint16(orientation))
+	}
+}
+
+// newImageLike returns a new image with the given bounds, and the same type as m where
+// that type can hold any of the colors in m. Other images give an *image.RGBA64.
+func newImageLike(m image.Image, rect image.Rectangle) interface {
+	image.Image
+	Set(x, y int, c color.Color)
+} {
+	switch m := m.(type) {
+	case *image.Gray:
+		return image.NewGray(rect)
+	case *image.Gray16:
+		return image.NewGray16(rect)
+	case *image.RGBA:
+		return image.NewRGBA(rect)
+	case *image.NRGBA:
+		return image.NewNRGBA(rect)
+	case *image.NRGBA64:
+		return image.NewNRGBA64(rect)
+	case *image.CMYK:
+		return image.NewCMYK(rect)
+	case *image.Paletted:
+		return image.NewPaletted(rect, m.Palette)
+	case *image.YCbCr, *image.NYCbCrA:
+		// Converting from Y'CbCr gives 8 bits per channel
+		return image.NewRGBA(rect)
+	}
+	return image.NewRGBA64(rect)
+}
+
+// ApplyOrientation rotates and flips an image according to an EXIF orientation from 1 to 8,
+// so that it is shown the right way up. For orientation 1, or an invalid orientation, m is returned as it is.
+// Orientations 5 to 8 swap the width and the height. The returned image starts at (0, 0).
+func ApplyOrientation(m image.Image, orientation int) image.Image {
+	if orientation < 2 || orientation > 8 {
+		return m
+	}
+	var (
+		src  = m.Bounds()
+		w, h = src.Dx(), src.Dy()
+	)
+	if orientation >= 5 {
+		w, h = h, w
+	}
+	dst := newImageLike(m, image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			// Find the source pixel for each destination pixel
+			var sx, sy int
+			switch orientation {
+			case 2: // flipped horizontally
+				sx, sy = w-1-x, y
+			case 3: // rotated 180 degrees
+				sx, sy = w-1-x, h-1-y
+			case 4: // flipped vertically
+				sx, sy = x, h-1-y
+			case 5: // transposed
+				sx, sy = y, x
+			case 6: // rotated 90 degrees counter-clockwise, so it must be turned clockwise
+				sx, sy = y, w-1-x
+			case 7: // transversed
+				sx, sy = h-1-y, w-1-x
+			case 8: // rotated 90 degrees clockwise, so it must be turned counter-clockwise
+				sx, sy = h-1-y, x
+			}
+			dst.Set(x, y, m.At(src.Min.X+sx, src.Min.Y+sy))
+		}
+	}
+	return dst
+}
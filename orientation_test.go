@@ -0,0 +1,76 @@
+package plates
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestApplyOrientation(t *testing.T) {
+	// A 3x2 image where every pixel has its own gray value
+	m := image.NewGray(image.Rect(10, 20, 13, 22))
+	for i := range m.Pix {
+		m.Pix[i] = uint8(i)
+	}
+	// The expected pixels, row by row, for each orientation
+	expected := map[int][][]uint8{
+		1: {{0, 1, 2}, {3, 4, 5}},
+		2: {{2, 1, 0}, {5, 4, 3}},
+		3: {{5, 4, 3}, {2, 1, 0}},
+		4: {{3, 4, 5}, {0, 1, 2}},
+		5: {{0, 3}, {1, 4}, {2, 5}},
+		6: {{3, 0}, {4, 1}, {5, 2}},
+		7: {{5, 2}, {4, 1}, {3, 0}},
+		8: {{2, 5}, {1, 4}, {0, 3}},
+	}
+	for orientation, rows := range expected {
+		oriented := ApplyOrientation(m, orientation)
+		if orientation != 1 {
+			if _, ok := oriented.(*image.Gray); !ok {
+				t.Errorf("Orientation %d: expected an *image.Gray, got %T", orientation, oriented)
+			}
+			if oriented.Bounds().Min != (image.Point{}) {
+				t.Errorf("Orientation %d: expected the image to start at (0, 0), got %v", orientation, oriented.Bounds())
+			}
+		}
+		rect := oriented.Bounds()
+		if rect.Dx() != len(rows[0]) || rect.Dy() != len(rows) {
+			t.Fatalf("Orientation %d: expected %dx%d, got %dx%d", orientation, len(rows[0]), len(rows), rect.Dx(), rect.Dy())
+		}
+		for y, row := range rows {
+			for x, v := range row {
+				if c := oriented.At(rect.Min.X+x, rect.Min.Y+y); c != (color.Gray{v}) {
+					t.Errorf("Orientation %d: expected %d at (%d, %d), got %v", orientation, v, x, y, c)
+				}
+			}
+		}
+	}
+	if ApplyOrientation(m, 9) != image.Image(m) {
+		t.Error("Expected an invalid orientation to leave the image as it is")
+	}
+}
+
+func TestEXIFOrientation(t *testing.T) {
+	for _, exif := range [][]byte{exifWithOrientation(6, false), exifWithOrientation(6, true)} {
+		if o := exifOrientation(exif); o != 6 {
+			t.Errorf("Expected orientation 6, got %d", o)
+		}
+		setEXIFOrientation(exif, 1)
+		if o := exifOrientation(exif); o != 1 {
+			t.Errorf("Expected orientation 1, got %d", o)
+		}
+	}
+	for _, exif := range [][]byte{nil, []byte("MM\x00*\x00\x00\x00\x08"), []byte("not exif data")} {
+		if o := exifOrientation(exif); o != 1 {
+			t.Errorf("Expected orientation 1 for %q, got %d", exif, o)
+		}
+	}
+}
+
+// exifWithOrientation returns EXIF data with a single orientation tag
+func exifWithOrientation(orientation uint16, littleEndian bool) []byte {
+	if littleEndian {
+		return []byte{'I', 'I', 42, 0, 8, 0, 0, 0, 1, 0, 0x12, 0x01, 3, 0, 1, 0, 0, 0, byte(orientation), 0, 0, 0, 0, 0, 0, 0}
+	}
+	return []byte{'M', 'M', 0, 42, 0, 0, 0, 8, 0, 1, 0x01, 0x12, 0, 3, 0, 0, 0, 1, 0, byte(orientation), 0, 0, 0, 0, 0, 0}
+}
@@ -0,0 +1,199 @@
+package plates
+
+import (
+	"image/color"
+	"math"
+)
+
+// MixPigments uses the Kubelka-Munk theory, where each pigment absorbs (K) and scatters (S)
+// light, and the K/S ratios of pigments mix linearly. Each color is turned into a reflectance
+// spectrum, the spectra are mixed, and the mix is turned back into a color with the CIE color
+// matching functions. The spectrum of a color is a sum of three smooth curves, for red, green
+// and blue, which does not give back exactly the same color, so the difference for each color
+// is added back to the mix, weighted like the colors. Mixing a color with itself gives the same color.
+
+// Sampling of the visible spectrum, in nanometers
+const (
+	pigmentFirstWavelength = 380.0
+	pigmentStep            = 10.0
+	pigmentSamples         = 36
+	// pigmentMinReflectance is the least light that a pigment reflects, like real pigments do,
+	// which also keeps K/S from being infinite
+	pigmentMinReflectance = 0.03
+)
+
+// spectrum is a reflectance for each sampled wavelength, from 0 to 1
+type spectrum [pigmentSamples]float64
+
+var (
+	// pigmentBasis has the spectra of red, green and blue, which add up to 1 for every wavelength
+	pigmentBasis = newPigmentBasis()
+
+	// pigmentCMF has the CIE 1931 color matching functions, as x, y and z for every wavelength
+	pigmentCMF = newPigmentCMF()
+
+	// pigmentWhite is the linear RGB color of a spectrum that reflects all light
+	pigmentWhite = func() rgbFloat {
+		var white spectrum
+		for i := range white {
+			white[i] = 1
+		}
+		return white.xyzToLinear()
+	}()
+)
+
+// wavelength returns the wavelength of sample i, in nanometers
+func wavelength(i int) float64 {
+	return pigmentFirstWavelength + pigmentStep*float64(i)
+}
+
+// logistic is a smooth step from 0 to 1, centered at x0, and with a width of about 4 times w
+func logistic(x, x0, w float64) float64 {
+	return 1.0 / (1.0 + math.Exp(-(x-x0)/w))
+}
+
+// newPigmentBasis returns the spectra of red, green and blue. Blue reflects the short
+// wavelengths and red the long ones, with smooth edges, and green reflects the rest.
+func newPigmentBasis() [3]spectrum {
+	var basis [3]spectrum
+	for i := 0; i < pigmentSamples; i++ {
+		l := wavelength(i)
+		blue := 1 - logistic(l, 490, 15)
+		red := logistic(l, 600, 8)
+		basis[0][i], basis[1][i], basis[2][i] = red, math.Max(0, 1-red-blue), blue
+	}
+	return basis
+}
+
+// lobe is a Gaussian with different widths below and above the center
+func lobe(x, center, below, above float64) float64 {
+	w := above
+	if x < center {
+		w = below
+	}
+	return math.Exp(-0.5 * sq((x-center)/w))
+}
+
+// newPigmentCMF returns the CIE 1931 color matching functions,
+// with the multi-lobe fit by Wyman, Sloan and Shirley (2013)
+func newPigmentCMF() [pigmentSamples][3]float64 {
+	var cmf [pigmentSamples][3]float64
+	for i := range cmf {
+		l := wavelength(i)
+		cmf[i] = [3]float64{
+			1.056*lobe(l, 599.8, 37.9, 31.0) + 0.362*lobe(l, 442.0, 16.0, 26.7) - 0.065*lobe(l, 501.1, 20.4, 26.2),
+			0.821*lobe(l, 568.8, 46.9, 40.5) + 0.286*lobe(l, 530.9, 16.3, 31.1),
+			1.217*lobe(l, 437.0, 11.8, 36.0) + 0.681*lobe(l, 459.0, 26.0, 13.8),
+		}
+	}
+	return cmf
+}
+
+// rgbSpectrum returns the reflectance spectrum for a color in linear light
+func rgbSpectrum(c rgbFloat) spectrum {
+	var s spectrum
+	for i := range s {
+		v := c[0]*pigmentBasis[0][i] + c[1]*pigmentBasis[1][i] + c[2]*pigmentBasis[2][i]
+		s[i] = math.Min(1, math.Max(pigmentMinReflectance, v))
+	}
+	return s
+}
+
+// xyzToLinear returns the linear light RGB color of the light that is reflected by s,
+// before it is scaled so that white is (1, 1, 1)
+func (s *spectrum) xyzToLinear() rgbFloat {
+	var x, y, z float64
+	for i, r := range s {
+		x += r * pigmentCMF[i][0]
+		y += r * pigmentCMF[i][1]
+		z += r * pigmentCMF[i][2]
+	}
+	r, g, b := xyzToLinear(x, y, z)
+	return rgbFloat{r, g, b}
+}
+
+// linear returns the linear light RGB color of the light that is reflected by s
+func (s *spectrum) linear() rgbFloat {
+	c := s.xyzToLinear()
+	return rgbFloat{c[0] / pigmentWhite[0], c[1] / pigmentWhite[1], c[2] / pigmentWhite[2]}
+}
+
+// luminance returns the relative luminance of a color in linear light
+func luminance(c rgbFloat) float64 {
+	return 0.2126729*c[0] + 0.7151522*c[1] + 0.0721750*c[2]
+}
+
+// MixPigments mixes colors like paint, where the weights are the amounts of each color.
+// Unlike PaintMix, it models how pigments absorb and scatter light, with the
+// Kubelka-Munk theory, so that blue and yellow gives green, and a little black
+// darkens a color a lot. If weights is nil, all colors are mixed in equal amounts.
+// A color without a weight, or with a weight that is 0 or less, is not mixed in.
+// The alpha of the mix is the weighted average of the alpha of the colors, and more
+// transparent colors have less effect on the mix. If there is nothing to mix, the
+// returned color is transparent.
+func MixPigments(colors []color.RGBA, weights []float64) color.RGBA {
+	var (
+		ks            spectrum
+		residual      rgbFloat
+		concentration float64
+		amount        float64
+		total         float64
+		alpha         float64
+	)
+	for i, c := range colors {
+		w := 1.0
+		if weights != nil {
+			if i >= len(weights) || !(weights[i] > 0) {
+				continue
+			}
+			w = weights[i]
+		}
+		total += w
+		if c.A == 0 {
+			continue
+		}
+		// The amount of pigment follows alpha, and the colors are premultiplied
+		w *= float64(c.A) / 255.0
+		alpha += w
+		var (
+			lc = rgbFloat{
+				premultipliedToLinear(c.R, c.A) / float64(c.A),
+				premultipliedToLinear(c.G, c.A) / float64(c.A),
+				premultipliedToLinear(c.B, c.A) / float64(c.A),
+			}
+			s = rgbSpectrum(lc)
+			// Dark pigments are strong, so the concentration is scaled by the luminance,
+			// which keeps a mix of the same amounts of black and white from being almost black
+			cw            = w * math.Max(luminance(lc), 0.05)
+			approximation = s.linear()
+		)
+		for j, r := range s {
+			ks[j] += cw * sq(1-r) / (2 * r)
+		}
+		for j := range residual {
+			residual[j] += w * (lc[j] - approximation[j])
+		}
+		concentration += cw
+		amount += w
+	}
+	if amount == 0 {
+		return color.RGBA{}
+	}
+	// Go from the K/S ratio of the mix back to a reflectance
+	var mix spectrum
+	for j := range mix {
+		k := ks[j] / concentration
+		mix[j] = 1 + k - math.Sqrt(k*k+2*k)
+	}
+	lc := mix.linear()
+	for j := range lc {
+		lc[j] += residual[j] / amount
+	}
+	a := alpha / total
+	return color.RGBA{
+		uint8(float64(LinearToSRGB(lc[0]))*a + 0.5),
+		uint8(float64(LinearToSRGB(lc[1]))*a + 0.5),
+		uint8(float64(LinearToSRGB(lc[2]))*a + 0.5),
+		uint8(a*255.0 + 0.5),
+	}
+}
@@ -0,0 +1,73 @@
+package plates
+
+import (
+	"image/color"
+	"testing"
+)
+
+func TestMixPigments(t *testing.T) {
+	var (
+		blue   = color.RGBA{0, 0, 255, 255}
+		yellow = color.RGBA{255, 255, 0, 255}
+		red    = color.RGBA{255, 0, 0, 255}
+		white  = color.RGBA{255, 255, 255, 255}
+		black  = color.RGBA{0, 0, 0, 255}
+	)
+	// Blue and yellow gives green, unlike with PaintMix
+	if c := MixPigments([]color.RGBA{blue, yellow}, nil); c.G <= c.R || c.G <= c.B {
+		t.Errorf("Expected green, got %v", c)
+	}
+	// Red and white gives pink
+	if c := MixPigments([]color.RGBA{red, white}, nil); c.R != 255 || c.G < 64 || absdiff(c.G, c.B) > 16 {
+		t.Errorf("Expected pink, got %v", c)
+	}
+	// Red and yellow gives orange
+	if c := MixPigments([]color.RGBA{red, yellow}, nil); c.R < 240 || c.G < 64 || c.G > 192 || c.B > 64 {
+		t.Errorf("Expected orange, got %v", c)
+	}
+	// Red and blue gives a dark purple
+	if c := MixPigments([]color.RGBA{red, blue}, nil); c.R < c.G || c.B < c.G || c.R > 192 {
+		t.Errorf("Expected a dark purple, got %v", c)
+	}
+	// More white gives a lighter gray
+	light := MixPigments([]color.RGBA{black, white}, []float64{1, 3})
+	dark := MixPigments([]color.RGBA{black, white}, []float64{1, 1})
+	if light.R != light.G || light.G != light.B || light.R <= dark.R || dark.R < 32 || dark.R > 224 {
+		t.Errorf("Expected grays where more white is lighter, got %v and %v", light, dark)
+	}
+}
+
+func TestMixPigmentsSameColor(t *testing.T) {
+	for _, c := range []color.RGBA{{0, 0, 255, 255}, {12, 200, 99, 255}, {255, 255, 255, 255}, {0, 0, 0, 255}, {100, 50, 25, 128}} {
+		if mix := MixPigments([]color.RGBA{c, c, c}, []float64{0.2, 1, 5}); mix != c {
+			t.Errorf("Expected %v when mixing it with itself, got %v", c, mix)
+		}
+		if mix := MixPigments([]color.RGBA{c}, nil); mix != c {
+			t.Errorf("Expected %v, got %v", c, mix)
+		}
+	}
+}
+
+func TestMixPigmentsWeights(t *testing.T) {
+	var (
+		red  = color.RGBA{255, 0, 0, 255}
+		blue = color.RGBA{0, 0, 255, 255}
+	)
+	// Colors without a positive weight are left out
+	if c := MixPigments([]color.RGBA{red, blue}, []float64{1, 0}); c != red {
+		t.Errorf("Expected red, got %v", c)
+	}
+	if c := MixPigments([]color.RGBA{red, blue}, []float64{1}); c != red {
+		t.Errorf("Expected red, got %v", c)
+	}
+	if c := MixPigments([]color.RGBA{red, blue}, []float64{-1, 0}); c != (color.RGBA{}) {
+		t.Errorf("Expected a transparent color, got %v", c)
+	}
+	if c := MixPigments(nil, nil); c != (color.RGBA{}) {
+		t.Errorf("Expected a transparent color, got %v", c)
+	}
+	// A transparent color only makes the mix more transparent
+	if c := MixPigments([]color.RGBA{red, {}}, nil); c != (color.RGBA{128, 0, 0, 128}) {
+		t.Errorf("Expected half transparent red, got %v", c)
+	}
+}
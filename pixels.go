@@ -0,0 +1,273 @@
+package plates
+
+import (
+	"context"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"sync"
+)
+
+// rowReader reads one row of pixels into dst, as premultiplied 8-bit RGBA,
+// with 4 bytes per pixel. The result is the same as converting each pixel
+// with color.RGBAModel, but without going through the image.Image interface
+// for the most common image types.
+// Readers from newRowReader64 read premultiplied 16-bit RGBA instead, with 8 bytes
+// per pixel, in the same big-endian layout as the Pix of an *image.RGBA64.
+type rowReader func(y int, dst []uint8)
+
+// newRowReader returns a rowReader that reads the pixels from rect.Min.X to rect.Max.X
+// of m. Pixels that are outside of the bounds of m are read as transparent.
+func newRowReader(m image.Image, rect image.Rectangle) rowReader {
+	return spanRowReader(m, rect, 4, newSpanReader(m))
+}
+
+// newRowReader64 is like newRowReader, but reads 16-bit pixels, for images where is16Bit is true
+func newRowReader64(m image.Image, rect image.Rectangle) rowReader {
+	return spanRowReader(m, rect, 8, newSpanReader64(m))
+}
+
+// is16Bit checks if an image has more than 8 bits per channel
+func is16Bit(m image.Image) bool {
+	switch m.(type) {
+	case *image.Gray16, *image.RGBA64, *image.NRGBA64:
+		return true
+	}
+	return false
+}
+
+// spanRowReader returns a rowReader that uses read for the part of each row that is within
+// the bounds of m, where each pixel is the given number of bytes
+func spanRowReader(m image.Image, rect image.Rectangle, bytesPerPixel int, read spanReader) rowReader {
+	bounds := m.Bounds()
+	x0, x1 := rect.Min.X, rect.Max.X
+	if x0 < bounds.Min.X {
+		x0 = bounds.Min.X
+	}
+	if x1 > bounds.Max.X {
+		x1 = bounds.Max.X
+	}
+	return func(y int, dst []uint8) {
+		dst = dst[:bytesPerPixel*rect.Dx()]
+		if y < bounds.Min.Y || y >= bounds.Max.Y || x0 >= x1 {
+			clear8(dst)
+			return
+		}
+		// Clear the parts of the row that are outside of m
+		start, end := bytesPerPixel*(x0-rect.Min.X), bytesPerPixel*(x1-rect.Min.X)
+		clear8(dst[:start])
+		clear8(dst[end:])
+		read(x0, x1, y, dst[start:end])
+	}
+}
+
+// spanReader reads the pixels from x0 to x1 on row y into dst, as premultiplied 8-bit RGBA.
+// The pixels must be within the bounds of the image.
+type spanReader func(x0, x1, y int, dst []uint8)
+
+// newSpanReader returns a spanReader with a fast path for the given image type,
+// if there is one, or a spanReader that uses m.At if there is not.
+func newSpanReader(m image.Image) spanReader {
+	switch m := m.(type) {
+	case *image.RGBA:
+		return func(x0, x1, y int, dst []uint8) {
+			i := m.PixOffset(x0, y)
+			copy(dst, m.Pix[i:i+4*(x1-x0)])
+		}
+	case *image.NRGBA:
+		return func(x0, x1, y int, dst []uint8) {
+			src := m.Pix[m.PixOffset(x0, y):]
+			for i := 0; i < len(dst); i += 4 {
+				switch a := src[i+3]; a {
+				case 0xff:
+					dst[i], dst[i+1], dst[i+2], dst[i+3] = src[i], src[i+1], src[i+2], a
+				case 0:
+					dst[i], dst[i+1], dst[i+2], dst[i+3] = 0, 0, 0, 0
+				default:
+					r, g, b, _ := color.NRGBA{src[i], src[i+1], src[i+2], a}.RGBA()
+					dst[i], dst[i+1], dst[i+2], dst[i+3] = uint8(r>>8), uint8(g>>8), uint8(b>>8), a
+				}
+			}
+		}
+	case *image.YCbCr:
+		return func(x0, x1, y int, dst []uint8) {
+			for x, i := x0, 0; x < x1; x, i = x+1, i+4 {
+				yi, ci := m.YOffset(x, y), m.COffset(x, y)
+				r, g, b, _ := color.YCbCr{m.Y[yi], m.Cb[ci], m.Cr[ci]}.RGBA()
+				dst[i], dst[i+1], dst[i+2], dst[i+3] = uint8(r>>8), uint8(g>>8), uint8(b>>8), 0xff
+			}
+		}
+	case *image.Gray:
+		return func(x0, x1, y int, dst []uint8) {
+			src := m.Pix[m.PixOffset(x0, y):]
+			for x, i := 0, 0; i < len(dst); x, i = x+1, i+4 {
+				v := src[x]
+				dst[i], dst[i+1], dst[i+2], dst[i+3] = v, v, v, 0xff
+			}
+		}
+	case *image.Paletted:
+		// Colors outside of the palette are read as transparent
+		var palette [256]color.RGBA
+		for i, c := range m.Palette {
+			if i < len(palette) {
+				palette[i] = color.RGBAModel.Convert(c).(color.RGBA)
+			}
+		}
+		return func(x0, x1, y int, dst []uint8) {
+			src := m.Pix[m.PixOffset(x0, y):]
+			for x, i := 0, 0; i < len(dst); x, i = x+1, i+4 {
+				c := palette[src[x]]
+				dst[i], dst[i+1], dst[i+2], dst[i+3] = c.R, c.G, c.B, c.A
+			}
+		}
+	}
+	return func(x0, x1, y int, dst []uint8) {
+		for x, i := x0, 0; x < x1; x, i = x+1, i+4 {
+			c := color.RGBAModel.Convert(m.At(x, y)).(color.RGBA)
+			dst[i], dst[i+1], dst[i+2], dst[i+3] = c.R, c.G, c.B, c.A
+		}
+	}
+}
+
+// newSpanReader64 returns a spanReader that reads premultiplied 16-bit RGBA, with 8 bytes per pixel,
+// with a fast path for the given image type, if there is one, or a spanReader that uses m.At if there is not
+func newSpanReader64(m image.Image) spanReader {
+	switch m := m.(type) {
+	case *image.RGBA64:
+		return func(x0, x1, y int, dst []uint8) {
+			i := m.PixOffset(x0, y)
+			copy(dst, m.Pix[i:i+8*(x1-x0)])
+		}
+	case *image.NRGBA64:
+		return func(x0, x1, y int, dst []uint8) {
+			src := m.Pix[m.PixOffset(x0, y):]
+			for i := 0; i < len(dst); i += 8 {
+				c := get64(src[i:])
+				r, g, b, a := color.NRGBA64{c.R, c.G, c.B, c.A}.RGBA()
+				put64(dst[i:], color.RGBA64{uint16(r), uint16(g), uint16(b), uint16(a)})
+			}
+		}
+	case *image.Gray16:
+		return func(x0, x1, y int, dst []uint8) {
+			src := m.Pix[m.PixOffset(x0, y):]
+			for x, i := 0, 0; i < len(dst); x, i = x+2, i+8 {
+				hi, lo := src[x], src[x+1]
+				dst[i], dst[i+1], dst[i+2], dst[i+3], dst[i+4], dst[i+5], dst[i+6], dst[i+7] = hi, lo, hi, lo, hi, lo, 0xff, 0xff
+			}
+		}
+	}
+	return func(x0, x1, y int, dst []uint8) {
+		for x, i := x0, 0; x < x1; x, i = x+1, i+8 {
+			r, g, b, a := m.At(x, y).RGBA()
+			put64(dst[i:], color.RGBA64{uint16(r), uint16(g), uint16(b), uint16(a)})
+		}
+	}
+}
+
+// get64 returns the 16-bit color at the start of p, which is in the layout of the Pix of an *image.RGBA64
+func get64(p []uint8) color.RGBA64 {
+	return color.RGBA64{
+		binary.BigEndian.Uint16(p),
+		binary.BigEndian.Uint16(p[2:]),
+		binary.BigEndian.Uint16(p[4:]),
+		binary.BigEndian.Uint16(p[6:]),
+	}
+}
+
+// put64 writes a 16-bit color to the start of p, in the layout of the Pix of an *image.RGBA64
+func put64(p []uint8, c color.RGBA64) {
+	binary.BigEndian.PutUint16(p, c.R)
+	binary.BigEndian.PutUint16(p[2:], c.G)
+	binary.BigEndian.PutUint16(p[4:], c.B)
+	binary.BigEndian.PutUint16(p[6:], c.A)
+}
+
+// to64 converts an 8-bit color to a 16-bit color
+func to64(c color.RGBA) color.RGBA64 {
+	return color.RGBA64{uint16(c.R) * 0x101, uint16(c.G) * 0x101, uint16(c.B) * 0x101, uint16(c.A) * 0x101}
+}
+
+// eachRow calls f for each row y in rect. The rows are split into bands,
+// one for each worker in cfg, that are processed concurrently.
+// f is given a scratch buffer with room for n bytes, that it can use for reading pixels.
+// The buffer is shared by all rows in a band, but not between bands.
+// The context is checked before each row, and if it is done, the processing
+// is stopped and the error from the context is returned.
+func eachRow(ctx context.Context, cfg *config, rect image.Rectangle, n int, f func(y int, buf []uint8)) error {
+	var (
+		mu    sync.Mutex
+		done  int
+		total = rect.Dy()
+	)
+	report := func() {
+		if cfg.progress == nil {
+			return
+		}
+		mu.Lock()
+		done++
+		cfg.progress(done, total)
+		mu.Unlock()
+	}
+	rows := func(y0, y1 int) error {
+		buf := make([]uint8, n)
+		for y := y0; y < y1; y++ {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			f(y, buf)
+			report()
+		}
+		return nil
+	}
+	workers := cfg.workers
+	if workers > total {
+		workers = total
+	}
+	if workers <= 1 {
+		return rows(rect.Min.Y, rect.Max.Y)
+	}
+	var (
+		wg     sync.WaitGroup
+		band   = (total + workers - 1) / workers
+		errs   = make(chan error, workers)
+		result error
+	)
+	for y0 := rect.Min.Y; y0 < rect.Max.Y; y0 += band {
+		y1 := y0 + band
+		if y1 > rect.Max.Y {
+			y1 = rect.Max.Y
+		}
+		wg.Add(1)
+		go func(y0, y1 int) {
+			defer wg.Done()
+			if err := rows(y0, y1); err != nil {
+				errs <- err
+			}
+		}(y0, y1)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		result = err
+	}
+	return result
+}
+
+// rowOf returns the pixels of row y of an *image.RGBA
+func rowOf(m *image.RGBA, y int) []uint8 {
+	i := m.PixOffset(m.Rect.Min.X, y)
+	return m.Pix[i : i+4*m.Rect.Dx()]
+}
+
+// rowOf64 returns the pixels of row y of an *image.RGBA64
+func rowOf64(m *image.RGBA64, y int) []uint8 {
+	i := m.PixOffset(m.Rect.Min.X, y)
+	return m.Pix[i : i+8*m.Rect.Dx()]
+}
+
+// clear8 sets all bytes in the given slice to 0
+func clear8(b []uint8) {
+	for i := range b {
+		b[i] = 0
+	}
+}
@@ -0,0 +1,200 @@
+package plates
+
+import (
+	"image"
+	"image/color"
+	"math/rand"
+	"testing"
+)
+
+// genericImage hides the type of an image, so that only the generic code paths are used
+type genericImage struct {
+	image.Image
+}
+
+// randomImages returns images of all the types that have fast paths, filled with random pixels
+func randomImages(w, h int) map[string]image.Image {
+	var (
+		rng      = rand.New(rand.NewSource(42))
+		rect     = image.Rect(3, 5, 3+w, 5+h)
+		rgba     = image.NewRGBA(rect)
+		nrgba    = image.NewNRGBA(rect)
+		gray     = image.NewGray(rect)
+		paletted = image.NewPaletted(rect, color.Palette{color.Black, color.White, color.RGBA{255, 0, 0, 255}, color.NRGBA{0, 0, 255, 128}})
+		ycbcr    = image.NewYCbCr(rect, image.YCbCrSubsampleRatio420)
+	)
+	rng.Read(rgba.Pix)
+	// Make the RGBA image valid premultiplied colors
+	for i := 0; i < len(rgba.Pix); i += 4 {
+		a := rgba.Pix[i+3]
+		rgba.Pix[i] = uint8(uint16(rgba.Pix[i]) * uint16(a) / 255)
+		rgba.Pix[i+1] = uint8(uint16(rgba.Pix[i+1]) * uint16(a) / 255)
+		rgba.Pix[i+2] = uint8(uint16(rgba.Pix[i+2]) * uint16(a) / 255)
+	}
+	rng.Read(nrgba.Pix)
+	rng.Read(gray.Pix)
+	for i := range paletted.Pix {
+		paletted.Pix[i] = uint8(rng.Intn(len(paletted.Palette)))
+	}
+	rng.Read(ycbcr.Y)
+	rng.Read(ycbcr.Cb)
+	rng.Read(ycbcr.Cr)
+	return map[string]image.Image{
+		"RGBA":     rgba,
+		"NRGBA":    nrgba,
+		"Gray":     gray,
+		"Paletted": paletted,
+		"YCbCr":    ycbcr,
+		// A sub image, where the stride is larger than the width
+		"SubImage": rgba.SubImage(image.Rect(4, 6, 2+w, 4+h)),
+	}
+}
+
+func TestRowReader(t *testing.T) {
+	for name, m := range randomImages(17, 9) {
+		rect := m.Bounds()
+		for y := rect.Min.Y; y < rect.Max.Y; y++ {
+			fast := make([]uint8, 4*rect.Dx())
+			generic := make([]uint8, 4*rect.Dx())
+			newRowReader(m, rect)(y, fast)
+			newRowReader(genericImage{m}, rect)(y, generic)
+			for i := range fast {
+				if fast[i] != generic[i] {
+					t.Fatalf("%s: the fast path differs from the generic path at row %d, byte %d: %d != %d", name, y, i, fast[i], generic[i])
+				}
+			}
+		}
+	}
+}
+
+func TestRowReaderOutside(t *testing.T) {
+	m := image.NewGray(image.Rect(0, 0, 2, 2))
+	m.Pix = []uint8{10, 20, 30, 40}
+	row := make([]uint8, 16)
+	for i := range row {
+		row[i] = 99
+	}
+	newRowReader(m, image.Rect(-1, 0, 3, 1))(1, row)
+	expected := []uint8{0, 0, 0, 0, 30, 30, 30, 255, 40, 40, 40, 255, 0, 0, 0, 0}
+	for i := range expected {
+		if row[i] != expected[i] {
+			t.Fatalf("Expected %v, got %v", expected, row)
+		}
+	}
+}
+
+func TestFastPaths(t *testing.T) {
+	red := color.RGBA{255, 0, 0, 255}
+	inks := []color.RGBA{red, {0, 0, 255, 255}, {255, 255, 255, 255}}
+	for name, m := range randomImages(13, 7) {
+		g := genericImage{m}
+		same(t, name+": Red", Red(m), Red(g))
+		same(t, name+": CloseTo1", CloseTo1(m, red, 100), CloseTo1(g, red, 100))
+		same(t, name+": CloseTo2", CloseTo2(m, red, 100), CloseTo2(g, red, 100))
+		same(t, name+": AddToAs", AddToAs(m, m, red), AddToAs(g, g, red))
+		plates, genericPlates := SeparateN(m, inks), SeparateN(g, inks)
+		for i := range plates {
+			same(t, name+": SeparateN", plates[i], genericPlates[i])
+		}
+	}
+}
+
+// same checks that two images are identical
+func same(t *testing.T, name string, m1, m2 image.Image) {
+	t.Helper()
+	if m1.Bounds() != m2.Bounds() {
+		t.Errorf("%s: the bounds differ: %v != %v", name, m1.Bounds(), m2.Bounds())
+		return
+	}
+	rect := m1.Bounds()
+	for y := rect.Min.Y; y < rect.Max.Y; y++ {
+		for x := rect.Min.X; x < rect.Max.X; x++ {
+			if c1, c2 := m1.At(x, y), m2.At(x, y); c1 != c2 {
+				t.Errorf("%s: the pixels at (%d, %d) differ: %v != %v", name, x, y, c1, c2)
+				return
+			}
+		}
+	}
+}
+
+// benchmarkImages are the images that are used for the benchmarks
+var benchmarkImages = randomImages(1024, 1024)
+
+func benchmarkSeparate3(b *testing.B, m image.Image) {
+	b.ReportAllocs()
+	c1, c2, c3 := color.RGBA{255, 0, 0, 255}, color.RGBA{0, 255, 0, 255}, color.RGBA{0, 0, 255, 255}
+	for i := 0; i < b.N; i++ {
+		Separate3(m, c1, c2, c3, 255)
+	}
+}
+
+func BenchmarkSeparate3RGBA(b *testing.B) {
+	benchmarkSeparate3(b, benchmarkImages["RGBA"])
+}
+
+func BenchmarkSeparate3RGBAGeneric(b *testing.B) {
+	benchmarkSeparate3(b, genericImage{benchmarkImages["RGBA"]})
+}
+
+func BenchmarkSeparate3YCbCr(b *testing.B) {
+	benchmarkSeparate3(b, benchmarkImages["YCbCr"])
+}
+
+func BenchmarkSeparate3YCbCrGeneric(b *testing.B) {
+	benchmarkSeparate3(b, genericImage{benchmarkImages["YCbCr"]})
+}
+
+func benchmarkRed(b *testing.B, m image.Image) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		Red(m)
+	}
+}
+
+func BenchmarkRedRGBA(b *testing.B) {
+	benchmarkRed(b, benchmarkImages["RGBA"])
+}
+
+func BenchmarkRedRGBAGeneric(b *testing.B) {
+	benchmarkRed(b, genericImage{benchmarkImages["RGBA"]})
+}
+
+func BenchmarkRedNRGBA(b *testing.B) {
+	benchmarkRed(b, benchmarkImages["NRGBA"])
+}
+
+func BenchmarkRedNRGBAGeneric(b *testing.B) {
+	benchmarkRed(b, genericImage{benchmarkImages["NRGBA"]})
+}
+
+func BenchmarkRedGray(b *testing.B) {
+	benchmarkRed(b, benchmarkImages["Gray"])
+}
+
+func BenchmarkRedGrayGeneric(b *testing.B) {
+	benchmarkRed(b, genericImage{benchmarkImages["Gray"]})
+}
+
+func BenchmarkRedPaletted(b *testing.B) {
+	benchmarkRed(b, benchmarkImages["Paletted"])
+}
+
+func BenchmarkRedPalettedGeneric(b *testing.B) {
+	benchmarkRed(b, genericImage{benchmarkImages["Paletted"]})
+}
+
+func benchmarkAddToAs(b *testing.B, m image.Image) {
+	b.ReportAllocs()
+	red := color.RGBA{255, 0, 0, 255}
+	for i := 0; i < b.N; i++ {
+		AddToAs(m, m, red)
+	}
+}
+
+func BenchmarkAddToAsRGBA(b *testing.B) {
+	benchmarkAddToAs(b, benchmarkImages["RGBA"])
+}
+
+func BenchmarkAddToAsRGBAGeneric(b *testing.B) {
+	benchmarkAddToAs(b, genericImage{benchmarkImages["RGBA"]})
+}
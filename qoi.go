@@ -0,0 +1,166 @@
+package plates
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+)
+
+// errQOI is returned when a QOI image could not be decoded
+var errQOI = errors.New("invalid QOI image")
+
+// The QOI chunk types. The 2-bit tags are in the two most significant bits.
+const (
+	qoiOpIndex = 0x00
+	qoiOpDiff  = 0x40
+	qoiOpLuma  = 0x80
+	qoiOpRun   = 0xc0
+	qoiOpRGB   = 0xfe
+	qoiOpRGBA  = 0xff
+	qoiMask    = 0xc0
+	qoiMaxRun  = 62
+)
+
+// qoiEnd is the padding that ends the stream of chunks
+var qoiEnd = []byte{0, 0, 0, 0, 0, 0, 0, 1}
+
+// qoiHash returns the position of a color in the array of previously seen colors
+func qoiHash(px [4]uint8) int {
+	return (int(px[0])*3 + int(px[1])*5 + int(px[2])*7 + int(px[3])*11) % 64
+}
+
+// DecodeQOI decodes a QOI ("Quite OK Image") image from r, as an *image.NRGBA
+func DecodeQOI(r io.Reader) (image.Image, error) {
+	br := bufio.NewReader(r)
+	var header [14]byte
+	if _, err := io.ReadFull(br, header[:]); err != nil || string(header[:4]) != "qoif" {
+		return nil, errQOI
+	}
+	width, height := int(binary.BigEndian.Uint32(header[4:])), int(binary.BigEndian.Uint32(header[8:]))
+	if width == 0 || height == 0 || width > maxPixels/height {
+		return nil, fmt.Errorf("%w: invalid size: %dx%d", errQOI, width, height)
+	}
+	if channels := header[12]; channels != 3 && channels != 4 {
+		return nil, fmt.Errorf("%w: invalid number of channels: %d", errQOI, channels)
+	}
+	var (
+		m     = image.NewNRGBA(image.Rect(0, 0, width, height))
+		index [64][4]uint8
+		px    = [4]uint8{0, 0, 0, 255}
+		run   int
+		chunk [4]byte
+	)
+	for i := 0; i < len(m.Pix); i += 4 {
+		if run > 0 {
+			run--
+			copy(m.Pix[i:i+4], px[:])
+			continue
+		}
+		b, err := br.ReadByte()
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", errQOI, err)
+		}
+		switch {
+		case b == qoiOpRGB:
+			if _, err := io.ReadFull(br, chunk[:3]); err != nil {
+				return nil, fmt.Errorf("%w: %v", errQOI, err)
+			}
+			copy(px[:3], chunk[:3])
+		case b == qoiOpRGBA:
+			if _, err := io.ReadFull(br, chunk[:4]); err != nil {
+				return nil, fmt.Errorf("%w: %v", errQOI, err)
+			}
+			copy(px[:], chunk[:4])
+		case b&qoiMask == qoiOpIndex:
+			px = index[b]
+		case b&qoiMask == qoiOpDiff:
+			px[0] += (b>>4)&3 - 2
+			px[1] += (b>>2)&3 - 2
+			px[2] += b&3 - 2
+		case b&qoiMask == qoiOpLuma:
+			b2, err := br.ReadByte()
+			if err != nil {
+				return nil, fmt.Errorf("%w: %v", errQOI, err)
+			}
+			dg := b&0x3f - 32
+			px[0] += dg - 8 + b2>>4
+			px[1] += dg
+			px[2] += dg - 8 + b2&0x0f
+		default:
+			run = int(b & 0x3f)
+		}
+		index[qoiHash(px)] = px
+		copy(m.Pix[i:i+4], px[:])
+	}
+	return m, nil
+}
+
+// EncodeQOI writes the image m to w as a QOI ("Quite OK Image") image.
+// Images without transparent pixels are written with 3 channels, other images with 4.
+func EncodeQOI(w io.Writer, m image.Image) error {
+	var (
+		bw       = bufio.NewWriter(w)
+		rect     = m.Bounds()
+		header   [14]byte
+		index    [64][4]uint8
+		prev     = [4]uint8{0, 0, 0, 255}
+		run      int
+		channels = uint8(3)
+	)
+	if hasTransparency(m) {
+		channels = 4
+	}
+	copy(header[:], "qoif")
+	binary.BigEndian.PutUint32(header[4:], uint32(rect.Dx()))
+	binary.BigEndian.PutUint32(header[8:], uint32(rect.Dy()))
+	header[12] = channels
+	bw.Write(header[:])
+	for y := rect.Min.Y; y < rect.Max.Y; y++ {
+		for x := rect.Min.X; x < rect.Max.X; x++ {
+			c := color.NRGBAModel.Convert(m.At(x, y)).(color.NRGBA)
+			px := [4]uint8{c.R, c.G, c.B, c.A}
+			if px == prev {
+				run++
+				if run == qoiMaxRun {
+					bw.WriteByte(qoiOpRun | uint8(run-1))
+					run = 0
+				}
+				continue
+			}
+			if run > 0 {
+				bw.WriteByte(qoiOpRun | uint8(run-1))
+				run = 0
+			}
+			h := qoiHash(px)
+			switch {
+			case index[h] == px:
+				bw.WriteByte(qoiOpIndex | uint8(h))
+			case px[3] != prev[3]:
+				bw.Write([]byte{qoiOpRGBA, px[0], px[1], px[2], px[3]})
+			default:
+				// The differences wrap around, like the decoder expects
+				dr, dg, db := int8(px[0]-prev[0]), int8(px[1]-prev[1]), int8(px[2]-prev[2])
+				drdg, dbdg := dr-dg, db-dg
+				switch {
+				case dr >= -2 && dr <= 1 && dg >= -2 && dg <= 1 && db >= -2 && db <= 1:
+					bw.WriteByte(qoiOpDiff | uint8(dr+2)<<4 | uint8(dg+2)<<2 | uint8(db+2))
+				case dg >= -32 && dg <= 31 && drdg >= -8 && drdg <= 7 && dbdg >= -8 && dbdg <= 7:
+					bw.Write([]byte{qoiOpLuma | uint8(dg+32), uint8(drdg+8)<<4 | uint8(dbdg+8)})
+				default:
+					bw.Write([]byte{qoiOpRGB, px[0], px[1], px[2]})
+				}
+			}
+			index[h] = px
+			prev = px
+		}
+	}
+	if run > 0 {
+		bw.WriteByte(qoiOpRun | uint8(run-1))
+	}
+	bw.Write(qoiEnd)
+	return bw.Flush()
+}
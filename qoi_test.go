@@ -0,0 +1,40 @@
+package plates
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestQOIRoundTrip(t *testing.T) {
+	testRoundTrip(t, EncodeQOI, DecodeQOI, color.NRGBAModel)
+}
+
+func TestEncodeQOI(t *testing.T) {
+	m := image.NewNRGBA(image.Rect(0, 0, 4, 1))
+	m.SetNRGBA(0, 0, color.NRGBA{0, 0, 0, 255})
+	m.SetNRGBA(1, 0, color.NRGBA{1, 2, 3, 255})
+	m.SetNRGBA(2, 0, color.NRGBA{0, 1, 4, 255})
+	m.SetNRGBA(3, 0, color.NRGBA{0, 0, 0, 255})
+	var buf bytes.Buffer
+	if err := EncodeQOI(&buf, m); err != nil {
+		t.Fatal(err)
+	}
+	expected := []byte{
+		'q', 'o', 'i', 'f', 0, 0, 0, 4, 0, 0, 0, 1, 3, 0,
+		qoiOpRun,             // The first pixel is the same as the start color
+		qoiOpLuma | 34, 0x79, // Green +2, red +1 and blue +3
+		qoiOpDiff | 1<<4 | 1<<2 | 3, // -1, -1, +1
+		qoiOpLuma | 31, 0x95,        // Green -1, red 0 and blue -4
+	}
+	expected = append(expected, qoiEnd...)
+	if !bytes.Equal(buf.Bytes(), expected) {
+		t.Errorf("Expected %v, got %v", expected, buf.Bytes())
+	}
+	for _, data := range [][]byte{nil, []byte("qoif\x00\x00\x00\x01\x00\x00\x00\x01\x05\x00"), expected[:16]} {
+		if _, err := DecodeQOI(bytes.NewReader(data)); err == nil {
+			t.Errorf("Expected an error for %q", data)
+		}
+	}
+}
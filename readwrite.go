@@ -1,70 +1,187 @@
 package plates
 
 import (
+	"bufio"
+	"bytes"
 	"errors"
 	"image"
-	"image/gif"
-	"image/jpeg"
-	"image/png"
+	"io"
 	"os"
 	"path/filepath"
-	"strings"
-
-	ico "github.com/biessek/golang-ico"
-	"github.com/chai2010/webp"
-	bmp "github.com/jsummers/gobmp"
-	"github.com/xyproto/xpm"
 )
 
+// ReadOptions are options for reading images
+type ReadOptions struct {
+	// AutoOrient rotates and flips the image according to the EXIF orientation,
+	// so that photos from phones and cameras are the right way up. See ApplyOrientation.
+	AutoOrient bool
+
+	// WorkingSpace converts the image to the color space of this ICC profile, for example
+	// SRGBProfile before using Separate3, so that images with for example an Adobe RGB or
+	// Display P3 profile get the right colors. Images without an ICC profile are assumed to be sRGB,
+	// and images with an ICC profile that ParseICCProfile does not support are left as they are.
+	WorkingSpace *ICCProfile
+}
+
 // Read tries to read the given image filename and return an image.Image
-// The supported extensions are: .png, .jpg, .jpeg, .gif, .ico, .bmp and .webp
-func Read(filename string) (image.Image, error) {
+// The supported extensions are: .png, .jpg, .jpeg, .gif, .ico, .bmp, .webp, .xpm, .pbm, .pgm, .ppm, .pnm, .pam, .tif, .tiff, .qoi, .ff and .tga,
+// and the extensions of any formats added with RegisterFormat.
+// If the extension is missing or does not match the contents of the file,
+// the format is found by looking at the first bytes of the file instead.
+// Read options can optionally be given, see ReadOptions.
+func Read(filename string, opts ...*ReadOptions) (image.Image, error) {
+	m, _, err := ReadFile(filename, opts...)
+	return m, err
+}
+
+// ReadFile tries to read the given image filename and return an image.Image,
+// together with the name of the image format, like "png".
+// The format is given by the extension of the filename, but if the extension
+// is missing or does not match the contents of the file, the format is found
+// by looking at the first bytes of the file instead.
+// Read options can optionally be given, see ReadOptions.
+func ReadFile(filename string, opts ...*ReadOptions) (image.Image, string, error) {
+	if len(opts) > 0 && opts[0] != nil && (opts[0].AutoOrient || opts[0].WorkingSpace != nil) {
+		// The orientation and the ICC profile are in the metadata
+		m, name, _, err := readWithMetadata(filename, opts[0])
+		return m, name, err
+	}
 	f, err := os.Open(filename)
 	if err != nil {
-		return nil, err
+		return nil, "", err
 	}
 	defer f.Close()
-	switch strings.ToLower(filepath.Ext(filename)) {
-	case ".png":
-		return png.Decode(f)
-	case ".jpg", ".jpeg":
-		return jpeg.Decode(f)
-	case ".gif":
-		return gif.Decode(f)
-	case ".ico":
-		return ico.Decode(f)
-	case ".bmp":
-		return bmp.Decode(f)
-	case ".webp":
-		return webp.Decode(f)
+	br := bufio.NewReader(f)
+	format, err := chooseFormat(filename, peekHeader(br))
+	if err != nil {
+		return nil, "", err
+	}
+	return decodeAs(format, br)
+}
+
+// ReadWithMetadata is like Read, but also returns the metadata of the image,
+// which is the EXIF data, XMP packet, ICC profile, PNG text and resolution, as far as the format has them.
+// If the image is oriented with the AutoOrient option, the orientation in the returned EXIF data is changed to 1,
+// so that writing the image together with the metadata does not rotate it twice. In the same way, if the image
+// is converted with the WorkingSpace option, the returned ICC profile is the profile of the working space.
+func ReadWithMetadata(filename string, opts ...*ReadOptions) (image.Image, *Metadata, error) {
+	var readOptions *ReadOptions
+	if len(opts) > 0 {
+		readOptions = opts[0]
+	}
+	m, _, md, err := readWithMetadata(filename, readOptions)
+	return m, md, err
+}
+
+// readWithMetadata reads an image file and its metadata, and returns them together with the name of the format
+func readWithMetadata(filename string, opts *ReadOptions) (image.Image, string, *Metadata, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, "", nil, err
+	}
+	format, err := chooseFormat(filename, data)
+	if err != nil {
+		return nil, "", nil, err
+	}
+	m, name, err := decodeAs(format, bytes.NewReader(data))
+	if err != nil {
+		return nil, name, nil, err
+	}
+	md := readMetadata(name, data)
+	if opts != nil && opts.AutoOrient {
+		if orientation := md.Orientation(); orientation != 1 {
+			m = ApplyOrientation(m, orientation)
+			setEXIFOrientation(md.EXIF, 1)
+		}
+	}
+	if opts != nil && opts.WorkingSpace != nil {
+		profile := SRGBProfile
+		if len(md.ICC) > 0 {
+			profile, err = ParseICCProfile(md.ICC)
+		}
+		if err == nil && !sameProfile(profile, opts.WorkingSpace) {
+			m = ConvertProfile(m, profile, opts.WorkingSpace)
+			md.ICC = append([]byte(nil), opts.WorkingSpace.Bytes()...)
+		}
+	}
+	return m, name, md, nil
+}
 
+// chooseFormat finds the format of an image file, from the filename and the first bytes of the file
+func chooseFormat(filename string, header []byte) (*format, error) {
+	byExt, okExt := formatByExtension(filename)
+	if okExt && byExt.matches(header) {
+		return byExt, nil
+	}
+	if sniffed, ok := sniff(header); ok {
+		return sniffed, nil
+	}
+	if okExt {
+		return byExt, nil
 	}
 	return nil, errors.New("unrecognized file extension: " + filepath.Ext(filename))
 }
 
 // Write tries to write then given image.Image to a file.
-// The supported extensions are: .png, .jpg, .jpeg. .gif, .ico, .bmp, .webp and .xpm
-func Write(filename string, img image.Image) error {
-	f, err := os.Create(filename)
+// The supported extensions are: .png, .jpg, .jpeg. .gif, .ico, .bmp, .webp, .xpm, .pbm, .pgm, .ppm, .pnm, .pam, .tif, .tiff, .qoi, .ff and .tga,
+// and the extensions of any formats added with RegisterFormat.
+// Encoding options can optionally be given, see EncodeOptions.
+// The file is replaced atomically, so if encoding fails, any existing file is left as it was.
+func Write(filename string, img image.Image, opts ...*EncodeOptions) error {
+	format, ok := formatByExtension(filename)
+	if !ok {
+		return errors.New("unrecognized file extension: " + filepath.Ext(filename))
+	}
+	if format.encode == nil {
+		return errors.New("encoding is not supported for the image format: " + format.name)
+	}
+	var encodeOptions *EncodeOptions
+	if len(opts) > 0 {
+		encodeOptions = opts[0]
+	}
+	return writeAtomically(filename, func(w io.Writer) error {
+		return encodeAs(format, w, img, encodeOptions)
+	})
+}
+
+// writeAtomically calls write with a temporary file in the same directory as filename,
+// and if that succeeds, the temporary file is synced to disk and renamed to filename.
+// If anything fails, the temporary file is removed and an existing file is left alone.
+// A new file gets the permissions 0644, while a file that is replaced keeps its permissions.
+func writeAtomically(filename string, write func(io.Writer) error) (err error) {
+	mode := os.FileMode(0o644)
+	if info, statErr := os.Stat(filename); statErr == nil {
+		if !info.Mode().IsRegular() {
+			return errors.New("not a regular file: " + filename)
+		}
+		mode = info.Mode().Perm()
+	}
+	f, err := os.CreateTemp(filepath.Dir(filename), "."+filepath.Base(filename)+".*.tmp")
 	if err != nil {
 		return err
 	}
-	defer f.Close()
-	switch strings.ToLower(filepath.Ext(filename)) {
-	case ".png":
-		return png.Encode(f, img)
-	case ".jpg", ".jpeg":
-		return jpeg.Encode(f, img, nil)
-	case ".gif":
-		return gif.Encode(f, img, nil)
-	case ".ico":
-		return ico.Encode(f, img)
-	case ".bmp":
-		return bmp.Encode(f, img)
-	case ".webp":
-		return webp.Encode(f, img, nil)
-	case ".xpm":
-		return xpm.Encode(f, img)
-	}
-	return errors.New("unrecognized file extension: " + filepath.Ext(filename))
+	defer func() {
+		if err != nil {
+			f.Close()
+			os.Remove(f.Name())
+		}
+	}()
+	bw := bufio.NewWriter(f)
+	if err = write(bw); err != nil {
+		return err
+	}
+	if err = bw.Flush(); err != nil {
+		return err
+	}
+	if err = f.Chmod(mode); err != nil {
+		return err
+	}
+	if err = f.Sync(); err != nil {
+		return err
+	}
+	// Close is called here instead of being deferred, since a failed close may mean a failed write
+	if err = f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), filename)
 }
@@ -0,0 +1,289 @@
+package plates
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// testImage returns a small image with a few different colors
+func testImage() *image.RGBA {
+	m := image.NewRGBA(image.Rect(0, 0, 4, 3))
+	for y := 0; y < 3; y++ {
+		for x := 0; x < 4; x++ {
+			m.Set(x, y, color.RGBA{uint8(x * 80), uint8(y * 120), 128, 255})
+		}
+	}
+	return m
+}
+
+func TestDecode(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"png", "jpeg", "gif", "bmp", "ico", "webp", "xpm", "tiff", "qoi"} {
+		filename := filepath.Join(dir, "test."+name)
+		if err := Write(filename, testImage()); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		data, err := os.ReadFile(filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		m, format, err := Decode(bytes.NewReader(data))
+		if format != name {
+			t.Errorf("Expected the format to be %s, got %q", name, format)
+		}
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+		} else if m.Bounds().Dx() != 4 || m.Bounds().Dy() != 3 {
+			t.Errorf("%s: unexpected size: %v", name, m.Bounds())
+		}
+	}
+	if _, _, err := Decode(bytes.NewReader([]byte("not an image"))); err != ErrUnknownFormat {
+		t.Errorf("Expected ErrUnknownFormat, got %v", err)
+	}
+	if _, _, err := Decode(bytes.NewReader(nil)); err != ErrUnknownFormat {
+		t.Errorf("Expected ErrUnknownFormat for empty data, got %v", err)
+	}
+}
+
+func TestReadFileSniffing(t *testing.T) {
+	dir := t.TempDir()
+	png := filepath.Join(dir, "test.png")
+	if err := Write(png, testImage()); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(png)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"mislabeled.jpg", "noextension", "unknown.xyz"} {
+		filename := filepath.Join(dir, name)
+		if err := os.WriteFile(filename, data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		m, format, err := ReadFile(filename)
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		if format != "png" {
+			t.Errorf("%s: expected png, got %s", name, format)
+		}
+		if m.Bounds().Dx() != 4 {
+			t.Errorf("%s: unexpected size: %v", name, m.Bounds())
+		}
+	}
+	if _, err := Read(filepath.Join(dir, "mislabeled.jpg")); err != nil {
+		t.Errorf("Expected Read to fall back to sniffing, got %v", err)
+	}
+}
+
+func TestEncodeOptions(t *testing.T) {
+	m := testImage()
+	var low, high bytes.Buffer
+	if err := Encode(&low, m, "jpg", &EncodeOptions{JPEGQuality: 10}); err != nil {
+		t.Fatal(err)
+	}
+	if err := Encode(&high, m, "jpeg", &EncodeOptions{JPEGQuality: 100}); err != nil {
+		t.Fatal(err)
+	}
+	if low.Len() >= high.Len() {
+		t.Errorf("Expected a lower JPEG quality to give a smaller file, got %d >= %d bytes", low.Len(), high.Len())
+	}
+
+	var buf bytes.Buffer
+	if err := Encode(&buf, m, "webp", &EncodeOptions{WebPLossless: true}); err != nil {
+		t.Fatal(err)
+	}
+	decoded, _, err := Decode(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sameColors(t, m, decoded)
+
+	buf.Reset()
+	if err := Encode(&buf, m, "gif", &EncodeOptions{GIFNumColors: 2}); err != nil {
+		t.Fatal(err)
+	}
+	decoded, _, err = Decode(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p, ok := decoded.(*image.Paletted); !ok || len(p.Palette) > 2 {
+		t.Errorf("Expected a GIF with at most 2 colors, got %T", decoded)
+	}
+
+	buf.Reset()
+	if err := Encode(&buf, m, "xpm", &EncodeOptions{XPMName: "plate"}); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(buf.Bytes(), []byte("plate[]")) {
+		t.Error("Expected the XPM image name to be used")
+	}
+
+	if err := Encode(&buf, m, "xyz", nil); err == nil {
+		t.Error("Expected an error for an unknown format")
+	}
+}
+
+func TestWriteOptions(t *testing.T) {
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "lossless.webp")
+	if err := Write(filename, testImage(), &EncodeOptions{WebPLossless: true}); err != nil {
+		t.Fatal(err)
+	}
+	m, err := Read(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sameColors(t, testImage(), m)
+}
+
+// testRoundTrip encodes and decodes each of the test images and img/generated.png,
+// and checks that the colors are the same after being converted with the given color model
+func testRoundTrip(t *testing.T, encode func(io.Writer, image.Image) error, decode func(io.Reader) (image.Image, error), model color.Model) {
+	t.Helper()
+	images := testImages()
+	generated, err := Read("img/generated.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	images["generated.png"] = generated
+	images["transparent"] = noisyImage(40, 30)
+	for name, m := range images {
+		var buf bytes.Buffer
+		if err := encode(&buf, m); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		decoded, err := decode(&buf)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if decoded.Bounds().Size() != m.Bounds().Size() {
+			t.Fatalf("%s: expected the size %v, got %v", name, m.Bounds().Size(), decoded.Bounds().Size())
+		}
+		rect, offset := m.Bounds(), decoded.Bounds().Min.Sub(m.Bounds().Min)
+		for y := rect.Min.Y; y < rect.Max.Y; y++ {
+			for x := rect.Min.X; x < rect.Max.X; x++ {
+				expected := model.Convert(m.At(x, y))
+				if got := model.Convert(decoded.At(x+offset.X, y+offset.Y)); got != expected {
+					t.Fatalf("%s: expected %v at (%d, %d), got %v", name, expected, x, y, got)
+				}
+			}
+		}
+	}
+}
+
+func TestRegisterFormat(t *testing.T) {
+	previous := registeredFormats()
+	t.Cleanup(func() { registry.Store(previous) })
+
+	decode := func(r io.Reader) (image.Image, error) {
+		if _, err := io.ReadAll(r); err != nil {
+			return nil, err
+		}
+		return image.NewGray(image.Rect(0, 0, 2, 2)), nil
+	}
+	encode := func(w io.Writer, m image.Image, _ *EncodeOptions) error {
+		_, err := w.Write([]byte("TST!"))
+		return err
+	}
+	RegisterFormat("TST", []string{"TST", ".test"}, []string{"TST?"}, decode, encode)
+
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "image.tst")
+	if err := Write(filename, testImage()); err != nil {
+		t.Fatal(err)
+	}
+	m, format, err := ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if format != "tst" || m.Bounds().Dx() != 2 {
+		t.Errorf("Expected a 2x2 image in the tst format, got %v in %q", m.Bounds(), format)
+	}
+	if _, format, err := Decode(bytes.NewReader([]byte("TST?"))); err != nil || format != "tst" {
+		t.Errorf("Expected the tst format to be recognized, got %q and %v", format, err)
+	}
+
+	found := false
+	for _, info := range Formats() {
+		if info.Name == "tst" {
+			found = true
+			if len(info.Extensions) != 2 || info.Extensions[0] != ".tst" || !info.CanDecode || !info.CanEncode {
+				t.Errorf("Unexpected format info: %+v", info)
+			}
+		}
+	}
+	if !found {
+		t.Error("Expected the tst format to be listed by Formats")
+	}
+
+	// Registering the same name again replaces the format, and later formats take over extensions
+	RegisterFormat("tst", []string{".png"}, nil, decode, nil)
+	if err := Write(filepath.Join(dir, "image.png"), testImage()); err == nil {
+		t.Error("Expected an error when writing a format that can not be encoded")
+	}
+	if err := Encode(io.Discard, testImage(), "test", nil); err == nil {
+		t.Error("Expected the replaced format to no longer have the .test extension")
+	}
+	if len(registeredFormats()) != len(previous)+1 {
+		t.Errorf("Expected %d formats, got %d", len(previous)+1, len(registeredFormats()))
+	}
+}
+
+func TestWriteAtomically(t *testing.T) {
+	previous := registeredFormats()
+	t.Cleanup(func() { registry.Store(previous) })
+	failing := errors.New("the encoder failed halfway")
+	RegisterFormat("half", []string{".half"}, nil, nil, func(w io.Writer, m image.Image, _ *EncodeOptions) error {
+		w.Write([]byte("half an image"))
+		return failing
+	})
+
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "image.half")
+	if err := os.WriteFile(filename, []byte("the previous image"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := Write(filename, testImage()); err != failing {
+		t.Errorf("Expected the error from the encoder, got %v", err)
+	}
+	if data, err := os.ReadFile(filename); err != nil || string(data) != "the previous image" {
+		t.Errorf("Expected the previous file to be left alone, got %q and %v", data, err)
+	}
+	if err := Write(filepath.Join(dir, "image.xyz"), testImage()); err == nil {
+		t.Error("Expected an error for an unknown extension")
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("Expected only the previous file to be left in the directory, got %d files", len(entries))
+	}
+
+	// Replacing a file keeps its permissions
+	png := filepath.Join(dir, "image.png")
+	if err := os.WriteFile(png, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := Write(png, testImage()); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(png)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0o600 {
+		t.Errorf("Expected the permissions 0600, got %v", info.Mode().Perm())
+	}
+	if m, err := Read(png); err != nil || m.Bounds() != testImage().Bounds() {
+		t.Errorf("Expected the new image to be written, got %v", err)
+	}
+}
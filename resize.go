@@ -0,0 +1,101 @@
+package plates
+
+import (
+	"image"
+	"image/color"
+	"math"
+)
+
+// resizeWeights returns, for each of the n destination pixels, the first source pixel
+// and the weights of the source pixels that are used, for scaling srcN pixels to n pixels.
+// The filter is a triangle filter, which is bilinear when enlarging, and which is
+// widened when shrinking, so that every source pixel is used.
+func resizeWeights(srcN, n int) ([]int, [][]float64) {
+	var (
+		scale   = float64(srcN) / float64(n)
+		support = math.Max(1, scale)
+		starts  = make([]int, n)
+		weights = make([][]float64, n)
+	)
+	for i := 0; i < n; i++ {
+		center := (float64(i)+0.5)*scale - 0.5
+		start := int(math.Ceil(center - support))
+		end := int(math.Floor(center + support))
+		if start < 0 {
+			start = 0
+		}
+		if end > srcN-1 {
+			end = srcN - 1
+		}
+		var (
+			w   = make([]float64, end-start+1)
+			sum float64
+		)
+		for j := range w {
+			w[j] = math.Max(0, 1-math.Abs(float64(start+j)-center)/support)
+			sum += w[j]
+		}
+		if sum == 0 {
+			// This should not happen, but use the nearest pixel instead of dividing by zero
+			w[0], sum = 1, 1
+		}
+		for j := range w {
+			w[j] /= sum
+		}
+		starts[i], weights[i] = start, w
+	}
+	return starts, weights
+}
+
+// resize scales m, which must not be empty, to the given size, which must be at least 1x1, and returns an *image.NRGBA.
+// The colors are filtered with premultiplied alpha, so that transparent pixels do not darken the edges,
+// and the rows are read with 16 bits per channel, so that no precision is lost before the final rounding.
+func resize(m image.Image, width, height int) *image.NRGBA {
+	var (
+		rect             = m.Bounds()
+		read             = newRowReader64(m, rect)
+		xStarts, xWeight = resizeWeights(rect.Dx(), width)
+		yStarts, yWeight = resizeWeights(rect.Dy(), height)
+		src              = make([]uint8, 8*rect.Dx())
+		// rows has each source row scaled horizontally, as premultiplied RGBA from 0 to 65535
+		rows = make([][]float64, rect.Dy())
+		dst  = image.NewNRGBA(image.Rect(0, 0, width, height))
+	)
+	for y := range rows {
+		read(rect.Min.Y+y, src)
+		row := make([]float64, 4*width)
+		for x := 0; x < width; x++ {
+			for j, w := range xWeight[x] {
+				c := get64(src[8*(xStarts[x]+j):])
+				row[4*x] += w * float64(c.R)
+				row[4*x+1] += w * float64(c.G)
+				row[4*x+2] += w * float64(c.B)
+				row[4*x+3] += w * float64(c.A)
+			}
+		}
+		rows[y] = row
+	}
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			var sum [4]float64
+			for j, w := range yWeight[y] {
+				row := rows[yStarts[y]+j]
+				for c := 0; c < 4; c++ {
+					sum[c] += w * row[4*x+c]
+				}
+			}
+			if sum[3] < 0x80 {
+				continue
+			}
+			// Convert back from premultiplied alpha
+			a := math.Min(65535, sum[3])
+			dst.SetNRGBA(x, y, color.NRGBA{
+				uint8(math.Min(255, sum[0]*255/a) + 0.5),
+				uint8(math.Min(255, sum[1]*255/a) + 0.5),
+				uint8(math.Min(255, sum[2]*255/a) + 0.5),
+				uint8(a/257 + 0.5),
+			})
+		}
+	}
+	return dst
+}
@@ -0,0 +1,117 @@
+package plates
+
+import (
+	"context"
+	"image"
+	"image/color"
+	"math"
+)
+
+// Threshold is an Option for SeparateN that sets the largest distance that a pixel may have
+// to its nearest ink and still be added to the plate for that ink.
+// Pixels that are further away are left empty on all plates.
+// The scale of the threshold depends on the Distance that is used.
+// By default, or if t is 0, every pixel is assigned to an ink.
+func Threshold(t float64) Option {
+	return func(cfg *config) {
+		cfg.threshold = t
+	}
+}
+
+// Metric is an Option for SeparateN that sets the Distance that is used for finding the nearest ink.
+// By default, or if d is nil, Redmean is used.
+func Metric(d Distance) Option {
+	return func(cfg *config) {
+		cfg.metric = d
+	}
+}
+
+// SeparateN separates an image into one plate per ink.
+// Each pixel is assigned to the nearest ink, as measured by the Metric option, and is drawn
+// with that ink on the corresponding plate. A pixel is never added to
+// more than one plate. Fully transparent pixels are left empty.
+// Pixels that are further from all inks than the Threshold option are left out.
+// For images with 16 bits per channel, the pixels are matched with 16-bit precision,
+// using Distance64 if the Distance implements it, and the plates are *image.RGBA64.
+func SeparateN(m image.Image, inks []color.RGBA, opts ...Option) []image.Image {
+	result, _ := SeparateNContext(context.Background(), m, inks, opts...)
+	return result
+}
+
+// SeparateNContext is like SeparateN, but stops and returns the error from ctx if ctx is done
+// before all rows have been processed.
+func SeparateNContext(ctx context.Context, m image.Image, inks []color.RGBA, opts ...Option) ([]image.Image, error) {
+	var (
+		cfg       = newConfig(opts)
+		rect      = m.Bounds()
+		read      = newRowReader(m, rect)
+		newRect   = image.Rect(0, 0, rect.Dx(), rect.Dy())
+		newImages = make([]*image.RGBA, len(inks))
+		result    = make([]image.Image, len(inks))
+		threshold = cfg.threshold
+		distance  = Redmean
+	)
+	if cfg.metric != nil {
+		distance = cfg.metric
+	}
+	distance = cfg.distance(distance)
+	if is16Bit(m) {
+		return separateN64(ctx, m, inks, threshold, distance, cfg)
+	}
+	for i := range inks {
+		newImages[i] = image.NewRGBA(newRect)
+		result[i] = newImages[i]
+	}
+	if len(inks) == 0 {
+		return result, nil
+	}
+	err := eachRow(ctx, cfg, rect, 4*rect.Dx(), func(y int, row []uint8) {
+		read(y, row)
+		var (
+			prev      color.RGBA
+			prevInk   = -1
+			offset    = newImages[0].PixOffset(0, y-rect.Min.Y)
+			ink, best int
+			d         float64
+		)
+		for i := 0; i < len(row); i += 4 {
+			cr := color.RGBA{row[i], row[i+1], row[i+2], row[i+3]}
+			if cr.A == 0 {
+				continue
+			}
+			// Neighbouring pixels often have the same color
+			if prevInk < 0 || cr != prev {
+				best, d = nearest(cr, inks, distance)
+				ink = best
+				if threshold > 0 && d > threshold {
+					ink = len(inks)
+				}
+				prev, prevInk = cr, ink
+			} else {
+				ink = prevInk
+			}
+			if ink == len(inks) {
+				continue
+			}
+			c := inks[ink]
+			pix := newImages[ink].Pix[offset+i : offset+i+4]
+			pix[0], pix[1], pix[2], pix[3] = c.R, c.G, c.B, 255
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// nearest finds the index of the ink that is closest to the given color,
+// and the distance to it, with the ink as the reference color. The first ink wins if several are equally close.
+func nearest(cr color.RGBA, inks []color.RGBA, distance Distance) (int, float64) {
+	best, bestDistance := 0, math.Inf(1)
+	for i, ink := range inks {
+		if d := distance.Distance(ink, cr); d < bestDistance {
+			best, bestDistance = i, d
+		}
+	}
+	return best, bestDistance
+}
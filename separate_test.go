@@ -0,0 +1,79 @@
+package plates
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestSeparateN(t *testing.T) {
+	inks := []color.RGBA{
+		{255, 0, 0, 255},
+		{255, 255, 0, 255},
+		{0, 0, 255, 255},
+		{0, 0, 0, 255},
+		{255, 255, 255, 255},
+	}
+	img := image.NewRGBA(image.Rect(0, 0, 5, 1))
+	img.Set(0, 0, color.RGBA{200, 30, 20, 255})
+	img.Set(1, 0, color.RGBA{240, 220, 40, 255})
+	img.Set(2, 0, color.RGBA{20, 30, 200, 255})
+	img.Set(3, 0, color.RGBA{10, 10, 10, 255})
+	img.Set(4, 0, color.RGBA{250, 250, 250, 255})
+	plates := SeparateN(img, inks)
+	if len(plates) != len(inks) {
+		t.Fatalf("Expected %d plates, got %d", len(inks), len(plates))
+	}
+	for i, plate := range plates {
+		for x := 0; x < 5; x++ {
+			c := color.RGBAModel.Convert(plate.At(x, 0)).(color.RGBA)
+			if x == i && c != inks[i] {
+				t.Errorf("Expected pixel %d on plate %d to be %v, got %v", x, i, inks[i], c)
+			} else if x != i && c.A != 0 {
+				t.Errorf("Expected pixel %d on plate %d to be empty, got %v", x, i, c)
+			}
+		}
+	}
+}
+
+func TestSeparateNThreshold(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 2, 1))
+	img.Set(0, 0, color.RGBA{250, 0, 0, 255})
+	img.Set(1, 0, color.RGBA{0, 128, 0, 255})
+	plates := SeparateN(img, []color.RGBA{{255, 0, 0, 255}}, Threshold(0.1))
+	if _, _, _, a := plates[0].At(0, 0).RGBA(); a == 0 {
+		t.Error("Expected a pixel close to the ink to be on the plate")
+	}
+	if _, _, _, a := plates[0].At(1, 0).RGBA(); a != 0 {
+		t.Error("Expected a pixel far from the ink to be left empty")
+	}
+}
+
+func TestSeparateNDistanceOrder(t *testing.T) {
+	var (
+		ink    = color.RGBA{255, 0, 0, 255}
+		pixel  = color.RGBA{0, 0, 255, 255}
+		firsts []color.RGBA
+	)
+	distance := DistanceFunc(func(c1, c2 color.RGBA) float64 {
+		firsts = append(firsts, c1)
+		return 0
+	})
+	img := image.NewRGBA(image.Rect(0, 0, 1, 1))
+	img.Set(0, 0, pixel)
+	img64 := image.NewRGBA64(image.Rect(0, 0, 1, 1))
+	img64.Set(0, 0, pixel)
+	// The ink or the target color is the reference color, and is always passed first
+	SeparateN(img, []color.RGBA{ink}, Metric(distance))
+	SeparateN(img64, []color.RGBA{ink}, Metric(distance))
+	CloseTo1Distance(img, ink, distance, 1)
+	CloseTo1Distance(img64, ink, distance, 1)
+	if len(firsts) != 4 {
+		t.Fatalf("Expected 4 distances to be measured, got %d", len(firsts))
+	}
+	for i, c := range firsts {
+		if c != ink {
+			t.Errorf("Expected the ink %v as the first color of distance %d, got %v", ink, i, c)
+		}
+	}
+}
@@ -0,0 +1,278 @@
+package plates
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+)
+
+// errTGA is returned when a TGA image could not be decoded
+var errTGA = errors.New("invalid TGA image")
+
+// The TGA image types. The run-length encoded types are the same plus 8.
+const (
+	tgaColorMapped = 1
+	tgaTrueColor   = 2
+	tgaGrayscale   = 3
+	tgaRLE         = 8
+)
+
+// The bits of the image descriptor in the TGA header
+const (
+	tgaAlphaBits   = 0x0f
+	tgaRightToLeft = 0x10
+	tgaTopToBottom = 0x20
+)
+
+// tgaFooter ends a TGA 2.0 image, after the offsets of the extension and developer areas
+const tgaFooter = "TRUEVISION-XFILE.\x00"
+
+// tgaColor converts a little-endian pixel value with the given bit depth to a color.
+// 15 and 16 bit values have 5 bits per channel, and the top bit is alpha if alphaBits is 1.
+// 24 and 32 bit values are stored as blue, green, red and alpha.
+func tgaColor(p []byte, depth, alphaBits int) color.NRGBA {
+	switch depth {
+	case 15, 16:
+		v := int(binary.LittleEndian.Uint16(p))
+		c := color.NRGBA{uint8((v >> 10 & 31) * 255 / 31), uint8((v >> 5 & 31) * 255 / 31), uint8((v & 31) * 255 / 31), 255}
+		if alphaBits == 1 && v&0x8000 == 0 {
+			c.A = 0
+		}
+		return c
+	case 24:
+		return color.NRGBA{p[2], p[1], p[0], 255}
+	}
+	c := color.NRGBA{p[2], p[1], p[0], p[3]}
+	if alphaBits == 0 {
+		c.A = 255
+	}
+	return c
+}
+
+// DecodeTGA decodes a TGA (Truevision TARGA) image from r. Color-mapped, true-color and
+// grayscale images are supported, both uncompressed and run-length encoded.
+// 8-bit grayscale images give an *image.Gray, all other images give an *image.NRGBA.
+func DecodeTGA(r io.Reader) (image.Image, error) {
+	br := bufio.NewReader(r)
+	var header [18]byte
+	if _, err := io.ReadFull(br, header[:]); err != nil {
+		return nil, errTGA
+	}
+	var (
+		idLength     = int(header[0])
+		colorMapType = header[1]
+		imageType    = int(header[2])
+		mapFirst     = int(binary.LittleEndian.Uint16(header[3:]))
+		mapLength    = int(binary.LittleEndian.Uint16(header[5:]))
+		mapDepth     = int(header[7])
+		width        = int(binary.LittleEndian.Uint16(header[12:]))
+		height       = int(binary.LittleEndian.Uint16(header[14:]))
+		depth        = int(header[16])
+		descriptor   = header[17]
+		alphaBits    = int(descriptor & tgaAlphaBits)
+		rle          = imageType&tgaRLE != 0
+		kind         = imageType &^ tgaRLE
+	)
+	if width == 0 || height == 0 || colorMapType > 1 {
+		return nil, fmt.Errorf("%w: invalid header", errTGA)
+	}
+	if width > maxPixels/height {
+		return nil, fmt.Errorf("%w: the image is too large: %dx%d", errTGA, width, height)
+	}
+	switch {
+	case kind == tgaColorMapped && colorMapType == 1 && (depth == 8 || depth == 16):
+	case kind == tgaTrueColor && (depth == 15 || depth == 16 || depth == 24 || depth == 32):
+	case kind == tgaGrayscale && (depth == 8 || depth == 16):
+	default:
+		return nil, fmt.Errorf("%w: unsupported image type %d with %d bits per pixel", errTGA, imageType, depth)
+	}
+	if _, err := br.Discard(idLength); err != nil {
+		return nil, fmt.Errorf("%w: %v", errTGA, err)
+	}
+
+	// The color map is read even if it is not used, to get to the pixels
+	var palette []color.NRGBA
+	if colorMapType == 1 {
+		if mapDepth != 15 && mapDepth != 16 && mapDepth != 24 && mapDepth != 32 {
+			return nil, fmt.Errorf("%w: unsupported color map with %d bits per entry", errTGA, mapDepth)
+		}
+		data := make([]byte, mapLength*((mapDepth+7)/8))
+		if _, err := io.ReadFull(br, data); err != nil {
+			return nil, fmt.Errorf("%w: %v", errTGA, err)
+		}
+		palette = make([]color.NRGBA, mapLength)
+		for i := range palette {
+			palette[i] = tgaColor(data[i*len(data)/mapLength:], mapDepth, alphaBits)
+		}
+	}
+
+	// Read all the pixels, which are stored row by row, starting at the bottom unless
+	// tgaTopToBottom is set. Run-length encoded packets may cross rows.
+	bpp := (depth + 7) / 8
+	pixels := make([]byte, width*height*bpp)
+	if !rle {
+		if _, err := io.ReadFull(br, pixels); err != nil {
+			return nil, fmt.Errorf("%w: %v", errTGA, err)
+		}
+	} else {
+		for i := 0; i < len(pixels); {
+			packet, err := br.ReadByte()
+			if err != nil {
+				return nil, fmt.Errorf("%w: %v", errTGA, err)
+			}
+			n := (int(packet&0x7f) + 1) * bpp
+			if i+n > len(pixels) {
+				return nil, fmt.Errorf("%w: too many pixels", errTGA)
+			}
+			if packet&0x80 == 0 {
+				// Raw packet
+				if _, err := io.ReadFull(br, pixels[i:i+n]); err != nil {
+					return nil, fmt.Errorf("%w: %v", errTGA, err)
+				}
+				i += n
+				continue
+			}
+			// Run-length packet, where one pixel is repeated
+			if _, err := io.ReadFull(br, pixels[i:i+bpp]); err != nil {
+				return nil, fmt.Errorf("%w: %v", errTGA, err)
+			}
+			for j := i + bpp; j < i+n; j += bpp {
+				copy(pixels[j:j+bpp], pixels[i:i+bpp])
+			}
+			i += n
+		}
+	}
+
+	var (
+		rect = image.Rect(0, 0, width, height)
+		gray *image.Gray
+		rgba *image.NRGBA
+	)
+	if kind == tgaGrayscale && depth == 8 {
+		gray = image.NewGray(rect)
+	} else {
+		rgba = image.NewNRGBA(rect)
+	}
+	for row := 0; row < height; row++ {
+		y := height - 1 - row
+		if descriptor&tgaTopToBottom != 0 {
+			y = row
+		}
+		for col := 0; col < width; col++ {
+			x := col
+			if descriptor&tgaRightToLeft != 0 {
+				x = width - 1 - col
+			}
+			p := pixels[(row*width+col)*bpp:]
+			switch {
+			case gray != nil:
+				gray.Pix[y*gray.Stride+x] = p[0]
+			case kind == tgaGrayscale:
+				// 8 bits of gray followed by 8 bits of alpha
+				a := p[1]
+				if alphaBits == 0 {
+					a = 255
+				}
+				rgba.SetNRGBA(x, y, color.NRGBA{p[0], p[0], p[0], a})
+			case kind == tgaColorMapped:
+				i := int(p[0])
+				if depth == 16 {
+					i = int(binary.LittleEndian.Uint16(p))
+				}
+				i -= mapFirst
+				if i < 0 || i >= len(palette) {
+					return nil, fmt.Errorf("%w: color index out of range", errTGA)
+				}
+				rgba.SetNRGBA(x, y, palette[i])
+			default:
+				rgba.SetNRGBA(x, y, tgaColor(p, depth, alphaBits))
+			}
+		}
+	}
+	if gray != nil {
+		return gray, nil
+	}
+	return rgba, nil
+}
+
+// EncodeTGA writes the image m to w as a TGA (Truevision TARGA) 2.0 image, from the top row and down.
+// *image.Gray and *image.Gray16 images are written as 8-bit grayscale, images with transparent
+// pixels are written with 32 bits per pixel, and other images are written with 24 bits per pixel.
+// If rle is true, the pixels are run-length encoded.
+func EncodeTGA(w io.Writer, m image.Image, rle bool) error {
+	var (
+		bw        = bufio.NewWriter(w)
+		rect      = m.Bounds()
+		imageType = tgaTrueColor
+		bpp       = 3
+		alphaBits = 0
+	)
+	if rect.Dx() > 0xffff || rect.Dy() > 0xffff {
+		return fmt.Errorf("the image is too large for TGA: %dx%d", rect.Dx(), rect.Dy())
+	}
+	switch {
+	case isGray(m):
+		imageType, bpp = tgaGrayscale, 1
+	case hasTransparency(m):
+		bpp, alphaBits = 4, 8
+	}
+	if rle {
+		imageType |= tgaRLE
+	}
+	var header [18]byte
+	header[2] = uint8(imageType)
+	binary.LittleEndian.PutUint16(header[12:], uint16(rect.Dx()))
+	binary.LittleEndian.PutUint16(header[14:], uint16(rect.Dy()))
+	header[16] = uint8(bpp * 8)
+	header[17] = uint8(alphaBits) | tgaTopToBottom
+	bw.Write(header[:])
+
+	row := make([]byte, rect.Dx()*bpp)
+	for y := rect.Min.Y; y < rect.Max.Y; y++ {
+		for x, i := rect.Min.X, 0; x < rect.Max.X; x, i = x+1, i+bpp {
+			if bpp == 1 {
+				row[i] = color.GrayModel.Convert(m.At(x, y)).(color.Gray).Y
+				continue
+			}
+			c := color.NRGBAModel.Convert(m.At(x, y)).(color.NRGBA)
+			row[i], row[i+1], row[i+2] = c.B, c.G, c.R
+			if bpp == 4 {
+				row[i+3] = c.A
+			}
+		}
+		if !rle {
+			bw.Write(row)
+			continue
+		}
+		// Each row is encoded by itself, since some readers do not support packets that cross rows
+		n := len(row) / bpp
+		pixel := func(i int) []byte { return row[i*bpp : (i+1)*bpp] }
+		for i := 0; i < n; {
+			run := 1
+			for i+run < n && run < 128 && string(pixel(i+run)) == string(pixel(i)) {
+				run++
+			}
+			if run > 1 {
+				bw.WriteByte(0x80 | uint8(run-1))
+				bw.Write(pixel(i))
+				i += run
+				continue
+			}
+			// Raw packet, up to the next pair of equal pixels
+			start := i
+			for i < n && i-start < 128 && (i+1 >= n || string(pixel(i)) != string(pixel(i+1))) {
+				i++
+			}
+			bw.WriteByte(uint8(i - start - 1))
+			bw.Write(row[start*bpp : i*bpp])
+		}
+	}
+	// No extension or developer area
+	bw.Write(make([]byte, 8))
+	bw.WriteString(tgaFooter)
+	return bw.Flush()
+}
@@ -0,0 +1,77 @@
+package plates
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"io"
+	"testing"
+)
+
+func TestTGARoundTrip(t *testing.T) {
+	for _, rle := range []bool{false, true} {
+		encode := func(w io.Writer, m image.Image) error { return EncodeTGA(w, m, rle) }
+		testRoundTrip(t, encode, DecodeTGA, color.NRGBAModel)
+	}
+}
+
+func TestDecodeTGA(t *testing.T) {
+	// A 2x2 color-mapped image, stored from the bottom row and up, with a run-length encoded packet
+	data := []byte{
+		3, 1, tgaColorMapped | tgaRLE, 0, 0, 2, 0, 24, 0, 0, 0, 0, 2, 0, 2, 0, 8, 0,
+		'I', 'D', '!',
+		0, 0, 255, // Red
+		255, 0, 0, // Blue
+		0x81, 1, // Two blue pixels in the bottom row
+		0x01, 0, 1, // Red and blue in the top row
+	}
+	m, err := DecodeTGA(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	red, blue := color.NRGBA{255, 0, 0, 255}, color.NRGBA{0, 0, 255, 255}
+	for _, p := range []struct {
+		x, y     int
+		expected color.NRGBA
+	}{{0, 0, red}, {1, 0, blue}, {0, 1, blue}, {1, 1, blue}} {
+		if c := m.At(p.x, p.y); c != p.expected {
+			t.Errorf("Expected %v at (%d, %d), got %v", p.expected, p.x, p.y, c)
+		}
+	}
+
+	// A 16-bit true-color pixel with the alpha bit
+	data = []byte{0, 0, tgaTrueColor, 0, 0, 0, 0, 0, 0, 0, 0, 0, 1, 0, 1, 0, 16, 1, 0x1f, 0x80}
+	if m, err = DecodeTGA(bytes.NewReader(data)); err != nil {
+		t.Fatal(err)
+	}
+	if c := m.At(0, 0); c != (color.NRGBA{0, 0, 255, 255}) {
+		t.Errorf("Expected opaque blue, got %v", c)
+	}
+
+	for _, data := range [][]byte{nil, data[:18], {0, 0, 7, 0, 0, 0, 0, 0, 0, 0, 0, 0, 1, 0, 1, 0, 8, 0, 0}} {
+		if _, err := DecodeTGA(bytes.NewReader(data)); err == nil {
+			t.Errorf("Expected an error for %v", data)
+		}
+	}
+
+	// A header for a 65535x65535 image, which is rejected before the pixels are allocated
+	data = []byte{0, 0, tgaTrueColor, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0xff, 0xff, 0xff, 0xff, 32, 0}
+	if _, err := DecodeTGA(bytes.NewReader(data)); !errors.Is(err, errTGA) {
+		t.Errorf("Expected errTGA for a too large image, got %v", err)
+	}
+}
+
+func TestEncodeTGARLE(t *testing.T) {
+	m := image.NewGray(image.Rect(0, 0, 200, 2))
+	var raw, rle bytes.Buffer
+	if err := Encode(&raw, m, "tga", nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := Encode(&rle, m, "tga", &EncodeOptions{TGARLE: true}); err != nil {
+		t.Fatal(err)
+	}
+	if rle.Len() >= raw.Len() {
+		t.Errorf("Expected run-length encoding to give a smaller file, got %d >= %d bytes", rle.Len(), raw.Len())
+	}
+}
@@ -0,0 +1,537 @@
+package plates
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/color"
+	"io"
+	"math"
+	"path/filepath"
+	"sort"
+)
+
+// TIFFCompression is a compression method for TIFF images
+type TIFFCompression int
+
+const (
+	// TIFFUncompressed stores the pixels as they are. This is the default.
+	TIFFUncompressed TIFFCompression = iota
+
+	// TIFFPackBits is run-length encoding, which works well for images with
+	// large areas of a single color, like plates
+	TIFFPackBits
+
+	// TIFFLZW is Lempel-Ziv-Welch compression, which is supported by most printing software
+	TIFFLZW
+
+	// TIFFDeflate is zlib compression, which often gives the smallest files
+	TIFFDeflate
+)
+
+// TIFF tags, field types and values
+const (
+	tiffNewSubfileType  = 254
+	tiffImageWidth      = 256
+	tiffImageLength     = 257
+	tiffBitsPerSample   = 258
+	tiffCompression     = 259
+	tiffPhotometric     = 262
+	tiffStripOffsets    = 273
+	tiffSamplesPerPixel = 277
+	tiffRowsPerStrip    = 278
+	tiffStripByteCounts = 279
+	tiffXResolution     = 282
+	tiffYResolution     = 283
+	tiffPlanarConfig    = 284
+	tiffResolutionUnit  = 296
+	tiffPageNumber      = 297
+	tiffPredictor       = 317
+	tiffInkSet          = 332
+	tiffExtraSamples    = 338
+	tiffXMP             = 700
+	tiffICCProfile      = 34675
+	tiffByte            = 1
+	tiffShort           = 3
+	tiffLong            = 4
+	tiffRational        = 5
+	tiffUndefined       = 7
+	tiffBlackIsZero     = 1
+	tiffRGB             = 2
+	tiffSeparated       = 5
+	tiffUnassociated    = 2
+	tiffHorizontal      = 2
+	tiffStripSize       = 64 * 1024
+	tiffLZWClear        = 256
+	tiffLZWEnd          = 257
+	tiffLZWMaxCode      = 4094
+	tiffDefaultDPI      = 72
+	tiffInch            = 2
+	tiffCentimeter      = 3
+	tiffMultiPage       = 2
+	tiffCMYKInkSet      = 1
+	tiffHeaderSize      = 8
+	tiffIFDEntrySize    = 12
+	tiffMaxInlineValue  = 4
+)
+
+// tiffCompressionCodes are the values of the Compression tag for each TIFFCompression
+var tiffCompressionCodes = map[TIFFCompression]uint32{
+	TIFFUncompressed: 1,
+	TIFFPackBits:     32773,
+	TIFFLZW:          5,
+	TIFFDeflate:      8,
+}
+
+// tiffEntry is a field in a TIFF image file directory
+type tiffEntry struct {
+	tag, kind uint16
+	// values are the values of the field. Rationals use two values each.
+	values []uint32
+}
+
+// size returns the number of bytes that the values of the entry take up
+func (e *tiffEntry) size() int {
+	switch e.kind {
+	case tiffByte, tiffUndefined:
+		return len(e.values)
+	case tiffShort:
+		return 2 * len(e.values)
+	}
+	return 4 * len(e.values)
+}
+
+// count returns the number of values of the entry, as given in the directory
+func (e *tiffEntry) count() uint32 {
+	if e.kind == tiffRational {
+		return uint32(len(e.values) / 2)
+	}
+	return uint32(len(e.values))
+}
+
+// putValues writes the values of the entry to buf, as big-endian numbers
+func (e *tiffEntry) putValues(buf []byte) {
+	for i, v := range e.values {
+		switch e.kind {
+		case tiffByte, tiffUndefined:
+			buf[i] = uint8(v)
+		case tiffShort:
+			binary.BigEndian.PutUint16(buf[2*i:], uint16(v))
+		default:
+			binary.BigEndian.PutUint32(buf[4*i:], v)
+		}
+	}
+}
+
+// tiffPage is the pixel layout of an image, as it is stored in a TIFF file
+type tiffPage struct {
+	photometric uint32
+	samples     int
+	bits        int
+	alpha       bool
+	// row writes the samples of row y of the image to dst, big-endian for 16-bit samples
+	row func(y int, dst []byte)
+}
+
+// newTIFFPage finds the pixel layout for m. Grayscale and CMYK images are kept
+// as they are, and other images are stored as RGB, with unassociated alpha if
+// they are not opaque. Images with 16-bit channels are stored with 16 bits per sample.
+func newTIFFPage(m image.Image) *tiffPage {
+	rect := m.Bounds()
+	switch m := m.(type) {
+	case *image.Gray:
+		return &tiffPage{tiffBlackIsZero, 1, 8, false, func(y int, dst []byte) {
+			i := m.PixOffset(rect.Min.X, y)
+			copy(dst, m.Pix[i:i+rect.Dx()])
+		}}
+	case *image.Gray16:
+		return &tiffPage{tiffBlackIsZero, 1, 16, false, func(y int, dst []byte) {
+			i := m.PixOffset(rect.Min.X, y)
+			copy(dst, m.Pix[i:i+2*rect.Dx()])
+		}}
+	case *image.CMYK:
+		return &tiffPage{tiffSeparated, 4, 8, false, func(y int, dst []byte) {
+			i := m.PixOffset(rect.Min.X, y)
+			copy(dst, m.Pix[i:i+4*rect.Dx()])
+		}}
+	}
+	alpha := hasTransparency(m)
+	samples := 3
+	if alpha {
+		samples = 4
+	}
+	if is16Bit(m) {
+		return &tiffPage{tiffRGB, samples, 16, alpha, func(y int, dst []byte) {
+			for x, i := rect.Min.X, 0; x < rect.Max.X; x, i = x+1, i+2*samples {
+				c := color.NRGBA64Model.Convert(m.At(x, y)).(color.NRGBA64)
+				binary.BigEndian.PutUint16(dst[i:], c.R)
+				binary.BigEndian.PutUint16(dst[i+2:], c.G)
+				binary.BigEndian.PutUint16(dst[i+4:], c.B)
+				if alpha {
+					binary.BigEndian.PutUint16(dst[i+6:], c.A)
+				}
+			}
+		}}
+	}
+	if n, ok := m.(*image.NRGBA); ok && alpha {
+		return &tiffPage{tiffRGB, 4, 8, true, func(y int, dst []byte) {
+			i := n.PixOffset(rect.Min.X, y)
+			copy(dst, n.Pix[i:i+4*rect.Dx()])
+		}}
+	}
+	return &tiffPage{tiffRGB, samples, 8, alpha, func(y int, dst []byte) {
+		for x, i := rect.Min.X, 0; x < rect.Max.X; x, i = x+1, i+samples {
+			c := color.NRGBAModel.Convert(m.At(x, y)).(color.NRGBA)
+			dst[i], dst[i+1], dst[i+2] = c.R, c.G, c.B
+			if alpha {
+				dst[i+3] = c.A
+			}
+		}
+	}}
+}
+
+// EncodeTIFF writes the given images to w as a TIFF file, with one page per image.
+// The TIFFCompression encoding option selects the compression.
+// *image.Gray and *image.Gray16 images are written as grayscale, *image.CMYK images
+// are written with CMYK samples (for example from CombineCMYK), and all other images
+// are written as RGB, or RGBA if they have transparent pixels.
+// The resolution, ICC profile and XMP packet of the Metadata encoding option are written
+// to every page. The resolution is 72 dpi if it is not given.
+// If opts is nil, the default options are used.
+func EncodeTIFF(w io.Writer, pages []image.Image, opts *EncodeOptions) error {
+	if len(pages) == 0 {
+		return errors.New("there are no images to write")
+	}
+	if opts == nil {
+		opts = &EncodeOptions{}
+	}
+	code, ok := tiffCompressionCodes[opts.TIFFCompression]
+	if !ok {
+		return errors.New("unknown TIFF compression")
+	}
+	// The header is followed by the pages, where each page is an image file directory,
+	// the values that do not fit in the directory, and then the compressed pixels
+	header := []byte{'M', 'M', 0, 42, 0, 0, 0, tiffHeaderSize}
+	if _, err := w.Write(header); err != nil {
+		return err
+	}
+	var (
+		md         = opts.Metadata
+		resolution = []uint32{tiffDefaultDPI, 1}
+	)
+	if md == nil {
+		md = &Metadata{}
+	}
+	if md.DPI > 0 {
+		resolution = []uint32{uint32(math.Round(md.DPI * 1000)), 1000}
+	}
+	offset := uint32(tiffHeaderSize)
+	for i, m := range pages {
+		page := newTIFFPage(m)
+		strips, rowsPerStrip := page.compress(m.Bounds(), opts.TIFFCompression)
+		entries := []tiffEntry{
+			{tiffImageWidth, tiffLong, []uint32{uint32(m.Bounds().Dx())}},
+			{tiffImageLength, tiffLong, []uint32{uint32(m.Bounds().Dy())}},
+			{tiffBitsPerSample, tiffShort, repeat(uint32(page.bits), page.samples)},
+			{tiffCompression, tiffShort, []uint32{code}},
+			{tiffPhotometric, tiffShort, []uint32{page.photometric}},
+			{tiffStripOffsets, tiffLong, make([]uint32, len(strips))},
+			{tiffSamplesPerPixel, tiffShort, []uint32{uint32(page.samples)}},
+			{tiffRowsPerStrip, tiffLong, []uint32{uint32(rowsPerStrip)}},
+			{tiffStripByteCounts, tiffLong, make([]uint32, len(strips))},
+			{tiffXResolution, tiffRational, resolution},
+			{tiffYResolution, tiffRational, resolution},
+			{tiffPlanarConfig, tiffShort, []uint32{1}},
+			{tiffResolutionUnit, tiffShort, []uint32{tiffInch}},
+		}
+		if len(pages) > 1 {
+			entries = append(entries,
+				tiffEntry{tiffNewSubfileType, tiffLong, []uint32{tiffMultiPage}},
+				tiffEntry{tiffPageNumber, tiffShort, []uint32{uint32(i), uint32(len(pages))}})
+		}
+		if opts.TIFFCompression == TIFFLZW || opts.TIFFCompression == TIFFDeflate {
+			entries = append(entries, tiffEntry{tiffPredictor, tiffShort, []uint32{tiffHorizontal}})
+		}
+		if page.photometric == tiffSeparated {
+			entries = append(entries, tiffEntry{tiffInkSet, tiffShort, []uint32{tiffCMYKInkSet}})
+		}
+		if page.alpha {
+			entries = append(entries, tiffEntry{tiffExtraSamples, tiffShort, []uint32{tiffUnassociated}})
+		}
+		if len(md.XMP) > 0 {
+			entries = append(entries, tiffEntry{tiffXMP, tiffByte, byteValues(md.XMP)})
+		}
+		if len(md.ICC) > 0 {
+			entries = append(entries, tiffEntry{tiffICCProfile, tiffUndefined, byteValues(md.ICC)})
+		}
+		sort.Slice(entries, func(a, b int) bool { return entries[a].tag < entries[b].tag })
+
+		// Find where the values that do not fit in the directory, and the strips, are placed
+		var (
+			ifdSize    = 2 + tiffIFDEntrySize*len(entries) + 4
+			valuesSize = 0
+		)
+		for j := range entries {
+			// Values start at even offsets
+			if size := entries[j].size(); size > tiffMaxInlineValue {
+				valuesSize += size + size%2
+			}
+		}
+		stripOffset := offset + uint32(ifdSize+valuesSize)
+		dataSize := 0
+		for j, strip := range strips {
+			entries[indexOfTag(entries, tiffStripOffsets)].values[j] = stripOffset + uint32(dataSize)
+			entries[indexOfTag(entries, tiffStripByteCounts)].values[j] = uint32(len(strip))
+			dataSize += len(strip)
+		}
+		// Directories must start at an even offset
+		padding := dataSize % 2
+		next := uint32(0)
+		if i < len(pages)-1 {
+			next = stripOffset + uint32(dataSize+padding)
+		}
+
+		// Write the directory and the values
+		buf := make([]byte, ifdSize+valuesSize)
+		binary.BigEndian.PutUint16(buf, uint16(len(entries)))
+		valueOffset := ifdSize
+		for j := range entries {
+			e := &entries[j]
+			field := buf[2+tiffIFDEntrySize*j:]
+			binary.BigEndian.PutUint16(field, e.tag)
+			binary.BigEndian.PutUint16(field[2:], e.kind)
+			binary.BigEndian.PutUint32(field[4:], e.count())
+			if e.size() <= tiffMaxInlineValue {
+				e.putValues(field[8:12])
+				continue
+			}
+			binary.BigEndian.PutUint32(field[8:], offset+uint32(valueOffset))
+			e.putValues(buf[valueOffset:])
+			valueOffset += e.size() + e.size()%2
+		}
+		binary.BigEndian.PutUint32(buf[ifdSize-4:], next)
+		if _, err := w.Write(buf); err != nil {
+			return err
+		}
+		for _, strip := range strips {
+			if _, err := w.Write(strip); err != nil {
+				return err
+			}
+		}
+		if padding > 0 {
+			if _, err := w.Write([]byte{0}); err != nil {
+				return err
+			}
+		}
+		offset = next
+	}
+	return nil
+}
+
+// byteValues returns the bytes in b as values of a tiffEntry
+func byteValues(b []byte) []uint32 {
+	values := make([]uint32, len(b))
+	for i, v := range b {
+		values[i] = uint32(v)
+	}
+	return values
+}
+
+// repeat returns a slice with n copies of v
+func repeat(v uint32, n int) []uint32 {
+	values := make([]uint32, n)
+	for i := range values {
+		values[i] = v
+	}
+	return values
+}
+
+// indexOfTag returns the index of the entry with the given tag, or -1
+func indexOfTag(entries []tiffEntry, tag uint16) int {
+	for i := range entries {
+		if entries[i].tag == tag {
+			return i
+		}
+	}
+	return -1
+}
+
+// compress splits the rows of the page into strips of about 64 KiB, and compresses each strip
+func (p *tiffPage) compress(rect image.Rectangle, compression TIFFCompression) ([][]byte, int) {
+	rowSize := rect.Dx() * p.samples * p.bits / 8
+	rowsPerStrip := 1
+	if rowSize > 0 && rowSize < tiffStripSize {
+		rowsPerStrip = tiffStripSize / rowSize
+	}
+	var strips [][]byte
+	for y0 := rect.Min.Y; y0 < rect.Max.Y; y0 += rowsPerStrip {
+		y1 := y0 + rowsPerStrip
+		if y1 > rect.Max.Y {
+			y1 = rect.Max.Y
+		}
+		raw := make([]byte, (y1-y0)*rowSize)
+		for y := y0; y < y1; y++ {
+			row := raw[(y-y0)*rowSize : (y-y0+1)*rowSize]
+			p.row(y, row)
+			if compression == TIFFLZW || compression == TIFFDeflate {
+				p.predict(row)
+			}
+		}
+		switch compression {
+		case TIFFPackBits:
+			var packed []byte
+			// PackBits runs may not cross rows
+			for i := 0; i < len(raw); i += rowSize {
+				packed = packBits(packed, raw[i:i+rowSize])
+			}
+			raw = packed
+		case TIFFLZW:
+			raw = tiffLZW(raw)
+		case TIFFDeflate:
+			var buf bytes.Buffer
+			zw := zlib.NewWriter(&buf)
+			zw.Write(raw)
+			zw.Close()
+			raw = buf.Bytes()
+		}
+		strips = append(strips, raw)
+	}
+	return strips, rowsPerStrip
+}
+
+// predict replaces each sample in the row with the difference from the same sample
+// in the pixel to the left, which is the TIFF horizontal predictor
+func (p *tiffPage) predict(row []byte) {
+	if p.bits == 16 {
+		stride := 2 * p.samples
+		for i := len(row) - 2; i >= stride; i -= 2 {
+			v := binary.BigEndian.Uint16(row[i:]) - binary.BigEndian.Uint16(row[i-stride:])
+			binary.BigEndian.PutUint16(row[i:], v)
+		}
+		return
+	}
+	for i := len(row) - 1; i >= p.samples; i-- {
+		row[i] -= row[i-p.samples]
+	}
+}
+
+// packBits appends the PackBits encoding of data to dst.
+// Runs of 3 or more equal bytes are repeated, other bytes are copied literally.
+func packBits(dst, data []byte) []byte {
+	for i := 0; i < len(data); {
+		// Find the length of the run that starts at i
+		run := 1
+		for i+run < len(data) && run < 128 && data[i+run] == data[i] {
+			run++
+		}
+		if run >= 3 {
+			dst = append(dst, byte(1-run), data[i])
+			i += run
+			continue
+		}
+		// Copy bytes literally, up to the next run of 3 or more
+		start := i
+		for i < len(data) && i-start < 128 {
+			if i+2 < len(data) && data[i] == data[i+1] && data[i] == data[i+2] {
+				break
+			}
+			i++
+		}
+		dst = append(dst, byte(i-start-1))
+		dst = append(dst, data[start:i]...)
+	}
+	return dst
+}
+
+// tiffLZW compresses data with the LZW variant used by TIFF, where the codes are
+// written with the most significant bit first, and the code width grows one code earlier
+// than in the standard algorithm
+func tiffLZW(data []byte) []byte {
+	var (
+		out   []byte
+		bits  uint32
+		nbits uint
+		width uint = 9
+	)
+	write := func(code int) {
+		bits |= uint32(code) << (32 - width - nbits)
+		nbits += width
+		for nbits >= 8 {
+			out = append(out, byte(bits>>24))
+			bits <<= 8
+			nbits -= 8
+		}
+	}
+	write(tiffLZWClear)
+	if len(data) == 0 {
+		write(tiffLZWEnd)
+	} else {
+		// The table maps a code followed by a byte to the code for both
+		table := make(map[int]int)
+		next := tiffLZWEnd + 1
+		prefix := int(data[0])
+		for _, b := range data[1:] {
+			key := prefix<<8 | int(b)
+			if code, ok := table[key]; ok {
+				prefix = code
+				continue
+			}
+			write(prefix)
+			table[key] = next
+			next++
+			if next == tiffLZWMaxCode {
+				// The table is full, so start over
+				write(tiffLZWClear)
+				table = make(map[int]int)
+				next = tiffLZWEnd + 1
+				width = 9
+			} else if next == 1<<width {
+				width++
+			}
+			prefix = int(b)
+		}
+		write(prefix)
+		write(tiffLZWEnd)
+	}
+	if nbits > 0 {
+		out = append(out, byte(bits>>24))
+	}
+	return out
+}
+
+func encodeTIFF(w io.Writer, m image.Image, opts *EncodeOptions) error {
+	return EncodeTIFF(w, []image.Image{m}, opts)
+}
+
+// WritePlates writes the given plates to a single TIFF file, which must have a .tif or .tiff extension.
+// Four *image.Gray plates, like the ones from SeparateCMYK, are combined into a single CMYK page
+// with CombineCMYK. Other plates, like the ones from Separate3, are written with one page per plate.
+// The pages are compressed with LZW, and the file is replaced atomically, like with Write.
+func WritePlates(filename string, plates ...image.Image) error {
+	if f, ok := formatByExtension(filename); !ok || f.name != "tiff" {
+		return errors.New("plates can only be written to TIFF files, not: " + filepath.Ext(filename))
+	}
+	pages := plates
+	if len(plates) == 4 && allGray(plates) {
+		cmyk, err := CombineCMYK(plates[0], plates[1], plates[2], plates[3])
+		if err != nil {
+			return err
+		}
+		pages = []image.Image{cmyk}
+	}
+	return writeAtomically(filename, func(w io.Writer) error {
+		return EncodeTIFF(w, pages, &EncodeOptions{TIFFCompression: TIFFLZW})
+	})
+}
+
+// allGray checks if all the given images are *image.Gray
+func allGray(images []image.Image) bool {
+	for _, m := range images {
+		if _, ok := m.(*image.Gray); !ok {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,244 @@
+package plates
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/image/tiff"
+	"golang.org/x/image/tiff/lzw"
+)
+
+// tiffDirectories returns the fields of each page in a big-endian TIFF file, by tag
+func tiffDirectories(t *testing.T, data []byte) []map[uint16][]uint32 {
+	t.Helper()
+	if !bytes.HasPrefix(data, []byte("MM\x00*")) {
+		t.Fatalf("Expected a big-endian TIFF header, got %q", data[:4])
+	}
+	var pages []map[uint16][]uint32
+	for offset := binary.BigEndian.Uint32(data[4:]); offset != 0; {
+		fields := make(map[uint16][]uint32)
+		n := int(binary.BigEndian.Uint16(data[offset:]))
+		for i := 0; i < n; i++ {
+			entry := data[int(offset)+2+12*i:]
+			tag, kind, count := binary.BigEndian.Uint16(entry), binary.BigEndian.Uint16(entry[2:]), binary.BigEndian.Uint32(entry[4:])
+			size := 4
+			if kind == tiffShort {
+				size = 2
+			} else if kind == tiffRational {
+				count *= 2
+			}
+			values := entry[8:]
+			if int(count)*size > 4 {
+				values = data[binary.BigEndian.Uint32(entry[8:]):]
+			}
+			for j := 0; j < int(count); j++ {
+				if size == 2 {
+					fields[tag] = append(fields[tag], uint32(binary.BigEndian.Uint16(values[2*j:])))
+				} else {
+					fields[tag] = append(fields[tag], binary.BigEndian.Uint32(values[4*j:]))
+				}
+			}
+		}
+		pages = append(pages, fields)
+		offset = binary.BigEndian.Uint32(data[int(offset)+2+12*n:])
+	}
+	return pages
+}
+
+// noisyImage returns an image with smooth gradients, flat areas and noise,
+// so that all kinds of runs and LZW codes are used
+func noisyImage(width, height int) *image.NRGBA {
+	m := image.NewNRGBA(image.Rect(0, 0, width, height))
+	rng := rand.New(rand.NewSource(1))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			switch {
+			case x < width/3:
+				m.SetNRGBA(x, y, color.NRGBA{uint8(x), uint8(y), 200, 255})
+			case x < 2*width/3:
+				m.SetNRGBA(x, y, color.NRGBA{10, 20, 30, 128})
+			default:
+				m.SetNRGBA(x, y, color.NRGBA{uint8(rng.Intn(256)), uint8(rng.Intn(256)), uint8(rng.Intn(256)), uint8(rng.Intn(256))})
+			}
+		}
+	}
+	return m
+}
+
+func TestTIFFLZW(t *testing.T) {
+	rng := rand.New(rand.NewSource(2))
+	for _, n := range []int{0, 1, 2, 100, 5000, 100000} {
+		for _, alphabet := range []int{1, 3, 256} {
+			data := make([]byte, n)
+			for i := range data {
+				data[i] = byte(rng.Intn(alphabet))
+			}
+			decoded, err := io.ReadAll(lzw.NewReader(bytes.NewReader(tiffLZW(data)), lzw.MSB, 8))
+			if err != nil {
+				t.Errorf("%d bytes from %d symbols: %v", n, alphabet, err)
+			} else if !bytes.Equal(decoded, data) {
+				t.Errorf("%d bytes from %d symbols: the data changed", n, alphabet)
+			}
+		}
+	}
+}
+
+func TestPackBits(t *testing.T) {
+	data := []byte{1, 1, 1, 1, 2, 3, 4, 4, 5, 5, 5}
+	data = append(data, bytes.Repeat([]byte{9}, 300)...)
+	data = append(data, 6, 7)
+	packed := packBits(nil, data)
+	// Unpack the data again
+	var unpacked []byte
+	for i := 0; i < len(packed); {
+		n := int(int8(packed[i]))
+		switch {
+		case n >= 0:
+			unpacked = append(unpacked, packed[i+1:i+2+n]...)
+			i += 2 + n
+		default:
+			unpacked = append(unpacked, bytes.Repeat([]byte{packed[i+1]}, 1-n)...)
+			i += 2
+		}
+	}
+	if !bytes.Equal(unpacked, data) {
+		t.Errorf("Expected %v, got %v", data, unpacked)
+	}
+}
+
+func TestEncodeTIFF(t *testing.T) {
+	var (
+		noisy  = noisyImage(300, 250)
+		gray   = image.NewGray(image.Rect(0, 0, 300, 250))
+		gray16 = image.NewGray16(image.Rect(0, 0, 30, 20))
+		rgba64 = image.NewRGBA64(image.Rect(0, 0, 30, 20))
+		opaque = image.NewRGBA(image.Rect(0, 0, 30, 20))
+	)
+	for i := range gray.Pix {
+		gray.Pix[i] = uint8(i / 7)
+	}
+	for y := 0; y < 20; y++ {
+		for x := 0; x < 30; x++ {
+			gray16.SetGray16(x, y, color.Gray16{uint16(x*2000 + y)})
+			rgba64.SetRGBA64(x, y, color.RGBA64{uint16(x * 2000), uint16(y * 3000), 0x1234, 0xffff})
+			opaque.SetRGBA(x, y, color.RGBA{uint8(x), uint8(y), 7, 255})
+		}
+	}
+	for _, compression := range []TIFFCompression{TIFFUncompressed, TIFFPackBits, TIFFLZW, TIFFDeflate} {
+		for _, m := range []image.Image{noisy, gray, gray16, rgba64, opaque} {
+			var buf bytes.Buffer
+			if err := EncodeTIFF(&buf, []image.Image{m}, &EncodeOptions{TIFFCompression: compression}); err != nil {
+				t.Fatal(err)
+			}
+			decoded, err := tiff.Decode(&buf)
+			if err != nil {
+				t.Errorf("%T with compression %d: %v", m, compression, err)
+				continue
+			}
+			sameColors(t, m, decoded)
+		}
+	}
+	if err := EncodeTIFF(io.Discard, nil, nil); err == nil {
+		t.Error("Expected an error when there are no pages")
+	}
+}
+
+// sameColors checks that two images have the same size and the same 16-bit colors
+func sameColors(t *testing.T, expected, actual image.Image) {
+	t.Helper()
+	if expected.Bounds() != actual.Bounds() {
+		t.Fatalf("Expected the size %v, got %v", expected.Bounds(), actual.Bounds())
+	}
+	rect := expected.Bounds()
+	for y := rect.Min.Y; y < rect.Max.Y; y++ {
+		for x := rect.Min.X; x < rect.Max.X; x++ {
+			c1 := color.NRGBA64Model.Convert(expected.At(x, y))
+			c2 := color.NRGBA64Model.Convert(actual.At(x, y))
+			if c1 != c2 {
+				t.Fatalf("%T to %T: expected %v at (%d, %d), got %v", expected, actual, c1, x, y, c2)
+			}
+		}
+	}
+}
+
+func TestWritePlates(t *testing.T) {
+	dir := t.TempDir()
+	m := testImage()
+
+	// Separate3 gives one page per plate
+	filename := filepath.Join(dir, "plates.tif")
+	p1, p2, p3 := Separate3(m, color.RGBA{255, 0, 0, 255}, color.RGBA{0, 255, 0, 255}, color.RGBA{0, 0, 255, 255}, 0)
+	if err := WritePlates(filename, p1, p2, p3); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pages := tiffDirectories(t, data)
+	if len(pages) != 3 {
+		t.Fatalf("Expected 3 pages, got %d", len(pages))
+	}
+	for i, page := range pages {
+		if got := page[tiffPageNumber]; len(got) != 2 || got[0] != uint32(i) || got[1] != 3 {
+			t.Errorf("Expected page %d of 3, got %v", i, got)
+		}
+	}
+	first, err := Read(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sameColors(t, p1, first)
+
+	// SeparateCMYK gives a single CMYK page
+	filename = filepath.Join(dir, "cmyk.tiff")
+	c, mg, y, k := SeparateCMYK(m)
+	if err := WritePlates(filename, c, mg, y, k); err != nil {
+		t.Fatal(err)
+	}
+	if data, err = os.ReadFile(filename); err != nil {
+		t.Fatal(err)
+	}
+	pages = tiffDirectories(t, data)
+	if len(pages) != 1 {
+		t.Fatalf("Expected 1 page, got %d", len(pages))
+	}
+	if got := pages[0][tiffPhotometric]; len(got) != 1 || got[0] != tiffSeparated {
+		t.Errorf("Expected a CMYK page, got the photometric interpretation %v", got)
+	}
+	if got := pages[0][tiffSamplesPerPixel]; len(got) != 1 || got[0] != 4 {
+		t.Errorf("Expected 4 samples per pixel, got %v", got)
+	}
+
+	if err := WritePlates(filepath.Join(dir, "plates.png"), p1); err == nil {
+		t.Error("Expected an error for a filename that is not a TIFF file")
+	}
+}
+
+func TestCombineCMYK(t *testing.T) {
+	m := testImage()
+	c, mg, y, k := SeparateCMYK(m)
+	cmyk, err := CombineCMYK(c, mg, y, k)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, plate := range []image.Image{c, mg, y, k} {
+		gray := plate.(*image.Gray)
+		for j, v := range gray.Pix {
+			if ink := cmyk.Pix[4*j+i]; ink != 255-v {
+				t.Fatalf("Plate %d, pixel %d: expected the ink %d, got %d", i, j, 255-v, ink)
+			}
+		}
+	}
+	// A smaller plate would otherwise be read as full ink coverage outside of its bounds
+	if _, err := CombineCMYK(c, mg, y, image.NewGray(image.Rect(0, 0, 2, 2))); err == nil {
+		t.Error("Expected an error for plates with different sizes")
+	}
+}
@@ -4,26 +4,6 @@ import (
 	"math"
 )
 
-// Smallest of three bytes
-func min(a, b, c uint8) uint8 {
-	if (a < b) && (a < c) {
-		return a
-	} else if (b < a) && (b < c) {
-		return b
-	}
-	return c
-}
-
-// Largest of three bytes
-func max(a, b, c uint8) uint8 {
-	if (a >= b) && (a >= c) {
-		return a
-	} else if (b >= a) && (b >= c) {
-		return b
-	}
-	return c
-}
-
 // Smallest of three floats
 func fmin(a, b, c float64) float64 {
 	return math.Min(math.Min(a, b), c)
@@ -34,15 +14,36 @@ func fmax(a, b, c float64) float64 {
 	return math.Max(math.Max(a, b), c)
 }
 
-// Absolute value
-func abs(a int8) uint8 {
-	if a < 0 {
-		return uint8(-a)
+// Absolute difference between two bytes
+func absdiff(a, b uint8) uint8 {
+	if a > b {
+		return a - b
 	}
-	return uint8(a)
+	return b - a
 }
 
 // Absolute value
 func fabs(a float64) float64 {
 	return math.Abs(a)
 }
+
+// Clamp a float to the range 0 to 1
+func clamp01(a float64) float64 {
+	if a < 0 {
+		return 0
+	}
+	if a > 1 {
+		return 1
+	}
+	return a
+}
+
+// Square of a float
+func sq(a float64) float64 {
+	return a * a
+}
+
+// Convert degrees to radians
+func radians(degrees float64) float64 {
+	return degrees * math.Pi / 180.0
+}
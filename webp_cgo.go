@@ -0,0 +1,29 @@
+//go:build cgo && !purego
+
+package plates
+
+import (
+	"image"
+	"io"
+
+	"github.com/chai2010/webp"
+)
+
+// decodeWebP decodes a WebP image with libwebp. The *image.RGBA that is returned for
+// images with alpha holds colors that are not premultiplied, so it is returned as an *image.NRGBA.
+func decodeWebP(r io.Reader) (image.Image, error) {
+	m, err := webp.Decode(r)
+	if rgba, ok := m.(*image.RGBA); ok {
+		return &image.NRGBA{Pix: rgba.Pix, Stride: rgba.Stride, Rect: rgba.Rect}, err
+	}
+	return m, err
+}
+
+// encodeWebP encodes a WebP image with libwebp, which supports both lossy and lossless compression
+func encodeWebP(w io.Writer, m image.Image, opts *EncodeOptions) error {
+	quality := float32(webp.DefaulQuality)
+	if opts.WebPQuality > 0 {
+		quality = opts.WebPQuality
+	}
+	return webp.Encode(w, m, &webp.Options{Lossless: opts.WebPLossless, Quality: quality})
+}
@@ -0,0 +1,21 @@
+//go:build !cgo || purego
+
+package plates
+
+import (
+	"image"
+	"io"
+
+	"golang.org/x/image/webp"
+)
+
+// decodeWebP decodes a WebP image with the pure Go decoder from golang.org/x/image
+func decodeWebP(r io.Reader) (image.Image, error) {
+	return webp.Decode(r)
+}
+
+// encodeWebP encodes a lossless WebP image with the pure Go encoder,
+// since lossy compression needs libwebp and cgo
+func encodeWebP(w io.Writer, m image.Image, _ *EncodeOptions) error {
+	return EncodeWebPLossless(w, m)
+}
@@ -0,0 +1,218 @@
+package plates
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	"io"
+)
+
+// errWebPAnimation is returned when an animated WebP image could not be decoded
+var errWebPAnimation = errors.New("invalid animated WebP image")
+
+// Flags in the VP8X chunk of a WebP image, and in the ANMF chunk of each frame
+const (
+	webpAnimationFlag = 0x02
+	webpAlphaFlag     = 0x10
+	webpDisposeFlag   = 0x01
+	webpNoBlendFlag   = 0x02
+	// webpFrameHeaderSize is the size of the frame position, size, duration and flags in an ANMF chunk
+	webpFrameHeaderSize = 16
+)
+
+// isAnimatedWebP checks if data is a WebP image with the animation flag set
+func isAnimatedWebP(data []byte) bool {
+	return len(data) >= 21 && string(data[:4]) == "RIFF" && string(data[8:16]) == "WEBPVP8X" && data[20]&webpAnimationFlag != 0
+}
+
+// DecodeAllWebP decodes all the frames of a WebP image, and combines each frame
+// with the previous frames according to the blending and disposal method of each
+// frame, so that each frame in the returned animation is a complete *image.RGBA.
+// A WebP image that is not animated gives an animation with one frame.
+func DecodeAllWebP(r io.Reader) (*Animation, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if !isAnimatedWebP(data) {
+		m, err := decodeWebP(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		return &Animation{Frames: []image.Image{m}, Delays: []int{0}}, nil
+	}
+	chunks, err := parseRIFF(data)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errWebPAnimation, err)
+	}
+	var (
+		a      = &Animation{}
+		canvas *image.RGBA
+	)
+	for _, chunk := range chunks {
+		switch chunk.kind {
+		case "VP8X":
+			if len(chunk.data) < 10 {
+				return nil, fmt.Errorf("%w: the VP8X chunk is too short", errWebPAnimation)
+			}
+			width, height := uint24(chunk.data[4:])+1, uint24(chunk.data[7:])+1
+			if width > maxPixels/height {
+				return nil, fmt.Errorf("%w: the image is too large: %dx%d", errWebPAnimation, width, height)
+			}
+			canvas = image.NewRGBA(image.Rect(0, 0, width, height))
+		case "ANIM":
+			// The background color is only a hint, so the canvas starts out transparent
+			if len(chunk.data) < 6 {
+				return nil, fmt.Errorf("%w: the ANIM chunk is too short", errWebPAnimation)
+			}
+			a.LoopCount = webpLoopCount(int(binary.LittleEndian.Uint16(chunk.data[4:])))
+		case "ANMF":
+			if canvas == nil || len(chunk.data) < webpFrameHeaderSize {
+				return nil, fmt.Errorf("%w: invalid frame", errWebPAnimation)
+			}
+			var (
+				header = chunk.data
+				x, y   = 2 * uint24(header), 2 * uint24(header[3:])
+				flags  = header[15]
+				rect   = image.Rect(x, y, x+uint24(header[6:])+1, y+uint24(header[9:])+1)
+			)
+			frame, err := decodeWebPFrame(chunk.data[webpFrameHeaderSize:], rect.Dx(), rect.Dy())
+			if err != nil {
+				return nil, fmt.Errorf("%w: frame %d: %v", errWebPAnimation, len(a.Frames), err)
+			}
+			op := draw.Over
+			if flags&webpNoBlendFlag != 0 {
+				op = draw.Src
+			}
+			draw.Draw(canvas, rect, frame, frame.Bounds().Min, op)
+			a.Frames = append(a.Frames, cloneRGBA(canvas))
+			// The duration is in milliseconds
+			a.Delays = append(a.Delays, (uint24(header[12:])+5)/10)
+			if flags&webpDisposeFlag != 0 {
+				draw.Draw(canvas, rect, image.Transparent, image.Point{}, draw.Src)
+			}
+		}
+	}
+	if len(a.Frames) == 0 {
+		return nil, fmt.Errorf("%w: there are no frames", errWebPAnimation)
+	}
+	return a, nil
+}
+
+// decodeWebPFrame decodes the image data of an ANMF chunk, by making a WebP image of it
+func decodeWebPFrame(data []byte, width, height int) (image.Image, error) {
+	chunks, err := parseRIFF(append([]byte("RIFF\x00\x00\x00\x00WEBP"), data...))
+	if err != nil {
+		return nil, err
+	}
+	var (
+		images []riffChunk
+		flags  byte
+	)
+	for _, chunk := range chunks {
+		switch chunk.kind {
+		case "ALPH":
+			flags |= webpAlphaFlag
+			images = append(images, chunk)
+		case "VP8 ", "VP8L":
+			images = append(images, chunk)
+		}
+	}
+	if flags != 0 {
+		images = append([]riffChunk{{"VP8X", vp8xData(flags, width, height)}}, images...)
+	}
+	return decodeWebP(bytes.NewReader(riffBytes(images)))
+}
+
+// webpLoopCount converts the number of times a WebP animation is shown, where 0 is forever,
+// to an Animation LoopCount, which is the same as for image/gif
+func webpLoopCount(loops int) int {
+	if loops == 1 {
+		return -1
+	}
+	if loops > 1 {
+		return loops - 1
+	}
+	return 0
+}
+
+// EncodeAllWebP writes all the frames of the given animation to w as an animated WebP image.
+// Each frame is encoded like a still WebP image with the given options, which is lossless
+// for the pure Go encoder. All frames must have the same size. If opts is nil, the default
+// options are used.
+func EncodeAllWebP(w io.Writer, a *Animation, opts *EncodeOptions) error {
+	if len(a.Frames) == 0 {
+		return errors.New("the animation has no frames")
+	}
+	if opts == nil {
+		opts = &EncodeOptions{}
+	}
+	var (
+		size   = a.Frames[0].Bounds().Size()
+		flags  = byte(webpAnimationFlag)
+		frames []riffChunk
+	)
+	if size.X < 1 || size.Y < 1 || size.X > 1<<24 || size.Y > 1<<24 {
+		return fmt.Errorf("invalid size for a WebP animation: %dx%d", size.X, size.Y)
+	}
+	for i, frame := range a.Frames {
+		if frame.Bounds().Size() != size {
+			return fmt.Errorf("frame %d has a different size than the first frame: %v", i, frame.Bounds().Size())
+		}
+		if hasTransparency(frame) {
+			flags |= webpAlphaFlag
+		}
+		var buf bytes.Buffer
+		if err := encodeWebP(&buf, frame, opts); err != nil {
+			return err
+		}
+		chunks, err := parseRIFF(buf.Bytes())
+		if err != nil {
+			return err
+		}
+		// Every frame covers the whole canvas, without blending or disposal
+		header := make([]byte, webpFrameHeaderSize)
+		putUint24(header[6:], size.X-1)
+		putUint24(header[9:], size.Y-1)
+		delay := 0
+		if i < len(a.Delays) {
+			delay = a.Delays[i]
+		}
+		putUint24(header[12:], clampInt(delay*10, 0, 1<<24-1))
+		header[15] = webpNoBlendFlag
+		for _, chunk := range chunks {
+			switch chunk.kind {
+			case "ALPH", "VP8 ", "VP8L":
+				header = append(header, riffBytes([]riffChunk{chunk})[12:]...)
+			}
+		}
+		frames = append(frames, riffChunk{"ANMF", header})
+	}
+	// The background color (transparent) and the loop count
+	anim := make([]byte, 6)
+	loops := 0
+	switch {
+	case a.LoopCount < 0:
+		loops = 1
+	case a.LoopCount > 0:
+		loops = clampInt(a.LoopCount+1, 2, 0xffff)
+	}
+	binary.LittleEndian.PutUint16(anim[4:], uint16(loops))
+	chunks := append([]riffChunk{{"VP8X", vp8xData(flags, size.X, size.Y)}, {"ANIM", anim}}, frames...)
+	_, err := w.Write(riffBytes(chunks))
+	return err
+}
+
+// clampInt returns v, limited to the range from lo to hi
+func clampInt(v, lo, hi int) int {
+	if v < lo {
+		return lo
+	}
+	if v > hi {
+		return hi
+	}
+	return v
+}
@@ -0,0 +1,408 @@
+package plates
+
+import (
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/color"
+	"io"
+	"sort"
+)
+
+// Constants for the WebP lossless (VP8L) bitstream
+const (
+	vp8lSignature        = 0x2f
+	vp8lMaxSize          = 1 << 14
+	vp8lPredictor        = 0
+	vp8lSubtractGreen    = 2
+	vp8lPredictorBits    = 5
+	vp8lMaxCodeLength    = 15
+	vp8lMaxCodeLengthLen = 7
+	vp8lNumLengthCodes   = 24
+	vp8lNumDistanceCodes = 40
+)
+
+// The predictor modes that are tried for each block: left, top and the gradient
+// (left + top - top left, clamped to 0..255)
+const (
+	vp8lPredictLeft     = 1
+	vp8lPredictTop      = 2
+	vp8lPredictGradient = 12
+)
+
+// vp8lCodeLengthOrder is the order that the lengths of the code length code are written in
+var vp8lCodeLengthOrder = [19]int{17, 18, 0, 1, 2, 3, 4, 5, 16, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15}
+
+// vp8lWriter writes bits to a VP8L bitstream, least significant bit first
+type vp8lWriter struct {
+	buf   []byte
+	bits  uint64
+	nbits uint
+}
+
+// write writes the n lowest bits of v
+func (w *vp8lWriter) write(v uint32, n uint) {
+	w.bits |= uint64(v) << w.nbits
+	w.nbits += n
+	for w.nbits >= 8 {
+		w.buf = append(w.buf, byte(w.bits))
+		w.bits >>= 8
+		w.nbits -= 8
+	}
+}
+
+// flush writes the remaining bits, padded with zeros to a whole byte
+func (w *vp8lWriter) flush() {
+	if w.nbits > 0 {
+		w.buf = append(w.buf, byte(w.bits))
+		w.bits, w.nbits = 0, 0
+	}
+}
+
+// vp8lCode is a prefix code for one of the alphabets in a VP8L image
+type vp8lCode struct {
+	lengths []int
+	// codes are bit reversed, so that they can be written least significant bit first
+	codes []uint32
+}
+
+// huffmanLengths returns the code lengths of a Huffman code for the given symbol frequencies,
+// where no code is longer than maxLength. If the code would be too long, the smallest
+// frequencies are raised until it fits, which keeps the code complete.
+func huffmanLengths(freqs []int, maxLength int) []int {
+	lengths := make([]int, len(freqs))
+	for minFreq := 1; ; minFreq *= 2 {
+		var (
+			weights []int
+			parents []int
+			active  []int
+		)
+		for _, f := range freqs {
+			if f > 0 {
+				if f < minFreq {
+					f = minFreq
+				}
+				active = append(active, len(weights))
+				weights = append(weights, f)
+				parents = append(parents, -1)
+			}
+		}
+		leaves := len(weights)
+		// Join the two lightest nodes until there is only one left
+		for len(active) > 1 {
+			sort.SliceStable(active, func(i, j int) bool { return weights[active[i]] < weights[active[j]] })
+			node := len(weights)
+			weights = append(weights, weights[active[0]]+weights[active[1]])
+			parents = append(parents, -1)
+			parents[active[0]], parents[active[1]] = node, node
+			active = append(active[2:], node)
+		}
+		longest, leaf := 0, 0
+		for symbol, f := range freqs {
+			if f == 0 {
+				continue
+			}
+			length := 0
+			for n := leaf; parents[n] >= 0; n = parents[n] {
+				length++
+			}
+			if leaves == 1 {
+				length = 1
+			}
+			lengths[symbol] = length
+			if length > longest {
+				longest = length
+			}
+			leaf++
+		}
+		if longest <= maxLength {
+			return lengths
+		}
+	}
+}
+
+// newVP8LCode makes a canonical prefix code from the given code lengths
+func newVP8LCode(lengths []int) *vp8lCode {
+	c := &vp8lCode{lengths: lengths, codes: make([]uint32, len(lengths))}
+	var (
+		count [vp8lMaxCodeLength + 1]int
+		next  [vp8lMaxCodeLength + 2]uint32
+	)
+	for _, l := range lengths {
+		count[l]++
+	}
+	count[0] = 0
+	for l := 1; l <= vp8lMaxCodeLength; l++ {
+		next[l+1] = (next[l] + uint32(count[l])) << 1
+	}
+	for symbol, l := range lengths {
+		if l == 0 {
+			continue
+		}
+		code := next[l]
+		next[l]++
+		// Reverse the bits, since the code is read one bit at a time from the most significant bit
+		var reversed uint32
+		for i := 0; i < l; i++ {
+			reversed = reversed<<1 | code>>uint(i)&1
+		}
+		c.codes[symbol] = reversed
+	}
+	return c
+}
+
+// writeSymbol writes the code for a symbol
+func (c *vp8lCode) writeSymbol(w *vp8lWriter, symbol int) {
+	w.write(c.codes[symbol], uint(c.lengths[symbol]))
+}
+
+// writeVP8LCode makes a prefix code for the given symbol frequencies, writes it and returns it
+func writeVP8LCode(w *vp8lWriter, freqs []int) *vp8lCode {
+	var used []int
+	for symbol, f := range freqs {
+		if f > 0 {
+			used = append(used, symbol)
+		}
+	}
+	if len(used) <= 1 && (len(used) == 0 || used[0] < 256) {
+		// A simple code with a single symbol, which takes no bits to write
+		symbol := 0
+		if len(used) == 1 {
+			symbol = used[0]
+		}
+		w.write(1, 1) // simple code
+		w.write(0, 1) // one symbol
+		if symbol < 2 {
+			w.write(0, 1)
+			w.write(uint32(symbol), 1)
+		} else {
+			w.write(1, 1)
+			w.write(uint32(symbol), 8)
+		}
+		return &vp8lCode{lengths: make([]int, len(freqs)), codes: make([]uint32, len(freqs))}
+	}
+	code := newVP8LCode(huffmanLengths(freqs, vp8lMaxCodeLength))
+
+	// The code lengths are written with a code of their own
+	lengthFreqs := make([]int, len(vp8lCodeLengthOrder))
+	for _, l := range code.lengths {
+		lengthFreqs[l]++
+	}
+	// The code length code needs two symbols to be complete, even if only one is used
+	if nonzero := countNonzero(lengthFreqs); nonzero < 2 {
+		if lengthFreqs[0] == 0 {
+			lengthFreqs[0] = 1
+		} else {
+			lengthFreqs[1] = 1
+		}
+	}
+	lengthCode := newVP8LCode(huffmanLengths(lengthFreqs, vp8lMaxCodeLengthLen))
+	n := len(vp8lCodeLengthOrder)
+	for n > 4 && lengthCode.lengths[vp8lCodeLengthOrder[n-1]] == 0 {
+		n--
+	}
+	w.write(0, 1) // normal code
+	w.write(uint32(n-4), 4)
+	for _, symbol := range vp8lCodeLengthOrder[:n] {
+		w.write(uint32(lengthCode.lengths[symbol]), 3)
+	}
+	w.write(0, 1) // the lengths of all the symbols are written
+	for _, l := range code.lengths {
+		lengthCode.writeSymbol(w, l)
+	}
+	return code
+}
+
+// countNonzero returns the number of values that are not 0
+func countNonzero(values []int) int {
+	n := 0
+	for _, v := range values {
+		if v != 0 {
+			n++
+		}
+	}
+	return n
+}
+
+// writeVP8LImage writes ARGB pixels as an entropy-coded image with a single group of
+// prefix codes and no backward references or color cache
+func writeVP8LImage(w *vp8lWriter, pixels []uint32, isMain bool) {
+	var (
+		green = make([]int, 256+vp8lNumLengthCodes)
+		red   = make([]int, 256)
+		blue  = make([]int, 256)
+		alpha = make([]int, 256)
+	)
+	for _, p := range pixels {
+		alpha[p>>24]++
+		red[p>>16&0xff]++
+		green[p>>8&0xff]++
+		blue[p&0xff]++
+	}
+	w.write(0, 1) // no color cache
+	if isMain {
+		w.write(0, 1) // a single group of prefix codes for the whole image
+	}
+	var (
+		greenCode = writeVP8LCode(w, green)
+		redCode   = writeVP8LCode(w, red)
+		blueCode  = writeVP8LCode(w, blue)
+		alphaCode = writeVP8LCode(w, alpha)
+	)
+	writeVP8LCode(w, make([]int, vp8lNumDistanceCodes))
+	for _, p := range pixels {
+		greenCode.writeSymbol(w, int(p>>8&0xff))
+		redCode.writeSymbol(w, int(p>>16&0xff))
+		blueCode.writeSymbol(w, int(p&0xff))
+		alphaCode.writeSymbol(w, int(p>>24))
+	}
+}
+
+// vp8lPredict returns the prediction for a pixel with the given predictor mode and neighbors
+func vp8lPredict(mode int, left, top, topLeft uint32) uint32 {
+	switch mode {
+	case vp8lPredictLeft:
+		return left
+	case vp8lPredictTop:
+		return top
+	}
+	var p uint32
+	for shift := uint(0); shift < 32; shift += 8 {
+		v := int(left>>shift&0xff) + int(top>>shift&0xff) - int(topLeft>>shift&0xff)
+		if v < 0 {
+			v = 0
+		} else if v > 255 {
+			v = 255
+		}
+		p |= uint32(v) << shift
+	}
+	return p
+}
+
+// vp8lSubtract subtracts each of the four channels of b from a, modulo 256
+func vp8lSubtract(a, b uint32) uint32 {
+	var d uint32
+	for shift := uint(0); shift < 32; shift += 8 {
+		d |= (a>>shift - b>>shift) & 0xff << shift
+	}
+	return d
+}
+
+// vp8lCost is a measure of how well a residual can be compressed, where small values are best
+func vp8lCost(residual uint32) int {
+	cost := 0
+	for shift := uint(0); shift < 32; shift += 8 {
+		v := int(int8(residual >> shift))
+		if v < 0 {
+			v = -v
+		}
+		cost += v
+	}
+	return cost
+}
+
+// EncodeWebPLossless writes the image m to w as a lossless WebP image.
+// This is a pure Go encoder, which is always available, but the files are larger
+// than the ones written by libwebp, since it only uses the subtract green and
+// predictor transforms and prefix codes, without backward references.
+func EncodeWebPLossless(w io.Writer, m image.Image) error {
+	rect := m.Bounds()
+	width, height := rect.Dx(), rect.Dy()
+	if width == 0 || height == 0 || width > vp8lMaxSize || height > vp8lMaxSize {
+		return errors.New("the image size is not supported by WebP: " + rect.Size().String())
+	}
+
+	// Get the ARGB pixels, with the subtract green transform already applied
+	argb := make([]uint32, width*height)
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			c := color.NRGBAModel.Convert(m.At(rect.Min.X+x, rect.Min.Y+y)).(color.NRGBA)
+			argb[y*width+x] = uint32(c.A)<<24 | uint32(c.R-c.G)<<16 | uint32(c.G)<<8 | uint32(c.B-c.G)
+		}
+	}
+
+	// Choose the predictor mode that gives the smallest residuals for each block
+	var (
+		blockSize = 1 << vp8lPredictorBits
+		blocksX   = (width + blockSize - 1) / blockSize
+		blocksY   = (height + blockSize - 1) / blockSize
+		modes     = make([]uint32, blocksX*blocksY)
+		residuals = make([]uint32, len(argb))
+	)
+	predict := func(mode, x, y int) uint32 {
+		switch {
+		case x == 0 && y == 0:
+			return 0xff000000
+		case y == 0:
+			return argb[x-1]
+		case x == 0:
+			return argb[(y-1)*width]
+		}
+		i := y*width + x
+		return vp8lPredict(mode, argb[i-1], argb[i-width], argb[i-width-1])
+	}
+	for by := 0; by < blocksY; by++ {
+		for bx := 0; bx < blocksX; bx++ {
+			best, bestCost := vp8lPredictLeft, -1
+			for _, mode := range []int{vp8lPredictLeft, vp8lPredictTop, vp8lPredictGradient} {
+				cost := 0
+				for y := by * blockSize; y < (by+1)*blockSize && y < height; y++ {
+					for x := bx * blockSize; x < (bx+1)*blockSize && x < width; x++ {
+						cost += vp8lCost(vp8lSubtract(argb[y*width+x], predict(mode, x, y)))
+					}
+				}
+				if bestCost < 0 || cost < bestCost {
+					best, bestCost = mode, cost
+				}
+			}
+			// The mode is stored in the green channel
+			modes[by*blocksX+bx] = uint32(best) << 8
+			for y := by * blockSize; y < (by+1)*blockSize && y < height; y++ {
+				for x := bx * blockSize; x < (bx+1)*blockSize && x < width; x++ {
+					residuals[y*width+x] = vp8lSubtract(argb[y*width+x], predict(best, x, y))
+				}
+			}
+		}
+	}
+
+	bw := &vp8lWriter{}
+	bw.write(vp8lSignature, 8)
+	bw.write(uint32(width-1), 14)
+	bw.write(uint32(height-1), 14)
+	if hasTransparency(m) {
+		bw.write(1, 1)
+	} else {
+		bw.write(0, 1)
+	}
+	bw.write(0, 3) // version
+	// The transforms are undone by the decoder in the opposite order
+	bw.write(1, 1)
+	bw.write(vp8lSubtractGreen, 2)
+	bw.write(1, 1)
+	bw.write(vp8lPredictor, 2)
+	bw.write(vp8lPredictorBits-2, 3)
+	writeVP8LImage(bw, modes, false)
+	bw.write(0, 1) // no more transforms
+	writeVP8LImage(bw, residuals, true)
+	bw.flush()
+
+	// The RIFF container, where the chunk is padded to an even size
+	data := bw.buf
+	padding := len(data) % 2
+	header := make([]byte, 20)
+	copy(header, "RIFF")
+	binary.LittleEndian.PutUint32(header[4:], uint32(4+8+len(data)+padding))
+	copy(header[8:], "WEBPVP8L")
+	binary.LittleEndian.PutUint32(header[16:], uint32(len(data)))
+	if _, err := w.Write(header); err != nil {
+		return err
+	}
+	if _, err := w.Write(data); err != nil {
+		return err
+	}
+	if padding > 0 {
+		_, err := w.Write([]byte{0})
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,60 @@
+package plates
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"testing"
+
+	"golang.org/x/image/webp"
+)
+
+func TestWebPLosslessRoundTrip(t *testing.T) {
+	testRoundTrip(t, EncodeWebPLossless, webp.Decode, color.NRGBAModel)
+}
+
+func TestHuffmanLengths(t *testing.T) {
+	// Fibonacci frequencies give the longest possible codes
+	freqs := []int{1, 1}
+	for len(freqs) < 30 {
+		freqs = append(freqs, freqs[len(freqs)-1]+freqs[len(freqs)-2])
+	}
+	for _, maxLength := range []int{7, 15} {
+		lengths := huffmanLengths(freqs, maxLength)
+		// The code must be complete, so that the sum of 2^-length is exactly 1
+		sum := 0
+		for _, l := range lengths {
+			if l < 1 || l > maxLength {
+				t.Fatalf("Expected code lengths from 1 to %d, got %v", maxLength, lengths)
+			}
+			sum += 1 << uint(maxLength-l)
+		}
+		if sum != 1<<uint(maxLength) {
+			t.Errorf("Expected a complete code with at most %d bits, got %v", maxLength, lengths)
+		}
+	}
+}
+
+func TestEncodeWebPLossless(t *testing.T) {
+	// A large image with few colors should compress to less than two bits per pixel
+	m := image.NewGray(image.Rect(0, 0, 300, 200))
+	for i := range m.Pix {
+		m.Pix[i] = uint8(i % 300 / 100 * 100)
+	}
+	var buf bytes.Buffer
+	if err := EncodeWebPLossless(&buf, m); err != nil {
+		t.Fatal(err)
+	}
+	if buf.Len() > len(m.Pix)/4 {
+		t.Errorf("Expected the image to compress to less than %d bytes, got %d", len(m.Pix)/4, buf.Len())
+	}
+	decoded, err := webp.Decode(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sameColors(t, m, decoded)
+
+	if err := EncodeWebPLossless(&buf, image.NewGray(image.Rect(0, 0, 20000, 1))); err == nil {
+		t.Error("Expected an error for an image that is too wide for WebP")
+	}
+}
@@ -0,0 +1,216 @@
+package plates
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// errXPM is returned when an XPM image could not be decoded
+var errXPM = errors.New("invalid XPM image")
+
+// DecodeXPM decodes an XPM image from r. Both XPM2 and XPM3 (C source) images are supported.
+// The colors can be given as hex values, as named X11 colors or as "None" for transparent pixels.
+// If there are 256 colors or less, an *image.Paletted is returned,
+// otherwise an *image.NRGBA is returned.
+func DecodeXPM(r io.Reader) (image.Image, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	var lines []string
+	switch text := strings.TrimLeft(string(data), " \t\r\n"); {
+	case strings.HasPrefix(text, "! XPM2"):
+		lines = xpm2Lines(text)
+	case strings.HasPrefix(text, "/* XPM */"):
+		if lines, err = xpm3Strings(text); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, errXPM
+	}
+	if len(lines) == 0 {
+		return nil, errXPM
+	}
+
+	// The values line: width, height, number of colors and characters per pixel.
+	// Any hotspot or extension fields that follow are ignored.
+	fields := strings.Fields(lines[0])
+	if len(fields) < 4 {
+		return nil, fmt.Errorf("%w: the values line is too short", errXPM)
+	}
+	var values [4]int
+	for i := range values {
+		if values[i], err = strconv.Atoi(fields[i]); err != nil || values[i] < 0 {
+			return nil, fmt.Errorf("%w: invalid value: %q", errXPM, fields[i])
+		}
+	}
+	width, height, numColors, cpp := values[0], values[1], values[2], values[3]
+	if cpp == 0 || numColors >= len(lines) || height >= len(lines) || len(lines) < 1+numColors+height {
+		return nil, fmt.Errorf("%w: expected %d colors and %d rows", errXPM, numColors, height)
+	}
+	if height > 0 && (width == 0 || width > maxPixels/height) {
+		return nil, fmt.Errorf("%w: invalid size: %dx%d", errXPM, width, height)
+	}
+
+	// The color table
+	var (
+		palette = make(color.Palette, numColors)
+		codes   = make(map[string]uint32, numColors)
+	)
+	for i, line := range lines[1 : 1+numColors] {
+		if len(line) < cpp {
+			return nil, fmt.Errorf("%w: color %d is too short", errXPM, i)
+		}
+		c, err := parseXPMColorSpec(line[cpp:])
+		if err != nil {
+			return nil, err
+		}
+		palette[i] = c
+		codes[line[:cpp]] = uint32(i)
+	}
+
+	// The pixels
+	rows := lines[1+numColors : 1+numColors+height]
+	rect := image.Rect(0, 0, width, height)
+	if numColors <= 256 {
+		m := image.NewPaletted(rect, palette)
+		err := decodeXPMPixels(rows, width, cpp, codes, func(x, y int, i uint32) {
+			m.Pix[y*m.Stride+x] = uint8(i)
+		})
+		return m, err
+	}
+	m := image.NewNRGBA(rect)
+	err = decodeXPMPixels(rows, width, cpp, codes, func(x, y int, i uint32) {
+		m.SetNRGBA(x, y, palette[i].(color.NRGBA))
+	})
+	return m, err
+}
+
+// decodeXPMPixels looks up the color index of each pixel and calls set with it
+func decodeXPMPixels(rows []string, width, cpp int, codes map[string]uint32, set func(x, y int, i uint32)) error {
+	for y, row := range rows {
+		if len(row) < width*cpp {
+			return fmt.Errorf("%w: row %d is too short", errXPM, y)
+		}
+		for x := 0; x < width; x++ {
+			i, ok := codes[row[x*cpp:(x+1)*cpp]]
+			if !ok {
+				return fmt.Errorf("%w: unknown pixel code %q", errXPM, row[x*cpp:(x+1)*cpp])
+			}
+			set(x, y, i)
+		}
+	}
+	return nil
+}
+
+// xpm2Lines returns the lines of an XPM2 image, after the header and without comments
+func xpm2Lines(text string) []string {
+	var lines []string
+	scanner := bufio.NewScanner(strings.NewReader(text))
+	scanner.Buffer(nil, len(text)+1)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if strings.HasPrefix(line, "!") {
+			continue
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// xpm3Strings returns all the string literals in the C source of an XPM3 image, skipping comments
+func xpm3Strings(text string) ([]string, error) {
+	var strs []string
+	for i := 0; i < len(text); i++ {
+		switch {
+		case strings.HasPrefix(text[i:], "/*"):
+			end := strings.Index(text[i+2:], "*/")
+			if end < 0 {
+				return nil, fmt.Errorf("%w: unterminated comment", errXPM)
+			}
+			i += end + 3
+		case text[i] == '"':
+			var sb strings.Builder
+			for i++; i < len(text) && text[i] != '"'; i++ {
+				if text[i] == '\\' && i+1 < len(text) {
+					i++
+				}
+				sb.WriteByte(text[i])
+			}
+			if i >= len(text) {
+				return nil, fmt.Errorf("%w: unterminated string", errXPM)
+			}
+			strs = append(strs, sb.String())
+		}
+	}
+	return strs, nil
+}
+
+// parseXPMColorSpec parses the color specification of an entry in the color table,
+// like "c #ff0000 m black". Color values (c) are preferred over grayscale (g, g4),
+// which are preferred over monochrome (m). Symbolic names (s) are ignored.
+func parseXPMColorSpec(spec string) (color.Color, error) {
+	var (
+		key    string
+		values = make(map[string][]string)
+	)
+	for _, field := range strings.Fields(spec) {
+		switch field {
+		case "c", "m", "g", "g4", "s":
+			key = field
+			values[key] = nil
+		default:
+			if key == "" {
+				return nil, fmt.Errorf("%w: invalid color: %q", errXPM, spec)
+			}
+			values[key] = append(values[key], field)
+		}
+	}
+	for _, key := range []string{"c", "g", "g4", "m"} {
+		if words, ok := values[key]; ok && len(words) > 0 {
+			return parseXPMColor(strings.Join(words, " "))
+		}
+	}
+	return nil, fmt.Errorf("%w: no color in %q", errXPM, spec)
+}
+
+// parseXPMColor parses a single color value, like "#ff0000", "red" or "None"
+func parseXPMColor(s string) (color.Color, error) {
+	if strings.EqualFold(s, "none") {
+		return color.NRGBA{}, nil
+	}
+	if strings.HasPrefix(s, "#") {
+		hex := s[1:]
+		if len(hex) == 0 || len(hex)%3 != 0 || len(hex) > 12 {
+			return nil, fmt.Errorf("%w: invalid color: %q", errXPM, s)
+		}
+		// Each component has the same number of hex digits, and only the
+		// most significant byte of each component is used
+		n := len(hex) / 3
+		var rgb [3]uint8
+		for i := range rgb {
+			v, err := strconv.ParseUint(hex[i*n:(i+1)*n], 16, 16)
+			if err != nil {
+				return nil, fmt.Errorf("%w: invalid color: %q", errXPM, s)
+			}
+			switch n {
+			case 1:
+				rgb[i] = uint8(v * 0x11)
+			default:
+				rgb[i] = uint8(v >> (4 * (n - 2)))
+			}
+		}
+		return color.NRGBA{rgb[0], rgb[1], rgb[2], 255}, nil
+	}
+	name := strings.ToLower(strings.ReplaceAll(s, " ", ""))
+	if c, ok := x11Colors[name]; ok {
+		return color.NRGBA{c.R, c.G, c.B, 255}, nil
+	}
+	return nil, fmt.Errorf("%w: unknown color name: %q", errXPM, s)
+}
@@ -0,0 +1,113 @@
+package plates
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testXPM3 = `/* XPM */
+static char * test_xpm[] = {
+/* columns rows colors chars-per-pixel */
+"3 2 4 2 0 0",
+"  c None",
+".. c #FF0000 m black",
+"+. s border c light slate blue",
+"@@ g #888 m white",
+/* pixels */
+"  ..+.",
+"@@\"\"..",
+};`
+
+func TestDecodeXPM3(t *testing.T) {
+	// "" is not in the color table
+	if _, err := DecodeXPM(strings.NewReader(testXPM3)); err == nil {
+		t.Error("Expected an error for an unknown pixel code")
+	}
+	m, err := DecodeXPM(strings.NewReader(strings.Replace(testXPM3, `\"\"`, "  ", 1)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Bounds() != image.Rect(0, 0, 3, 2) {
+		t.Fatalf("Unexpected bounds: %v", m.Bounds())
+	}
+	expected := [][]color.NRGBA{
+		{{0, 0, 0, 0}, {255, 0, 0, 255}, {132, 112, 255, 255}},
+		{{136, 136, 136, 255}, {0, 0, 0, 0}, {255, 0, 0, 255}},
+	}
+	for y, row := range expected {
+		for x, c := range row {
+			if got := color.NRGBAModel.Convert(m.At(x, y)); got != c {
+				t.Errorf("Expected %v at (%d, %d), got %v", c, x, y, got)
+			}
+		}
+	}
+}
+
+func TestDecodeXPM2(t *testing.T) {
+	const data = "! XPM2\n2 2 2 1\na c #ffffffffffff\nb c black\nab\nba\n"
+	m, err := DecodeXPM(strings.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c := color.RGBAModel.Convert(m.At(0, 0)); c != (color.RGBA{255, 255, 255, 255}) {
+		t.Errorf("Expected white, got %v", c)
+	}
+	if c := color.RGBAModel.Convert(m.At(0, 1)); c != (color.RGBA{0, 0, 0, 255}) {
+		t.Errorf("Expected black, got %v", c)
+	}
+}
+
+func TestDecodeXPMInvalidSize(t *testing.T) {
+	for _, values := range []string{
+		"4611686018427387904 1 1 1",
+		"1000000000 1 1 1",
+		"0 1 1 1",
+		"1 1 9223372036854775807 1",
+	} {
+		data := "! XPM2\n" + values + "\na c black\na\n"
+		if _, err := DecodeXPM(strings.NewReader(data)); !errors.Is(err, errXPM) {
+			t.Errorf("%s: expected errXPM, got %v", values, err)
+		}
+	}
+}
+
+func TestXPMRoundTrip(t *testing.T) {
+	var buf bytes.Buffer
+	if err := Encode(&buf, testImage(), "xpm", nil); err != nil {
+		t.Fatal(err)
+	}
+	m, format, err := Decode(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if format != "xpm" {
+		t.Errorf("Expected xpm, got %s", format)
+	}
+	same(t, "XPM", testImage(), toRGBA(m))
+
+	filename := filepath.Join(t.TempDir(), "test.xpm")
+	if err := Write(filename, testImage()); err != nil {
+		t.Fatal(err)
+	}
+	if m, err = Read(filename); err != nil {
+		t.Fatal(err)
+	}
+	same(t, "XPM", testImage(), toRGBA(m))
+}
+
+// toRGBA converts an image to *image.RGBA
+func toRGBA(m image.Image) *image.RGBA {
+	rect := m.Bounds()
+	rgba := image.NewRGBA(rect)
+	for y := rect.Min.Y; y < rect.Max.Y; y++ {
+		for x := rect.Min.X; x < rect.Max.X; x++ {
+			rgba.Set(x, y, m.At(x, y))
+		}
+	}
+	return rgba
+}